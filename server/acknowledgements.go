@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+)
+
+// Posts that need more than passive visibility, such as incident or policy
+// announcements, carry ackRequiredProp and an "Acknowledge" button. Pressing
+// it records an acknowledgement, which is stored apart from reads.
+
+const (
+	ackRequiredProp   = "readreceipts_ack_required"
+	ackCommandTrigger = "ack"
+	ackActionID       = "readreceiptsacknowledge"
+	ackActionURL      = "/plugins/mattermost-readreceipts/api/v2/ack"
+)
+
+// PostAck is one acknowledgement of a post.
+type PostAck struct {
+	UserID  string `json:"user_id"`
+	AckedAt int64  `json:"acked_at"`
+}
+
+// PostAcksResponse lists who has and has not acknowledged a post. The
+// counts cover the channel's current members, skipping bots, deactivated
+// users and the author; Acknowledged also keeps users who have since left.
+type PostAcksResponse struct {
+	PostID       string    `json:"post_id"`
+	MemberCount  int       `json:"member_count"`
+	AckedCount   int       `json:"acked_count"`
+	PendingCount int       `json:"pending_count"`
+	Acknowledged []PostAck `json:"acknowledged"` // null with counts_only
+	Pending      []string  `json:"pending"`      // null with counts_only
+	Truncated    bool      `json:"truncated,omitempty"`
+}
+
+// isAckRequired reports whether post asks its readers for an acknowledgement.
+func isAckRequired(post *model.Post) bool {
+	required, _ := post.GetProp(ackRequiredProp).(bool)
+	return required
+}
+
+// requireAck marks post as requiring acknowledgement and adds the button.
+func requireAck(post *model.Post) {
+	post.AddProp(ackRequiredProp, true)
+	attachments := append(post.Attachments(), &model.SlackAttachment{
+		Text: "Please acknowledge this post.",
+		Actions: []*model.PostAction{{
+			Id:          ackActionID,
+			Type:        model.PostActionTypeButton,
+			Name:        "Acknowledge",
+			Style:       "primary",
+			Integration: &model.PostActionIntegration{URL: ackActionURL},
+		}},
+	})
+	model.ParseSlackAttachment(post, attachments)
+}
+
+// registerCommands registers /ack, which posts a message that requires
+// acknowledgement.
+func (p *Plugin) registerCommands() error {
+	if err := p.API.RegisterCommand(&model.Command{
+		Trigger:          ackCommandTrigger,
+		DisplayName:      "Acknowledge",
+		Description:      "Post a message that channel members must acknowledge",
+		AutoComplete:     true,
+		AutoCompleteDesc: "Post a message that channel members must acknowledge",
+		AutoCompleteHint: "[message]",
+	}); err != nil {
+		return errors.Wrap(err, "failed to register /"+ackCommandTrigger+" command")
+	}
+	return nil
+}
+
+// ExecuteCommand handles /ack <message>.
+func (p *Plugin) ExecuteCommand(_ *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	ephemeral := func(text string) (*model.CommandResponse, *model.AppError) {
+		return &model.CommandResponse{ResponseType: model.CommandResponseTypeEphemeral, Text: text}, nil
+	}
+
+	message := strings.TrimSpace(args.Command)
+	message = strings.TrimSpace(strings.TrimPrefix(message, "/"+ackCommandTrigger))
+	if message == "" {
+		return ephemeral("Usage: /" + ackCommandTrigger + " [message]")
+	}
+	if !p.API.HasPermissionToChannel(args.UserId, args.ChannelId, model.PermissionCreatePost) {
+		return ephemeral("You cannot post in this channel.")
+	}
+
+	post := &model.Post{
+		UserId:    args.UserId,
+		ChannelId: args.ChannelId,
+		RootId:    args.RootId,
+		Message:   message,
+	}
+	requireAck(post)
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		p.logError("[Ack] Failed to create post", "channel_id", args.ChannelId, "error", appErr.Error())
+		return ephemeral("Failed to post the message.")
+	}
+	return &model.CommandResponse{}, nil
+}
+
+// HandleRequireAck handles POST /api/v2/posts/{postID}/ack_required. Only
+// the author may mark a post.
+func (p *Plugin) HandleRequireAck(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	post := p.getReadablePost(w, r)
+	if post == nil {
+		return
+	}
+	if post.UserId != userID {
+		http.Error(w, "Only the author can require acknowledgement", http.StatusForbidden)
+		return
+	}
+
+	if !isAckRequired(post) {
+		post = post.Clone()
+		requireAck(post)
+		if _, appErr := p.API.UpdatePost(post); appErr != nil {
+			p.logError("[Ack] Failed to update post", "post_id", post.Id, "error", appErr.Error())
+			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// HandleAcknowledge handles POST /api/v2/ack, the integration behind the
+// "Acknowledge" button.
+func (p *Plugin) HandleAcknowledge(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var req model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		p.logError("[Ack] Failed to decode action request", "error", err.Error())
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	post, appErr := p.API.GetPost(req.PostId)
+	if appErr != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if !isAckRequired(post) {
+		http.Error(w, "Post does not require acknowledgement", http.StatusBadRequest)
+		return
+	}
+
+	respond := func(text string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{EphemeralText: text})
+	}
+	if post.UserId == userID {
+		respond("You cannot acknowledge your own post.")
+		return
+	}
+	if !p.isChannelMember(userID, post.ChannelId) {
+		p.logError("[Ack] Acknowledgement from non-member", "channel_id", post.ChannelId, "user_id", userID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	added, err := p.store.SaveAcknowledgement(store.Acknowledgement{
+		MessageID: post.Id,
+		UserID:    userID,
+		ChannelID: post.ChannelId,
+		AckedAt:   time.Now().UnixMilli(),
+	})
+	if err != nil {
+		p.logError("[Ack] Failed to save acknowledgement", "post_id", post.Id, "error", err.Error())
+		http.Error(w, "Failed to save acknowledgement", http.StatusInternalServerError)
+		return
+	}
+	if !added {
+		respond("You have already acknowledged this post.")
+		return
+	}
+
+	p.publishAcknowledged(post, userID)
+	respond("Acknowledged.")
+}
+
+// HandleGetPostAcks handles GET /api/v2/posts/{postID}/acks. With
+// ?counts_only=true only the counts are returned.
+func (p *Plugin) HandleGetPostAcks(w http.ResponseWriter, r *http.Request) {
+	countsOnly := r.URL.Query().Get("counts_only") == "true"
+
+	post := p.getReadablePost(w, r)
+	if post == nil {
+		return
+	}
+	if !isAckRequired(post) {
+		http.Error(w, "Post does not require acknowledgement", http.StatusBadRequest)
+		return
+	}
+
+	response, err := p.getPostAcks(post, countsOnly)
+	if err != nil {
+		p.logError("[Ack] Failed to get acknowledgements", "post_id", post.Id, "error", err.Error())
+		http.Error(w, "Failed to get acknowledgements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.logError("[Ack] Error encoding acknowledgements", "post_id", post.Id, "error", err.Error())
+	}
+}
+
+// getPostAcks splits the channel's members into those who acknowledged post
+// and those who have not yet.
+func (p *Plugin) getPostAcks(post *model.Post, countsOnly bool) (*PostAcksResponse, error) {
+	acks, err := p.store.GetAcknowledgements(post.Id)
+	if err != nil {
+		return nil, err
+	}
+	acked := make(map[string]bool, len(acks))
+	for _, ack := range acks {
+		acked[ack.UserID] = true
+	}
+
+	response := &PostAcksResponse{PostID: post.Id}
+	if !countsOnly {
+		response.Acknowledged = []PostAck{}
+		response.Pending = []string{}
+		for _, ack := range acks {
+			response.Acknowledged = append(response.Acknowledged, PostAck{UserID: ack.UserID, AckedAt: ack.AckedAt})
+		}
+	}
+
+	err = p.forEachCountedMember(post, func(userID string) {
+		response.MemberCount++
+		if acked[userID] {
+			response.AckedCount++
+			return
+		}
+		response.PendingCount++
+		if countsOnly {
+			return
+		}
+		if len(response.Pending) < unreadListLimit {
+			response.Pending = append(response.Pending, userID)
+		} else {
+			response.Truncated = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// publishAcknowledged tells the author that userID acknowledged post, with
+// the counts the acks endpoint reports.
+func (p *Plugin) publishAcknowledged(post *model.Post, userID string) {
+	counts, err := p.getPostAcks(post, true)
+	if err != nil {
+		p.logError("[Ack] Failed to count acknowledgements", "post_id", post.Id, "error", err.Error())
+		return
+	}
+	p.PublishAcknowledged(post.UserId, post.ChannelId, post.Id, userID, counts.AckedCount, counts.MemberCount)
+}
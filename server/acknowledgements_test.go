@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteAckCommand(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	api.On("HasPermissionToChannel", "author", "channel1", model.PermissionCreatePost).Return(true)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		attachments := post.Attachments()
+		return post.Message == "Read the new policy" &&
+			isAckRequired(post) &&
+			len(attachments) == 1 &&
+			attachments[0].Actions[0].Integration.URL == ackActionURL
+	})).Return(&model.Post{}, nil).Once()
+
+	response, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "author", ChannelId: "channel1", Command: "/ack  Read the new policy "})
+	require.Nil(t, appErr)
+	assert.Empty(t, response.Text)
+
+	response, appErr = p.ExecuteCommand(nil, &model.CommandArgs{UserId: "author", ChannelId: "channel1", Command: "/ack"})
+	require.Nil(t, appErr)
+	assert.Contains(t, response.Text, "Usage")
+}
+
+func TestHandleRequireAck(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}, nil)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), "channel1", model.PermissionReadChannel).Return(true)
+	api.On("UpdatePost", mock.MatchedBy(isAckRequired)).Return(&model.Post{}, nil).Once()
+
+	post := func(userID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/posts/post1/ack_required", nil)
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusForbidden, post("member"))
+	assert.Equal(t, http.StatusOK, post("author"))
+}
+
+func TestHandleAcknowledge(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}
+	requireAck(post)
+	api.On("GetPost", "post1").Return(post, nil)
+	api.On("GetPost", "plain").Return(&model.Post{Id: "plain", ChannelId: "channel1", UserId: "author"}, nil)
+	api.On("GetChannelMember", "channel1", "member").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "member"}, nil)
+	api.On("GetUsersInChannel", "channel1", "username", 0, maxPerPage).Return([]*model.User{
+		{Id: "author"}, {Id: "member"}, {Id: "other"},
+	}, nil)
+	// Someone who acknowledged and then left is not counted, as in the acks
+	// endpoint
+	_, err := p.store.SaveAcknowledgement(store.Acknowledgement{MessageID: "post1", UserID: "former", ChannelID: "channel1", AckedAt: 1})
+	require.NoError(t, err)
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventAcknowledged,
+		map[string]interface{}{"MessageID": "post1", "ChannelID": "channel1", "UserID": "member", "AckedCount": 1, "MemberCount": 2},
+		&model.WebsocketBroadcast{UserId: "author"},
+	).Return().Once()
+
+	ack := func(userID, postID string) (int, string) {
+		body, _ := json.Marshal(model.PostActionIntegrationRequest{UserId: userID, PostId: postID})
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/ack", bytes.NewReader(body))
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+
+		var response model.PostActionIntegrationResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response.EphemeralText
+	}
+
+	code, text := ack("member", "post1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Acknowledged.", text)
+	_, text = ack("member", "post1")
+	assert.Contains(t, text, "already")
+	_, text = ack("author", "post1")
+	assert.Contains(t, text, "own post")
+	code, _ = ack("member", "plain")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	acks, err := p.store.GetAcknowledgements("post1")
+	require.NoError(t, err)
+	require.Len(t, acks, 2)
+	assert.Equal(t, "member", acks[1].UserID)
+
+	// A read is not an acknowledgement
+	events, err := p.store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestHandleGetPostAcks(t *testing.T) {
+	p, api := setupTestPlugin(t)
+
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}
+	requireAck(post)
+	api.On("GetPost", "post1").Return(post, nil)
+	api.On("HasPermissionToChannel", "author", "channel1", model.PermissionReadChannel).Return(true)
+	api.On("GetUsersInChannel", "channel1", "username", 0, maxPerPage).Return([]*model.User{
+		{Id: "author"},
+		{Id: "acked"},
+		{Id: "pending"},
+		{Id: "bot", IsBot: true},
+	}, nil)
+
+	_, err := p.store.SaveAcknowledgement(store.Acknowledgement{MessageID: "post1", UserID: "acked", ChannelID: "channel1", AckedAt: 100})
+	require.NoError(t, err)
+	_, err = p.store.SaveAcknowledgement(store.Acknowledgement{MessageID: "post1", UserID: "left", ChannelID: "channel1", AckedAt: 200})
+	require.NoError(t, err)
+
+	get := func(query string) PostAcksResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/posts/post1/acks"+query, nil)
+		req.Header.Set("Mattermost-User-Id", "author")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response PostAcksResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+
+	assert.Equal(t, PostAcksResponse{
+		PostID:       "post1",
+		MemberCount:  2,
+		AckedCount:   1,
+		PendingCount: 1,
+		Acknowledged: []PostAck{{UserID: "acked", AckedAt: 100}, {UserID: "left", AckedAt: 200}},
+		Pending:      []string{"pending"},
+	}, get(""))
+	assert.Equal(t, PostAcksResponse{PostID: "post1", MemberCount: 2, AckedCount: 1, PendingCount: 1}, get("?counts_only=true"))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -19,13 +20,38 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 	router := mux.NewRouter()
 
 	router.Handle("/api/v1/read", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleReadReceipt))).Methods("POST")
-	router.Handle("/api/v1/channel/{channelID}/readers", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetChannelReaders))).Methods("GET")
-	router.Handle("/api/v1/channel/{channelID}/reads", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetChannelReads))).Methods("GET")
-	router.Handle("/api/v1/receipts", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetReceipts))).Methods("GET")
+	router.Handle("/api/v1/channel/{channelID}/readers", p.MattermostAuthorizationRequired(p.ChannelReadRequired(p.ReceiptsEnabledRequired(p.ReaderListsRequired(http.HandlerFunc(p.HandleGetChannelReaders)))))).Methods("GET")
+	router.Handle("/api/v1/channel/{channelID}/settings", p.MattermostAuthorizationRequired(p.ChannelReadRequired(http.HandlerFunc(p.HandleGetChannelSettings)))).Methods("GET")
+	router.Handle("/api/v1/channel/{channelID}/settings", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleSetChannelSettings))).Methods("PUT")
+	router.Handle("/api/v1/channel/{channelID}/reads", p.MattermostAuthorizationRequired(p.ChannelReadRequired(p.ReceiptsEnabledRequired(p.ReaderListsRequired(http.HandlerFunc(p.HandleGetChannelReads)))))).Methods("GET")
+	router.Handle("/api/v1/receipts", p.MattermostAuthorizationRequired(p.ChannelReadRequired(p.ReceiptsEnabledRequired(p.ReaderListsRequired(http.HandlerFunc(p.HandleGetReceipts)))))).Methods("GET")
 	router.Handle("/api/v1/config", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetConfig))).Methods("GET")
+	router.Handle("/api/v1/privacy", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetPrivacy))).Methods("GET")
+	router.Handle("/api/v1/privacy", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleSetPrivacy))).Methods("PUT")
 	router.Handle("/api/v1/debug/ping", http.HandlerFunc(p.HandlePing)).Methods("GET")
-	router.Handle("/api/v1/debug/db", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleDBCheck))).Methods("GET")
-	router.Handle("/api/v1/read/channel/{channelID}", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetReadersSince))).Methods("GET")
+	router.Handle("/api/v1/debug/db", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleDBCheck)))).Methods("GET")
+	router.Handle("/api/v1/debug/metrics", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleMetrics)))).Methods("GET")
+	router.Handle("/api/v1/admin/retention", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleGetRetention)))).Methods("GET")
+	router.Handle("/api/v1/admin/retention/run", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleRunRetention)))).Methods("POST")
+	router.Handle("/api/v1/admin/last_viewed_sync", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleGetLastViewedSync)))).Methods("GET")
+	router.Handle("/api/v1/admin/last_viewed_sync/run", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleRunLastViewedSync)))).Methods("POST")
+	router.Handle("/api/v1/admin/teams/settings", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleGetTeamSettings)))).Methods("GET")
+	router.Handle("/api/v1/admin/teams/{teamID}/settings", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleSetTeamSettings)))).Methods("PUT")
+	router.Handle("/api/v1/admin/legal_holds", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleGetLegalHolds)))).Methods("GET")
+	router.Handle("/api/v1/admin/legal_holds", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleCreateLegalHold)))).Methods("POST")
+	router.Handle("/api/v1/admin/legal_holds/audit", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleGetLegalHoldAudit)))).Methods("GET")
+	router.Handle("/api/v1/admin/legal_holds/{holdID}", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleGetLegalHold)))).Methods("GET")
+	router.Handle("/api/v1/admin/legal_holds/{holdID}", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleUpdateLegalHold)))).Methods("PUT")
+	router.Handle("/api/v1/admin/legal_holds/{holdID}", p.MattermostAuthorizationRequired(p.SystemAdminRequired(http.HandlerFunc(p.HandleDeleteLegalHold)))).Methods("DELETE")
+	router.Handle("/api/v1/read/channel/{channelID}", p.MattermostAuthorizationRequired(p.ChannelReadRequired(p.ReceiptsEnabledRequired(p.ReaderListsRequired(http.HandlerFunc(p.HandleGetReadersSince)))))).Methods("GET")
+	router.Handle("/api/v2/read/batch", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleBatchReadReceipt))).Methods("POST")
+	router.Handle("/api/v2/posts/{postID}/readers", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetPostReaders))).Methods("GET")
+	router.Handle("/api/v2/posts/{postID}/unread", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetPostUnread))).Methods("GET")
+	router.Handle("/api/v2/posts/{postID}/receipts", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetPostReceipts))).Methods("GET")
+	router.Handle("/api/v2/delivered", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleDelivered))).Methods("POST")
+	router.Handle("/api/v2/posts/{postID}/acks", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleGetPostAcks))).Methods("GET")
+	router.Handle("/api/v2/posts/{postID}/ack_required", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleRequireAck))).Methods("POST")
+	router.Handle("/api/v2/ack", p.MattermostAuthorizationRequired(http.HandlerFunc(p.HandleAcknowledge))).Methods("POST")
 
 	p.logDebug("[API] Received request",
 		"path", r.URL.Path,
@@ -85,6 +111,24 @@ func (p *Plugin) HandleDBCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// HandleMetrics reports write queue depth and flush statistics, and the
+// reader cache's hits and misses when it is on.
+func (p *Plugin) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if p.writeQueue == nil {
+		http.Error(w, "Write queue not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	metrics := map[string]interface{}{
+		"write_queue": p.writeQueue.Metrics(),
+	}
+	if p.readerCache != nil {
+		metrics["reader_cache"] = p.readerCache.Metrics()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
 func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("Mattermost-User-Id")
 	if userID == "" {
@@ -133,12 +177,21 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	channelID := req.ChannelID
-	if channelID == "" {
-		channelID = post.ChannelId
-		p.logDebug("[API] Using channel_id from post",
-			"channel_id", channelID,
-			"message_id", req.MessageID)
+	// The post decides the channel; a mismatching channel_id is a client bug
+	channelID := post.ChannelId
+	if req.ChannelID != "" && req.ChannelID != channelID {
+		p.logError("[API] channel_id does not match post",
+			"message_id", req.MessageID,
+			"channel_id", req.ChannelID,
+			"post_channel_id", channelID)
+		http.Error(w, "channel_id does not match message_id", http.StatusBadRequest)
+		return
+	}
+
+	if !p.isChannelMember(userID, channelID) {
+		p.logError("[API] Read receipt from non-member", "channel_id", channelID, "user_id", userID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
 	}
 
 	// Get channel info to check if it's a DM
@@ -148,6 +201,16 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to get channel info", http.StatusInternalServerError)
 		return
 	}
+	enabled, settingsErr := p.receiptsEnabled(channel)
+	if settingsErr != nil {
+		p.logError("[API] Failed to check receipt settings", "channel_id", channelID, "error", settingsErr.Error())
+		http.Error(w, "Failed to check receipt settings", http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		http.Error(w, "Read receipts are disabled in this channel", http.StatusForbidden)
+		return
+	}
 
 	// Save receipt to database first
 	readEvent := store.ReadEvent{
@@ -163,7 +226,13 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 		"channel_id", channelID,
 	)
 
-	if err := p.store.Upsert(readEvent); err != nil {
+	if err := p.saveReadEvent(readEvent); err != nil {
+		if errors.Is(err, errWriteQueueFull) {
+			p.logError("[API] Read event queue is full", "message_id", req.MessageID)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many pending read receipts", http.StatusServiceUnavailable)
+			return
+		}
 		p.logError("[API] Failed to save read event", "error", err.Error())
 		http.Error(w, "Failed to save read event", http.StatusInternalServerError)
 		return
@@ -174,27 +243,49 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 		"user_id", userID,
 	)
 
-	// Get all current readers for this message first
-	channelEvents, storeErr := p.store.GetByChannel(channelID, "")
-	if storeErr != nil {
-		p.logError("[API] Failed to get channel events", "channel_id", channelID, "error", storeErr.Error())
+	// Reads of users who hide their receipts are stored but never announced
+	privacy := p.getBroadcastPrivacy()
+	if privacy == nil || privacy.isHidden(userID) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "ok",
+		})
+		return
+	}
+
+	// Large channels only get throttled counts; the reader list is not rebuilt
+	if channel.Type != model.ChannelTypeDirect && p.isLargeChannel(channelID) {
+		p.scheduleReadCounts(post)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "ok",
+		})
+		return
 	}
 
-	// Initialize with current reader
-	userIDs := []string{userID}
-	userIDMap := map[string]bool{userID: true}
+	if channel.Type == model.ChannelTypeDirect {
+		// Get all current readers for this message first
+		channelEvents, storeErr := p.store.GetByChannel(channelID, "")
+		if storeErr != nil {
+			p.logError("[API] Failed to get channel events", "channel_id", channelID, "error", storeErr.Error())
+		}
+
+		// Initialize with current reader
+		userIDs := []string{userID}
+		userIDMap := map[string]bool{userID: true}
 
-	// Add historical readers
-	if storeErr == nil {
-		for _, event := range channelEvents {
-			if event.MessageID == req.MessageID && !userIDMap[event.UserID] {
-				userIDMap[event.UserID] = true
-				userIDs = append(userIDs, event.UserID)
+		// Add historical readers
+		if storeErr == nil {
+			for _, event := range channelEvents {
+				if event.MessageID == req.MessageID && !userIDMap[event.UserID] && !privacy.isHidden(event.UserID) {
+					userIDMap[event.UserID] = true
+					userIDs = append(userIDs, event.UserID)
+				}
 			}
 		}
-	}
 
-	if channel.Type == model.ChannelTypeDirect {
 		// DM channel handling - notify the other participant only
 		p.API.LogWarn("[DEBUG-RR-DM] 🔍 Starting DM read receipt processing",
 			"channelID", channelID,
@@ -226,6 +317,10 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 		// Send to other DM participant only
 		for _, member := range members {
 			if member.UserId != userID {
+				if privacy.isBlind(member.UserId) {
+					break
+				}
+
 				// Build event data with detailed state
 				eventData := map[string]interface{}{
 					"MessageID": req.MessageID,
@@ -259,7 +354,7 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 				)
 
 				// If message author is different from both participants, notify them too
-				if post.UserId != member.UserId && post.UserId != userID {
+				if post.UserId != member.UserId && post.UserId != userID && !privacy.isBlind(post.UserId) {
 					p.API.LogWarn("[DEBUG-RR-DM] 📨 Sending read receipt to message author",
 						"authorID", post.UserId,
 						"messageID", req.MessageID,
@@ -297,57 +392,33 @@ func (p *Plugin) HandleReadReceipt(w http.ResponseWriter, r *http.Request) {
 		)
 
 		// Send read receipt to the author
-		p.API.PublishWebSocketEvent(
-			WebSocketEventReadReceipt,
-			map[string]interface{}{
-				"MessageID": post.Id,
-				"UserID":    userID,
-				"ChannelID": channelID,
-			},
-			&model.WebsocketBroadcast{
-				UserId: post.UserId,
-			},
-		)
+		if !privacy.isBlind(post.UserId) {
+			p.API.PublishWebSocketEvent(
+				WebSocketEventReadReceipt,
+				map[string]interface{}{
+					"MessageID": post.Id,
+					"UserID":    userID,
+					"ChannelID": channelID,
+				},
+				&model.WebsocketBroadcast{
+					UserId: post.UserId,
+				},
+			)
+		}
 
-		// For regular channels, broadcast channel readers update
-		p.API.LogDebug("[DEBUG-RR] Broadcasting channel readers update",
+		// For regular channels, announce the new reader; the broadcaster
+		// merges it with the channel's other reads
+		p.API.LogDebug("[DEBUG-RR] Queueing channel readers update",
 			"channelID", channelID,
 			"messageID", req.MessageID,
 			"readerID", userID,
 		)
+		p.queueReaders(channelID, map[string][]string{req.MessageID: {userID}})
+	}
 
-		// Gather all current readers for this message
-		channelEvents, storeErr := p.store.GetByChannel(channelID, "")
-		if storeErr != nil {
-			p.logError("[API] Failed to get channel events", "channel_id", channelID, "error", storeErr.Error())
-		}
-
-		// Initialize with current reader
-		userIDs := []string{userID}
-		userIDMap := map[string]bool{userID: true}
-
-		// Add historical readers
-		if storeErr == nil {
-			for _, event := range channelEvents {
-				if event.MessageID == req.MessageID && !userIDMap[event.UserID] {
-					userIDMap[event.UserID] = true
-					userIDs = append(userIDs, event.UserID)
-				}
-			}
-		}
-
-		// Single broadcast with all readers
-		p.API.PublishWebSocketEvent(
-			WebSocketEventChannelReaders,
-			map[string]interface{}{
-				"ChannelID":  channelID,
-				"LastPostID": req.MessageID,
-				"UserIDs":    userIDs,
-			},
-			&model.WebsocketBroadcast{
-				ChannelId: channelID,
-			},
-		)
+	// The author's delivered/read counts; the read may still be queued
+	if post.UserId != userID {
+		p.scheduleReceiptCounts(post, userID)
 	}
 
 	// No final broadcast needed - DM and channel broadcasts are already handled above
@@ -377,7 +448,7 @@ func (p *Plugin) HandleSimpleRead(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", 404)
 		return
 	}
-	_ = p.readReceiptStore.MarkPostAsRead(post.Id, userID)
+	_ = p.readReceiptStore.MarkPostAsRead(post.Id, post.ChannelId, userID)
 
 	// read_receipt event
 	p.API.PublishWebSocketEvent(EventReadReceipt, map[string]interface{}{
@@ -443,6 +514,12 @@ func (p *Plugin) HandleGetReceipts(w http.ResponseWriter, r *http.Request) {
 		events = filteredEvents
 	}
 
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+	events = privacy.filterEvents(userID, events)
+
 	p.logDebug("[API] Returning read receipts",
 		"channel_id", channelID,
 		"event_count", len(events))
@@ -493,6 +570,7 @@ func (p *Plugin) HandleGetReadersSince(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	p.refreshInferredReads(channelID)
 	readers, err := p.store.GetReadersSince(channelID, sinceMs, userID)
 	if err != nil {
 		p.logError("[API] Failed to get readers since",
@@ -503,6 +581,12 @@ func (p *Plugin) HandleGetReadersSince(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+	readers = privacy.filterUserIDs(userID, readers)
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(readers); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -530,6 +614,7 @@ func (p *Plugin) HandleGetChannelReaders(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	p.refreshInferredReads(channelID)
 	readers, err := p.store.GetReadersSince(channelID, sinceMs, userID)
 	if err != nil {
 		p.logError("[API] Failed to get channel readers",
@@ -540,6 +625,12 @@ func (p *Plugin) HandleGetChannelReaders(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+	readers = privacy.filterUserIDs(userID, readers)
+
 	response := struct {
 		UserIDs []string `json:"user_ids"`
 	}{
@@ -574,6 +665,7 @@ func (p *Plugin) HandleGetChannelReads(w http.ResponseWriter, r *http.Request) {
 		"user_id", userID,
 	)
 
+	p.refreshInferredReads(channelID)
 	reads, err := p.store.GetChannelReads(channelID)
 	if err != nil {
 		p.logError("[API] Failed to get channel reads",
@@ -584,6 +676,12 @@ func (p *Plugin) HandleGetChannelReads(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+	reads = privacy.filterReads(userID, reads)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(reads)
 }
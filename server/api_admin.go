@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// RetentionStatus is the body of GET /api/v1/admin/retention.
+type RetentionStatus struct {
+	RetentionDays int              `json:"retention_days"`
+	Policy        *RetentionPolicy `json:"policy,omitempty"`
+	LastRun       *RetentionRun    `json:"last_run"`
+}
+
+// HandleGetRetention reports the retention setting and the last purge.
+func (p *Plugin) HandleGetRetention(w http.ResponseWriter, r *http.Request) {
+	run, err := p.getLastRetentionRun()
+	if err != nil {
+		p.logError("[API] Failed to read last retention run", "error", err.Error())
+		http.Error(w, "Failed to read retention status", http.StatusInternalServerError)
+		return
+	}
+
+	conf := p.getConfiguration()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RetentionStatus{
+		RetentionDays: conf.RetentionDays,
+		Policy:        conf.retentionPolicy,
+		LastRun:       run,
+	})
+}
+
+// HandleRunRetention starts a purge and a cleanup sweep in the background.
+// The purge result shows up in GET /api/v1/admin/retention once it finishes.
+func (p *Plugin) HandleRunRetention(w http.ResponseWriter, r *http.Request) {
+	if p.retention == nil {
+		http.Error(w, "Retention is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Deactivation cancels this context, ending the run between batches
+	ctx := p.retention.ctx
+	go p.runMaintenance(ctx)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+}
+
+// LastViewedSyncStatus is the body of GET /api/v1/admin/last_viewed_sync.
+type LastViewedSyncStatus struct {
+	IntervalMinutes int             `json:"interval_minutes"`
+	LastRun         *LastViewedSync `json:"last_run"`
+}
+
+// HandleGetLastViewedSync reports the sync interval and the last sync.
+func (p *Plugin) HandleGetLastViewedSync(w http.ResponseWriter, r *http.Request) {
+	run, err := p.getLastViewedSync()
+	if err != nil {
+		p.logError("[API] Failed to read last viewed sync", "error", err.Error())
+		http.Error(w, "Failed to read sync status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LastViewedSyncStatus{
+		IntervalMinutes: p.getConfiguration().LastViewedSyncIntervalMinutes,
+		LastRun:         run,
+	})
+}
+
+// HandleRunLastViewedSync starts a sync of every receipt channel, or of the
+// channel_id query parameter, in the background.
+func (p *Plugin) HandleRunLastViewedSync(w http.ResponseWriter, r *http.Request) {
+	if p.lastViewedSync == nil {
+		http.Error(w, "Last viewed sync is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	channelID := r.URL.Query().Get("channel_id")
+	if channelID != "" && !model.IsValidId(channelID) {
+		http.Error(w, "Invalid channel_id", http.StatusBadRequest)
+		return
+	}
+
+	ctx := p.lastViewedSync.ctx
+	go func() {
+		if _, err := p.runLastViewedSync(ctx, channelID); err != nil {
+			p.logError("[Sync] Last viewed sync failed", "error", err.Error())
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+}
+
+// HandleGetLegalHolds handles GET /api/v1/admin/legal_holds
+func (p *Plugin) HandleGetLegalHolds(w http.ResponseWriter, r *http.Request) {
+	holds, err := p.store.GetLegalHolds()
+	if err != nil {
+		p.logError("[API] Failed to get legal holds", "error", err.Error())
+		http.Error(w, "Failed to get legal holds", http.StatusInternalServerError)
+		return
+	}
+	if holds == nil {
+		holds = []store.LegalHold{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
+
+// HandleGetLegalHold handles GET /api/v1/admin/legal_holds/{holdID}
+func (p *Plugin) HandleGetLegalHold(w http.ResponseWriter, r *http.Request) {
+	hold, err := p.store.GetLegalHold(mux.Vars(r)["holdID"])
+	if err != nil {
+		p.logError("[API] Failed to get legal hold", "error", err.Error())
+		http.Error(w, "Failed to get legal hold", http.StatusInternalServerError)
+		return
+	}
+	if hold == nil {
+		http.Error(w, "Legal hold not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// HandleCreateLegalHold handles POST /api/v1/admin/legal_holds
+func (p *Plugin) HandleCreateLegalHold(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeLegalHoldRequest(w, r)
+	if !ok {
+		return
+	}
+
+	hold, err := p.createLegalHold(r.Header.Get("Mattermost-User-Id"), req)
+	if err != nil {
+		p.logError("[API] Failed to create legal hold", "error", err.Error())
+		http.Error(w, "Failed to create legal hold", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hold)
+}
+
+// HandleUpdateLegalHold handles PUT /api/v1/admin/legal_holds/{holdID}
+func (p *Plugin) HandleUpdateLegalHold(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeLegalHoldRequest(w, r)
+	if !ok {
+		return
+	}
+
+	hold, err := p.updateLegalHold(r.Header.Get("Mattermost-User-Id"), mux.Vars(r)["holdID"], req)
+	if errors.Is(err, errLegalHoldNotFound) {
+		http.Error(w, "Legal hold not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		p.logError("[API] Failed to update legal hold", "error", err.Error())
+		http.Error(w, "Failed to update legal hold", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// HandleDeleteLegalHold handles DELETE /api/v1/admin/legal_holds/{holdID}
+func (p *Plugin) HandleDeleteLegalHold(w http.ResponseWriter, r *http.Request) {
+	err := p.deleteLegalHold(r.Header.Get("Mattermost-User-Id"), mux.Vars(r)["holdID"])
+	if errors.Is(err, errLegalHoldNotFound) {
+		http.Error(w, "Legal hold not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		p.logError("[API] Failed to delete legal hold", "error", err.Error())
+		http.Error(w, "Failed to delete legal hold", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetLegalHoldAudit handles GET /api/v1/admin/legal_holds/audit,
+// newest change first.
+func (p *Plugin) HandleGetLegalHoldAudit(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := getPaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := p.store.GetLegalHoldAudit(page*perPage, perPage)
+	if err != nil {
+		p.logError("[API] Failed to get legal hold audit", "error", err.Error())
+		http.Error(w, "Failed to get legal hold audit", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []store.LegalHoldAudit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func decodeLegalHoldRequest(w http.ResponseWriter, r *http.Request) (LegalHoldRequest, bool) {
+	var req LegalHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// maxBatchReadMessages caps the posts accepted by one batch read request.
+const maxBatchReadMessages = 200
+
+// BatchReadRequest is the body of POST /api/v2/read/batch. Posts may be sent
+// as a flat list, grouped by channel, or both.
+type BatchReadRequest struct {
+	MessageIDs []string           `json:"message_ids"`
+	Channels   []BatchReadChannel `json:"channels"`
+}
+
+// BatchReadChannel groups message IDs that the client believes belong to ChannelID.
+type BatchReadChannel struct {
+	ChannelID  string   `json:"channel_id"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+// BatchReadResponse reports which posts were marked read. Rejected maps a
+// message ID to the reason it was skipped.
+type BatchReadResponse struct {
+	Status   string            `json:"status"`
+	Accepted []string          `json:"accepted"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// HandleBatchReadReceipt marks many posts read in one transaction, announces
+// the reader once per post and queues each author the post's updated counts.
+func (p *Plugin) HandleBatchReadReceipt(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var req BatchReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		p.logError("[API] Failed to decode batch read request", "error", err.Error())
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	// Flatten and de-duplicate, remembering the channel a client claimed
+	claimed := make(map[string]string)
+	var messageIDs []string
+	add := func(messageID, channelID string) {
+		if messageID == "" {
+			return
+		}
+		if _, seen := claimed[messageID]; !seen {
+			messageIDs = append(messageIDs, messageID)
+			claimed[messageID] = channelID
+		}
+	}
+	for _, messageID := range req.MessageIDs {
+		add(messageID, "")
+	}
+	for _, group := range req.Channels {
+		for _, messageID := range group.MessageIDs {
+			add(messageID, group.ChannelID)
+		}
+	}
+
+	if len(messageIDs) == 0 {
+		http.Error(w, "message_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(messageIDs) > maxBatchReadMessages {
+		http.Error(w, "Too many message_ids in one request", http.StatusBadRequest)
+		return
+	}
+
+	response := BatchReadResponse{Status: "ok", Accepted: []string{}, Rejected: map[string]string{}}
+	now := time.Now().UnixMilli()
+
+	var events []store.ReadEvent
+	newest := make(map[string]*model.Post) // channel ID -> newest post read
+	posts := make(map[string]*model.Post)  // message ID -> post read
+	membership := make(map[string]bool)    // channel ID -> user is a member
+	allowed := make(map[string]bool)       // channel ID -> receipts are on
+	var channelOrder []string
+	for _, messageID := range messageIDs {
+		post, appErr := p.API.GetPost(messageID)
+		if appErr != nil {
+			response.Rejected[messageID] = "post not found"
+			continue
+		}
+		if channelID := claimed[messageID]; channelID != "" && channelID != post.ChannelId {
+			response.Rejected[messageID] = "post is not in channel " + channelID
+			continue
+		}
+		member, checked := membership[post.ChannelId]
+		if !checked {
+			member = p.isChannelMember(userID, post.ChannelId)
+			membership[post.ChannelId] = member
+		}
+		if !member {
+			response.Rejected[messageID] = "not a member of the channel"
+			continue
+		}
+		enabled, checked := allowed[post.ChannelId]
+		if !checked {
+			enabled = p.receiptsAllowed(post.ChannelId)
+			allowed[post.ChannelId] = enabled
+		}
+		if !enabled {
+			response.Rejected[messageID] = "read receipts are disabled in the channel"
+			continue
+		}
+
+		events = append(events, store.ReadEvent{
+			MessageID: post.Id,
+			UserID:    userID,
+			ChannelID: post.ChannelId,
+			Timestamp: now,
+		})
+		response.Accepted = append(response.Accepted, post.Id)
+		posts[post.Id] = post
+
+		if current, ok := newest[post.ChannelId]; !ok {
+			channelOrder = append(channelOrder, post.ChannelId)
+			newest[post.ChannelId] = post
+		} else if post.CreateAt > current.CreateAt {
+			newest[post.ChannelId] = post
+		}
+	}
+
+	if len(events) > 0 {
+		if err := p.saveBatchRead(events, userID, channelOrder, newest, now); err != nil {
+			p.logError("[API] Failed to save batch read", "user_id", userID, "error", err.Error())
+			http.Error(w, "Failed to save read events", http.StatusInternalServerError)
+			return
+		}
+		// Reads of users who hide their receipts are not announced
+		if privacy := p.getBroadcastPrivacy(); privacy != nil && !privacy.isHidden(userID) {
+			for _, channelID := range channelOrder {
+				large := p.isLargeChannel(channelID)
+				added := make(map[string][]string)
+				for _, event := range events {
+					switch {
+					case event.ChannelID != channelID:
+					case large:
+						p.scheduleReadCounts(posts[event.MessageID])
+					default:
+						added[event.MessageID] = []string{userID}
+						if post := posts[event.MessageID]; post.UserId != userID {
+							p.scheduleReceiptCounts(post, userID)
+						}
+					}
+				}
+				if len(added) > 0 {
+					p.queueReaders(channelID, added)
+				}
+			}
+		}
+	}
+
+	if len(response.Rejected) == 0 {
+		response.Rejected = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// saveBatchRead writes the read events and each channel's read position in
+// a single transaction.
+func (p *Plugin) saveBatchRead(events []store.ReadEvent, userID string, channelIDs []string, newest map[string]*model.Post, now int64) error {
+	tx, err := p.store.BeginTx()
+	if err != nil {
+		return err
+	}
+	if err := p.store.UpsertBatchTx(tx, events); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, channelID := range channelIDs {
+		read := types.ChannelRead{
+			ChannelID:  channelID,
+			UserID:     userID,
+			LastPostID: newest[channelID].Id,
+			LastSeenAt: now,
+		}
+		if err := p.store.UpsertChannelReadTx(tx, read); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleBatchReadReceipt(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "other-user", ChannelID: "channel1", Timestamp: 1}))
+
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", CreateAt: 1}, nil)
+	api.On("GetPost", "post2").Return(&model.Post{Id: "post2", ChannelId: "channel1", CreateAt: 2}, nil)
+	api.On("GetPost", "post3").Return(&model.Post{Id: "post3", ChannelId: "channel2", CreateAt: 1}, nil)
+	api.On("GetPost", "missing").Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusNotFound))
+	api.On("GetChannelMember", "channel1", "reader").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "reader"}, nil).Once()
+	api.On("GetChannelMember", "channel2", "reader").Return(&model.ChannelMember{ChannelId: "channel2", UserId: "reader"}, nil).Once()
+	allowOpenChannels(api, "channel1", "channel2")
+
+	// One delta per channel, naming only the new reader
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventChannelReaders,
+		map[string]interface{}{
+			"ChannelID":    "channel1",
+			"AddedReaders": map[string]interface{}{"post1": []string{"reader"}, "post2": []string{"reader"}},
+		},
+		&model.WebsocketBroadcast{ChannelId: "channel1"},
+	).Return().Once()
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventChannelReaders,
+		map[string]interface{}{
+			"ChannelID":    "channel2",
+			"AddedReaders": map[string]interface{}{"post3": []string{"reader"}},
+		},
+		&model.WebsocketBroadcast{ChannelId: "channel2"},
+	).Return().Once()
+
+	body, _ := json.Marshal(BatchReadRequest{
+		MessageIDs: []string{"post1", "post2", "missing", "post1"},
+		Channels: []BatchReadChannel{
+			{ChannelID: "channel2", MessageIDs: []string{"post3"}},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/read/batch", bytes.NewReader(body))
+	req.Header.Set("Mattermost-User-Id", "reader")
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(nil, w, req)
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var response BatchReadResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, []string{"post1", "post2", "post3"}, response.Accepted)
+	assert.Equal(t, map[string]string{"missing": "post not found"}, response.Rejected)
+
+	events, err := p.store.GetByChannel("channel1", "other-user")
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	reads, err := p.store.GetChannelReads("channel1")
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Equal(t, "post2", reads[0].LastPostID)
+}
+
+func TestBatchReadSendsAuthorCounts(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", UserId: "author", CreateAt: 1}, nil)
+	api.On("GetPost", "own").Return(&model.Post{Id: "own", ChannelId: "channel1", UserId: "reader", CreateAt: 2}, nil)
+	api.On("GetChannelMember", "channel1", "reader").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "reader"}, nil).Once()
+	allowOpenChannels(api, "channel1")
+	api.On("PublishWebSocketEvent", WebSocketEventChannelReaders, mock.Anything, &model.WebsocketBroadcast{ChannelId: "channel1"}).Return().Once()
+	// Only the author of post1 hears about the read
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReceiptCounts,
+		map[string]interface{}{"MessageID": "post1", "ChannelID": "channel1", "DeliveredCount": 1, "ReadCount": 1},
+		&model.WebsocketBroadcast{UserId: "author"},
+	).Return().Once()
+
+	body, _ := json.Marshal(BatchReadRequest{MessageIDs: []string{"post1", "own"}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/read/batch", bytes.NewReader(body))
+	req.Header.Set("Mattermost-User-Id", "reader")
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(nil, w, req)
+	sendReceiptCounts(p)
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleBatchReadReceiptValidation(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1"}, nil)
+	api.On("GetPost", "post2").Return(&model.Post{Id: "post2", ChannelId: "private"}, nil)
+	api.On("GetChannelMember", "private", "reader").Return(nil, model.NewAppError("GetChannelMember", "app.channel.get_member.missing.app_error", nil, "", http.StatusNotFound))
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/read/batch", bytes.NewReader([]byte(body)))
+		req.Header.Set("Mattermost-User-Id", "reader")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serve(`{`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(`{"message_ids":[]}`).Code)
+
+	tooMany := BatchReadRequest{}
+	for i := 0; i <= maxBatchReadMessages; i++ {
+		tooMany.MessageIDs = append(tooMany.MessageIDs, model.NewId())
+	}
+	body, _ := json.Marshal(tooMany)
+	assert.Equal(t, http.StatusBadRequest, serve(string(body)).Code)
+
+	// A post claimed for the wrong channel is rejected, not written
+	w := serve(`{"channels":[{"channel_id":"channel2","message_ids":["post1"]}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response BatchReadResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Empty(t, response.Accepted)
+	assert.Contains(t, response.Rejected, "post1")
+
+	// Posts in channels the user is not a member of are rejected as well
+	w = serve(`{"message_ids":["post2"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	response = BatchReadResponse{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Empty(t, response.Accepted)
+	assert.Equal(t, "not a member of the channel", response.Rejected["post2"])
+
+	for _, channelID := range []string{"channel1", "private"} {
+		events, err := p.store.GetByChannel(channelID, "")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	}
+}
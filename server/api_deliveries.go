@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// receiptCountsInterval is how often at most a post's author is sent its
+// counts.
+const receiptCountsInterval = 2 * time.Second
+
+// DeliveredRequest is the body of POST /api/v2/delivered.
+type DeliveredRequest struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+// PostReceiptCounts is a post's two receipt states. Reading a post implies
+// it was delivered, so ReadCount never exceeds DeliveredCount. The author
+// is not counted.
+type PostReceiptCounts struct {
+	PostID         string `json:"post_id"`
+	DeliveredCount int    `json:"delivered_count"`
+	ReadCount      int    `json:"read_count"`
+}
+
+// HandleDelivered records that posts reached the user's client and queues
+// each author the post's updated counts. Acks for the user's own posts are
+// rejected.
+func (p *Plugin) HandleDelivered(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var req DeliveredRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		p.logError("[API] Failed to decode delivered request", "error", err.Error())
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len(req.MessageIDs) == 0 {
+		http.Error(w, "message_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.MessageIDs) > maxBatchReadMessages {
+		http.Error(w, "Too many message_ids in one request", http.StatusBadRequest)
+		return
+	}
+
+	response := BatchReadResponse{Status: "ok", Accepted: []string{}, Rejected: map[string]string{}}
+	now := time.Now().UnixMilli()
+
+	var events []store.DeliveryEvent
+	var posts []*model.Post
+	seen := make(map[string]bool)
+	membership := make(map[string]bool) // channel ID -> user is a member
+	allowed := make(map[string]bool)    // channel ID -> receipts are on
+	for _, messageID := range req.MessageIDs {
+		if messageID == "" || seen[messageID] {
+			continue
+		}
+		seen[messageID] = true
+
+		post, appErr := p.API.GetPost(messageID)
+		if appErr != nil {
+			response.Rejected[messageID] = "post not found"
+			continue
+		}
+		if post.UserId == userID {
+			response.Rejected[messageID] = "own post"
+			continue
+		}
+		member, checked := membership[post.ChannelId]
+		if !checked {
+			member = p.isChannelMember(userID, post.ChannelId)
+			membership[post.ChannelId] = member
+		}
+		if !member {
+			response.Rejected[messageID] = "not a member of the channel"
+			continue
+		}
+		enabled, checked := allowed[post.ChannelId]
+		if !checked {
+			enabled = p.receiptsAllowed(post.ChannelId)
+			allowed[post.ChannelId] = enabled
+		}
+		if !enabled {
+			response.Rejected[messageID] = "read receipts are disabled in the channel"
+			continue
+		}
+
+		events = append(events, store.DeliveryEvent{
+			MessageID:   post.Id,
+			UserID:      userID,
+			ChannelID:   post.ChannelId,
+			DeliveredAt: now,
+		})
+		posts = append(posts, post)
+		response.Accepted = append(response.Accepted, post.Id)
+	}
+
+	if len(events) > 0 {
+		if err := p.store.SaveDeliveries(events); err != nil {
+			p.logError("[API] Failed to save deliveries", "user_id", userID, "error", err.Error())
+			http.Error(w, "Failed to save deliveries", http.StatusInternalServerError)
+			return
+		}
+		for _, post := range posts {
+			if p.isLargeChannel(post.ChannelId) {
+				p.scheduleReadCounts(post)
+				continue
+			}
+			p.scheduleReceiptCounts(post)
+		}
+	}
+
+	if len(response.Rejected) == 0 {
+		response.Rejected = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetPostReceipts handles GET /api/v2/posts/{postID}/receipts
+func (p *Plugin) HandleGetPostReceipts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	post := p.getReceiptPost(w, r)
+	if post == nil {
+		return
+	}
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+
+	p.refreshInferredReads(post.ChannelId)
+	counts, err := p.getPostReceiptCounts(post, privacy, userID)
+	if err != nil {
+		p.logError("[API] Failed to get receipt counts", "post_id", post.Id, "error", err.Error())
+		http.Error(w, "Failed to get receipt counts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(counts); err != nil {
+		p.logError("[API] Error encoding receipt counts", "post_id", post.Id, "error", err.Error())
+	}
+}
+
+// getPostReceiptCounts counts the users a post was delivered to and the
+// users who read it, as far as viewerID may see them. extraReaders are
+// counted as readers too, for reads that may still sit in the write queue.
+func (p *Plugin) getPostReceiptCounts(post *model.Post, privacy *readPrivacy, viewerID string, extraReaders ...string) (*PostReceiptCounts, error) {
+	readerIDs, err := p.store.GetPostReaderIDs(post.Id, post.ChannelId, post.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	deliveredIDs, err := p.store.GetDeliveredUserIDs(post.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	read := make(map[string]bool)
+	for _, userID := range append(readerIDs, extraReaders...) {
+		if userID != post.UserId && privacy.visibleTo(viewerID, userID) {
+			read[userID] = true
+		}
+	}
+	delivered := make(map[string]bool, len(read))
+	for userID := range read {
+		delivered[userID] = true
+	}
+	for _, userID := range deliveredIDs {
+		if userID != post.UserId && privacy.visibleTo(viewerID, userID) {
+			delivered[userID] = true
+		}
+	}
+
+	return &PostReceiptCounts{
+		PostID:         post.Id,
+		DeliveredCount: len(delivered),
+		ReadCount:      len(read),
+	}, nil
+}
+
+// publishPostReceiptCounts sends a post's author its current counts, unless
+// the author may not see others' receipts.
+func (p *Plugin) publishPostReceiptCounts(post *model.Post, privacy *readPrivacy, extraReaders ...string) {
+	if privacy.isBlind(post.UserId) {
+		return
+	}
+	counts, err := p.getPostReceiptCounts(post, privacy, post.UserId, extraReaders...)
+	if err != nil {
+		p.logError("[API] Failed to get receipt counts", "post_id", post.Id, "error", err.Error())
+		return
+	}
+	p.PublishReceiptCounts(post.UserId, post.ChannelId, counts)
+}
+
+// scheduleReceiptCounts queues a counts event for post's author.
+// extraReaders are counted as readers when it is sent.
+func (p *Plugin) scheduleReceiptCounts(post *model.Post, extraReaders ...string) {
+	p.receiptCounts.schedule(post.Id, extraReaders, func(extraReaders []string) {
+		privacy := p.getBroadcastPrivacy()
+		if privacy == nil {
+			return
+		}
+		p.publishPostReceiptCounts(post, privacy, extraReaders...)
+	})
+}
+
+// receiptCountThrottle sends a post's author its counts at most once per
+// receiptCountsInterval. In a channel of N members a new post is delivered
+// N times, and the author gets one event per interval rather than one per
+// delivery or read. Readers whose reads may still sit in the write queue
+// are collected until the event is sent.
+type receiptCountThrottle struct {
+	clock clock // nil means realClock
+
+	mu      sync.Mutex
+	pending map[string]*pendingReceiptCounts // post ID -> scheduled event
+}
+
+type pendingReceiptCounts struct {
+	timer        timer
+	extraReaders []string
+}
+
+// schedule runs publish after the interval unless an event is already
+// pending for postID, in which case extraReaders join it.
+func (t *receiptCountThrottle) schedule(postID string, extraReaders []string, publish func(extraReaders []string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pending, ok := t.pending[postID]; ok {
+		pending.extraReaders = append(pending.extraReaders, extraReaders...)
+		return
+	}
+	if t.pending == nil {
+		t.pending = make(map[string]*pendingReceiptCounts)
+	}
+	c := t.clock
+	if c == nil {
+		c = realClock{}
+	}
+	pending := &pendingReceiptCounts{extraReaders: append([]string(nil), extraReaders...)}
+	pending.timer = c.AfterFunc(receiptCountsInterval, func() {
+		t.mu.Lock()
+		delete(t.pending, postID)
+		t.mu.Unlock()
+		publish(pending.extraReaders)
+	})
+	t.pending[postID] = pending
+}
+
+// stop drops the pending events.
+func (t *receiptCountThrottle) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, pending := range t.pending {
+		pending.timer.Stop()
+	}
+	t.pending = nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleDelivered(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author", CreateAt: 100}
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "reader", ChannelID: "channel1", Timestamp: 200}))
+
+	api.On("GetPost", "post1").Return(post, nil)
+	api.On("GetPost", "own").Return(&model.Post{Id: "own", ChannelId: "channel1", UserId: "recipient"}, nil)
+	api.On("GetPost", "private").Return(&model.Post{Id: "private", ChannelId: "channel2", UserId: "author"}, nil)
+	api.On("GetChannelMember", "channel1", "recipient").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "recipient"}, nil).Once()
+	api.On("GetChannelMember", "channel2", "recipient").Return(nil, model.NewAppError("GetChannelMember", "app.channel.get_member.missing.app_error", nil, "", http.StatusNotFound)).Once()
+	allowOpenChannels(api, "channel1")
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReceiptCounts,
+		map[string]interface{}{"MessageID": "post1", "ChannelID": "channel1", "DeliveredCount": 2, "ReadCount": 1},
+		&model.WebsocketBroadcast{UserId: "author"},
+	).Return().Once()
+
+	body, _ := json.Marshal(DeliveredRequest{MessageIDs: []string{"post1", "own", "private", "post1"}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/delivered", bytes.NewReader(body))
+	req.Header.Set("Mattermost-User-Id", "recipient")
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(nil, w, req)
+	sendReceiptCounts(p)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response BatchReadResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, []string{"post1"}, response.Accepted)
+	assert.Equal(t, map[string]string{"own": "own post", "private": "not a member of the channel"}, response.Rejected)
+
+	userIDs, err := p.store.GetDeliveredUserIDs("post1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recipient"}, userIDs)
+}
+
+func TestReceiptCountThrottle(t *testing.T) {
+	clock := &fakeClock{}
+	throttle := receiptCountThrottle{clock: clock}
+	published := map[string][][]string{}
+	schedule := func(postID string, extraReaders ...string) {
+		throttle.schedule(postID, extraReaders, func(extraReaders []string) {
+			published[postID] = append(published[postID], extraReaders)
+		})
+	}
+
+	schedule("post1")
+	schedule("post1", "reader1")
+	schedule("post2", "reader2")
+	schedule("post1", "reader3")
+	clock.Advance(receiptCountsInterval - time.Millisecond)
+	assert.Empty(t, published)
+
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, map[string][][]string{
+		"post1": {{"reader1", "reader3"}},
+		"post2": {{"reader2"}},
+	}, published)
+
+	// The next delivery starts a new interval
+	schedule("post1")
+	clock.Advance(receiptCountsInterval)
+	assert.Len(t, published["post1"], 2)
+
+	schedule("post1")
+	throttle.stop()
+	clock.Advance(receiptCountsInterval)
+	assert.Len(t, published["post1"], 2)
+}
+
+func TestHandleGetPostReceipts(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", UserId: "author", CreateAt: 100}, nil)
+	api.On("HasPermissionToChannel", "author", "channel1", model.PermissionReadChannel).Return(true)
+	allowOpenChannels(api, "channel1")
+
+	require.NoError(t, p.store.SaveDeliveries([]store.DeliveryEvent{
+		{MessageID: "post1", UserID: "online", ChannelID: "channel1", DeliveredAt: 150},
+		{MessageID: "post1", UserID: "reader", ChannelID: "channel1", DeliveredAt: 150},
+	}))
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "reader", ChannelID: "channel1", Timestamp: 200}))
+	// Read without a delivery ack, e.g. from a client without the plugin
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "mobile", "", 300))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "author", "post1", 300))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/posts/post1/receipts", nil)
+	req.Header.Set("Mattermost-User-Id", "author")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var counts PostReceiptCounts
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&counts))
+	assert.Equal(t, PostReceiptCounts{PostID: "post1", DeliveredCount: 3, ReadCount: 2}, counts)
+}
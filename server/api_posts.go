@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	defaultPerPage = 60
+	maxPerPage     = 200
+
+	// unreadListLimit caps the user IDs returned by the unread endpoint; the
+	// counts always cover the whole channel.
+	unreadListLimit = 1000
+)
+
+// PostReader is one reader of a post. Readers inferred from a later channel
+// read have source "inferred" and the channel read's time.
+type PostReader struct {
+	UserID string `json:"user_id"`
+	ReadAt int64  `json:"read_at"`
+	Source string `json:"source"`
+}
+
+// PostReadersResponse is one page of a post's readers, newest read first.
+type PostReadersResponse struct {
+	PostID  string       `json:"post_id"`
+	Readers []PostReader `json:"readers"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+	HasMore bool         `json:"has_more"`
+}
+
+// PostUnreadResponse lists the channel members who have not seen a post.
+// Bots, deactivated users and the post's author are not counted.
+type PostUnreadResponse struct {
+	PostID      string   `json:"post_id"`
+	MemberCount int      `json:"member_count"`
+	ReadCount   int      `json:"read_count"`
+	UnreadCount int      `json:"unread_count"`
+	Unread      []string `json:"unread"` // null with counts_only
+	Truncated   bool     `json:"truncated,omitempty"`
+}
+
+// getPaging reads Mattermost-style ?page=&per_page= parameters.
+func getPaging(r *http.Request) (page, perPage int, err error) {
+	query := r.URL.Query()
+	page, perPage = 0, defaultPerPage
+
+	if value := query.Get("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page < 0 {
+			return 0, 0, fmt.Errorf("invalid page parameter")
+		}
+	}
+	if value := query.Get("per_page"); value != "" {
+		if perPage, err = strconv.Atoi(value); err != nil || perPage <= 0 {
+			return 0, 0, fmt.Errorf("invalid per_page parameter")
+		}
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage, nil
+}
+
+// getReadablePost loads the post named by the route and checks that the
+// user may read its channel. It writes the error response and returns nil
+// when the request cannot proceed.
+func (p *Plugin) getReadablePost(w http.ResponseWriter, r *http.Request) *model.Post {
+	userID := r.Header.Get("Mattermost-User-Id")
+	postID := mux.Vars(r)["postID"]
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return nil
+	}
+	if !p.canReadChannel(userID, post.ChannelId) {
+		// Same answer as a missing post, so post IDs cannot be probed
+		p.logError("[API] Forbidden post access", "post_id", postID, "user_id", userID)
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return nil
+	}
+	return post
+}
+
+// getReceiptPost is getReadablePost for the receipt endpoints, which also
+// need receipts to be on in the post's channel.
+func (p *Plugin) getReceiptPost(w http.ResponseWriter, r *http.Request) *model.Post {
+	post := p.getReadablePost(w, r)
+	if post == nil || !p.requireReceiptsEnabled(w, post.ChannelId) {
+		return nil
+	}
+	return post
+}
+
+// HandleGetPostReaders handles GET /api/v2/posts/{postID}/readers. Like the
+// unread endpoint, it counts everyone whose channel read is not older than
+// the post as a reader. Readers hidden from the user are dropped after
+// paging, so a page may come back short. In large channels only the author
+// and system admins may list them.
+func (p *Plugin) HandleGetPostReaders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	page, perPage, err := getPaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post := p.getReceiptPost(w, r)
+	if post == nil {
+		return
+	}
+	if p.isLargeChannel(post.ChannelId) && !p.canListPostReaders(userID, post) {
+		http.Error(w, "Only the author can list the readers of a post in a large channel", http.StatusForbidden)
+		return
+	}
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+
+	p.refreshInferredReads(post.ChannelId)
+	// Fetch one extra row to learn whether another page exists
+	reads, err := p.store.GetPostReaders(post.Id, post.ChannelId, post.CreateAt, page*perPage, perPage+1)
+	if err != nil {
+		p.logError("[API] Failed to get post readers", "post_id", post.Id, "error", err.Error())
+		http.Error(w, "Failed to get readers", http.StatusInternalServerError)
+		return
+	}
+
+	response := PostReadersResponse{
+		PostID:  post.Id,
+		Readers: []PostReader{},
+		Page:    page,
+		PerPage: perPage,
+	}
+	if len(reads) > perPage {
+		response.HasMore = true
+		reads = reads[:perPage]
+	}
+	for _, read := range reads {
+		if privacy.visibleTo(userID, read.UserID) {
+			response.Readers = append(response.Readers, PostReader{UserID: read.UserID, ReadAt: read.ReadAt, Source: read.Source})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.logError("[API] Error encoding post readers", "post_id", post.Id, "error", err.Error())
+	}
+}
+
+// HandleGetPostUnread handles GET /api/v2/posts/{postID}/unread. With
+// ?counts_only=true only the counts are returned, as they always are in large
+// channels for anyone but the author and system admins.
+func (p *Plugin) HandleGetPostUnread(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	countsOnly := r.URL.Query().Get("counts_only") == "true"
+
+	post := p.getReceiptPost(w, r)
+	if post == nil {
+		return
+	}
+	if !countsOnly && p.isLargeChannel(post.ChannelId) {
+		countsOnly = !p.canListPostReaders(userID, post)
+	}
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+
+	response, err := p.getPostUnread(post, privacy, userID, countsOnly)
+	if err != nil {
+		p.logError("[API] Failed to get unread members", "post_id", post.Id, "error", err.Error())
+		http.Error(w, "Failed to get unread members", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.logError("[API] Error encoding unread members", "post_id", post.Id, "error", err.Error())
+	}
+}
+
+// getPostUnread splits the channel's members into readers and non-readers
+// of post. A member has read the post when they have a read event for it or
+// their channel read is not older than the post. Readers whose receipts
+// viewerID may not see are listed as unread.
+func (p *Plugin) getPostUnread(post *model.Post, privacy *readPrivacy, viewerID string, countsOnly bool) (*PostUnreadResponse, error) {
+	p.refreshInferredReads(post.ChannelId)
+	readerIDs, err := p.store.GetPostReaderIDs(post.Id, post.ChannelId, post.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	read := make(map[string]bool, len(readerIDs))
+	for _, userID := range privacy.filterUserIDs(viewerID, readerIDs) {
+		read[userID] = true
+	}
+
+	response := &PostUnreadResponse{PostID: post.Id}
+	if !countsOnly {
+		response.Unread = []string{}
+	}
+	err = p.forEachCountedMember(post, func(userID string) {
+		response.MemberCount++
+		if read[userID] {
+			response.ReadCount++
+			return
+		}
+		response.UnreadCount++
+		if countsOnly {
+			return
+		}
+		if len(response.Unread) < unreadListLimit {
+			response.Unread = append(response.Unread, userID)
+		} else {
+			response.Truncated = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// forEachCountedMember walks the members of post's channel page by page and
+// calls fn for everyone but bots, deactivated users and the author.
+// GetUsersInChannel is used rather than GetChannelMembers because it returns
+// the user records needed to skip bots and deactivated accounts.
+func (p *Plugin) forEachCountedMember(post *model.Post, fn func(userID string)) error {
+	for page := 0; ; page++ {
+		users, appErr := p.API.GetUsersInChannel(post.ChannelId, "username", page, maxPerPage)
+		if appErr != nil {
+			return appErr
+		}
+
+		for _, user := range users {
+			if user.IsBot || user.DeleteAt != 0 || user.Id == post.UserId {
+				continue
+			}
+			fn(user.Id)
+		}
+
+		if len(users) < maxPerPage {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetPostReaders(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", CreateAt: 50}, nil)
+	api.On("HasPermissionToChannel", "member", "channel1", model.PermissionReadChannel).Return(true)
+	api.On("HasPermissionToChannel", "outsider", "channel1", model.PermissionReadChannel).Return(false)
+	allowOpenChannels(api, "channel1")
+
+	for i, userID := range []string{"user1", "user2", "user3"} {
+		require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: userID, ChannelID: "channel1", Timestamp: int64(100 + i)}))
+	}
+	// mobile viewed the channel after the post; early viewed it before
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "mobile", "", 200))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "early", "", 40))
+
+	get := func(userID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/posts/post1/readers"+query, nil)
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w
+	}
+
+	w := get("member", "?per_page=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response PostReadersResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, []PostReader{
+		{UserID: "mobile", ReadAt: 200, Source: types.ReadSourceInferred},
+		{UserID: "user3", ReadAt: 102, Source: types.ReadSourceClient},
+	}, response.Readers)
+	assert.True(t, response.HasMore)
+
+	w = get("member", "?page=1&per_page=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	response = PostReadersResponse{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, []PostReader{
+		{UserID: "user2", ReadAt: 101, Source: types.ReadSourceClient},
+		{UserID: "user1", ReadAt: 100, Source: types.ReadSourceClient},
+	}, response.Readers)
+	assert.False(t, response.HasMore)
+
+	assert.Equal(t, http.StatusBadRequest, get("member", "?page=-1").Code)
+	assert.Equal(t, http.StatusNotFound, get("outsider", "").Code)
+}
+
+func TestHandleGetPostUnread(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author", CreateAt: 1000}
+	api.On("GetPost", "post1").Return(post, nil)
+	api.On("HasPermissionToChannel", "author", "channel1", model.PermissionReadChannel).Return(true)
+	allowOpenChannels(api, "channel1")
+
+	// A full first page forces a second request
+	firstPage := []*model.User{
+		{Id: "author"},
+		{Id: "read-event"},
+		{Id: "channel-read"},
+		{Id: "stale-channel-read"},
+		{Id: "bot", IsBot: true},
+		{Id: "deactivated", DeleteAt: 1},
+	}
+	for len(firstPage) < maxPerPage {
+		firstPage = append(firstPage, &model.User{Id: "bot" + model.NewId(), IsBot: true})
+	}
+	api.On("GetUsersInChannel", "channel1", "username", 0, maxPerPage).Return(firstPage, nil)
+	api.On("GetUsersInChannel", "channel1", "username", 1, maxPerPage).Return([]*model.User{{Id: "unread"}}, nil)
+
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "read-event", ChannelID: "channel1", Timestamp: 2000}))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "channel-read", "post1", 1000))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "stale-channel-read", "post0", 999))
+
+	get := func(query string) PostUnreadResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/posts/post1/unread"+query, nil)
+		req.Header.Set("Mattermost-User-Id", "author")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response PostUnreadResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+
+	response := get("")
+	assert.Equal(t, PostUnreadResponse{
+		PostID:      "post1",
+		MemberCount: 4,
+		ReadCount:   2,
+		UnreadCount: 2,
+		Unread:      []string{"stale-channel-read", "unread"},
+	}, response)
+
+	response = get("?counts_only=true")
+	assert.Nil(t, response.Unread)
+	assert.Equal(t, 2, response.UnreadCount)
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/arg/mattermost-readreceipts/server/types"
+)
+
+// errWriteQueueFull is returned by Enqueue when the queue is at capacity and
+// the event does not coalesce with one already pending.
+var errWriteQueueFull = errors.New("read event queue is full")
+
+const (
+	defaultWriteBatchSize       = 100
+	defaultWriteFlushIntervalMs = 1000
+	defaultWriteQueueCapacity   = 10000
+
+	// maxWriteAttempts is how many failed flushes an event survives before
+	// it is dropped, so one that can never be written does not fill the
+	// queue.
+	maxWriteAttempts = 5
+)
+
+// WriteQueueMetrics is a point-in-time snapshot of the write queue.
+type WriteQueueMetrics struct {
+	Pending             int    `json:"pending"`
+	Capacity            int    `json:"capacity"`
+	Enqueued            uint64 `json:"enqueued"`
+	Coalesced           uint64 `json:"coalesced"`
+	Rejected            uint64 `json:"rejected"`
+	Flushes             uint64 `json:"flushes"`
+	FlushedEvents       uint64 `json:"flushed_events"`
+	FailedFlushes       uint64 `json:"failed_flushes"`
+	DroppedEvents       uint64 `json:"dropped_events"`
+	LastFlushDurationMs int64  `json:"last_flush_duration_ms"`
+	LastFlushAt         int64  `json:"last_flush_at"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+type batchKey struct {
+	messageID string
+	userID    string
+}
+
+type channelUserKey struct {
+	channelID string
+	userID    string
+}
+
+// readEventBatcher is a write-behind queue for read events. Events for the
+// same (message, user) pair are coalesced while pending, and the queue is
+// flushed as multi-row upserts in a single transaction once it holds
+// batchSize events or flushInterval has passed, whichever comes first.
+type readEventBatcher struct {
+	store         store.ReceiptStore
+	batchSize     int
+	capacity      int
+	flushInterval time.Duration
+	logError      func(msg string, kv ...interface{})
+
+	mu       sync.Mutex
+	pending  map[batchKey]store.ReadEvent
+	order    []batchKey       // flush in arrival order
+	attempts map[batchKey]int // failed flushes of each pending event
+	metrics  WriteQueueMetrics
+
+	flushMu sync.Mutex // serialises flushes
+	kick    chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	started bool
+	stopped bool
+}
+
+// newReadEventBatcher returns a batcher for s. Non-positive settings fall
+// back to the defaults.
+func newReadEventBatcher(s store.ReceiptStore, batchSize int, flushInterval time.Duration, capacity int) *readEventBatcher {
+	if batchSize <= 0 {
+		batchSize = defaultWriteBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultWriteFlushIntervalMs * time.Millisecond
+	}
+	if capacity <= 0 {
+		capacity = defaultWriteQueueCapacity
+	}
+	if capacity < batchSize {
+		capacity = batchSize
+	}
+
+	return &readEventBatcher{
+		store:         s,
+		batchSize:     batchSize,
+		capacity:      capacity,
+		flushInterval: flushInterval,
+		logError:      func(string, ...interface{}) {},
+		pending:       make(map[batchKey]store.ReadEvent),
+		attempts:      make(map[batchKey]int),
+		metrics:       WriteQueueMetrics{Capacity: capacity},
+		kick:          make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+}
+
+// Start runs the background flush loop until Stop is called.
+func (b *readEventBatcher) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started || b.stopped {
+		return
+	}
+	b.started = true
+	go b.run()
+}
+
+func (b *readEventBatcher) run() {
+	defer close(b.doneCh)
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-ticker.C:
+		case <-b.kick:
+		}
+		if err := b.Flush(); err != nil {
+			b.logError("[Batcher] Failed to flush read events", "error", err.Error())
+		}
+	}
+}
+
+// Enqueue queues event for the next flush. It fails with errWriteQueueFull
+// when the queue is at capacity, so callers can push back on clients.
+func (b *readEventBatcher) Enqueue(event store.ReadEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped {
+		return errors.New("read event queue is stopped")
+	}
+
+	key := batchKey{messageID: event.MessageID, userID: event.UserID}
+	if existing, ok := b.pending[key]; ok {
+		b.pending[key] = mergeReadEvents(existing, event)
+		b.metrics.Enqueued++
+		b.metrics.Coalesced++
+		return nil
+	}
+
+	if len(b.pending) >= b.capacity {
+		b.metrics.Rejected++
+		return errWriteQueueFull
+	}
+
+	b.pending[key] = event
+	b.order = append(b.order, key)
+	b.metrics.Enqueued++
+
+	if len(b.pending) >= b.batchSize {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush writes every pending event in one transaction. When that fails the
+// batch is split to write what it can; the events that still fail are put
+// back for the next flush, and dropped after maxWriteAttempts.
+func (b *readEventBatcher) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	events := b.take()
+	if len(events) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	failed, err := b.writeIsolating(events)
+	elapsed := time.Since(start)
+
+	b.mu.Lock()
+	b.metrics.LastFlushDurationMs = elapsed.Milliseconds()
+	b.metrics.LastFlushAt = start.UnixMilli()
+	b.metrics.FlushedEvents += uint64(len(events) - len(failed))
+	written := make(map[batchKey]bool, len(events))
+	for _, event := range events {
+		written[batchKey{messageID: event.MessageID, userID: event.UserID}] = true
+	}
+	var dropped []store.ReadEvent
+	if err != nil {
+		b.metrics.FailedFlushes++
+		b.metrics.LastError = err.Error()
+		for _, event := range failed {
+			delete(written, batchKey{messageID: event.MessageID, userID: event.UserID})
+		}
+		dropped = b.requeue(failed)
+	} else {
+		b.metrics.Flushes++
+		b.metrics.LastError = ""
+	}
+	for key := range written {
+		delete(b.attempts, key)
+	}
+	b.mu.Unlock()
+
+	for _, event := range dropped {
+		b.logError("[Batcher] Dropped read event after repeated write failures",
+			"message_id", event.MessageID, "user_id", event.UserID, "attempts", maxWriteAttempts)
+	}
+	return err
+}
+
+func (b *readEventBatcher) write(events []store.ReadEvent) error {
+	return writeReadEvents(b.store, events)
+}
+
+// writeIsolating writes events and returns those it could not write.
+func (b *readEventBatcher) writeIsolating(events []store.ReadEvent) ([]store.ReadEvent, error) {
+	if err := b.write(events); err != nil {
+		return b.isolate(events, err)
+	}
+	return nil, nil
+}
+
+// isolate splits events, which failed with err, in halves until the events
+// that fail are found. When both halves fail the store itself is likely
+// down, so the whole part is given up on rather than split further.
+func (b *readEventBatcher) isolate(events []store.ReadEvent, err error) ([]store.ReadEvent, error) {
+	if len(events) == 1 {
+		return events, err
+	}
+
+	left, right := events[:len(events)/2], events[len(events)/2:]
+	leftErr, rightErr := b.write(left), b.write(right)
+	switch {
+	case leftErr != nil && rightErr != nil:
+		return events, leftErr
+	case leftErr != nil:
+		return b.isolate(left, leftErr)
+	case rightErr != nil:
+		return b.isolate(right, rightErr)
+	default:
+		return nil, nil
+	}
+}
+
+// writeReadEvents upserts events together with each reader's channel read in
+// one transaction, so "Seen by" and the per-post receipts never disagree.
+func writeReadEvents(s store.ReceiptStore, events []store.ReadEvent) error {
+	tx, err := s.BeginTx()
+	if err != nil {
+		return err
+	}
+	if err := s.UpsertBatchTx(tx, events); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, read := range channelReadsOf(events) {
+		if err := s.UpsertChannelReadTx(tx, read); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit read event batch: %w", err)
+	}
+	return nil
+}
+
+// channelReadsOf returns the newest read of each (channel, user) pair in
+// events. Events without a channel are skipped.
+func channelReadsOf(events []store.ReadEvent) []types.ChannelRead {
+	var reads []types.ChannelRead
+	index := make(map[channelUserKey]int)
+	for _, event := range events {
+		if event.ChannelID == "" {
+			continue
+		}
+		read := types.ChannelRead{
+			ChannelID:  event.ChannelID,
+			UserID:     event.UserID,
+			LastPostID: event.MessageID,
+			LastSeenAt: event.Timestamp,
+		}
+		key := channelUserKey{channelID: event.ChannelID, userID: event.UserID}
+		i, ok := index[key]
+		switch {
+		case !ok:
+			index[key] = len(reads)
+			reads = append(reads, read)
+		case read.LastSeenAt > reads[i].LastSeenAt:
+			reads[i] = read
+		}
+	}
+	return reads
+}
+
+// take empties the queue and returns its events in arrival order.
+func (b *readEventBatcher) take() []store.ReadEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make([]store.ReadEvent, 0, len(b.order))
+	for _, key := range b.order {
+		events = append(events, b.pending[key])
+	}
+	b.pending = make(map[batchKey]store.ReadEvent)
+	b.order = nil
+	return events
+}
+
+// requeue puts failed events back in front of anything queued since, merging
+// with newer events for the same pair, and returns those that have used up
+// their attempts instead. Must be called with b.mu held.
+func (b *readEventBatcher) requeue(events []store.ReadEvent) []store.ReadEvent {
+	var dropped []store.ReadEvent
+	order := make([]batchKey, 0, len(events)+len(b.order))
+	for _, event := range events {
+		key := batchKey{messageID: event.MessageID, userID: event.UserID}
+		b.attempts[key]++
+		if b.attempts[key] >= maxWriteAttempts {
+			delete(b.attempts, key)
+			b.metrics.DroppedEvents++
+			dropped = append(dropped, event)
+			continue
+		}
+		if newer, ok := b.pending[key]; ok {
+			b.pending[key] = mergeReadEvents(event, newer)
+			continue
+		}
+		b.pending[key] = event
+		order = append(order, key)
+	}
+	b.order = append(order, b.order...)
+	return dropped
+}
+
+// Stop ends the flush loop and drains the queue. Enqueue fails afterwards.
+func (b *readEventBatcher) Stop() error {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return nil
+	}
+	b.stopped = true
+	started := b.started
+	b.mu.Unlock()
+
+	close(b.stopCh)
+	if started {
+		<-b.doneCh
+	}
+	return b.Flush()
+}
+
+// Metrics returns a snapshot of the queue counters.
+func (b *readEventBatcher) Metrics() WriteQueueMetrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	metrics := b.metrics
+	metrics.Pending = len(b.pending)
+	return metrics
+}
+
+// mergeReadEvents combines two events for the same pair the way the
+// store upsert does: the newest timestamp wins and a known channel is kept.
+func mergeReadEvents(existing, event store.ReadEvent) store.ReadEvent {
+	if event.ChannelID != "" {
+		existing.ChannelID = event.ChannelID
+	}
+	if event.Timestamp > existing.Timestamp {
+		existing.Timestamp = event.Timestamp
+	}
+	return existing
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore fails every transaction while fail is set, and every batch
+// holding a read of poison.
+type failingStore struct {
+	*store.MemoryStore
+	fail   bool
+	poison string
+}
+
+func (s *failingStore) BeginTx() (store.Tx, error) {
+	if s.fail {
+		return nil, errors.New("database unavailable")
+	}
+	return s.MemoryStore.BeginTx()
+}
+
+func (s *failingStore) UpsertBatchTx(tx store.Tx, events []store.ReadEvent) error {
+	for _, event := range events {
+		if event.MessageID == s.poison {
+			return errors.New("value too long")
+		}
+	}
+	return s.MemoryStore.UpsertBatchTx(tx, events)
+}
+
+func TestReadEventBatcherCoalesces(t *testing.T) {
+	s := store.NewMemoryStore()
+	b := newReadEventBatcher(s, 10, time.Hour, 100)
+
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 2}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 3}))
+
+	metrics := b.Metrics()
+	assert.Equal(t, 2, metrics.Pending)
+	assert.EqualValues(t, 3, metrics.Enqueued)
+	assert.EqualValues(t, 1, metrics.Coalesced)
+
+	require.NoError(t, b.Flush())
+
+	events, err := s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, store.ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 3}, events[0])
+	assert.Equal(t, store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 2}, events[1])
+
+	metrics = b.Metrics()
+	assert.Zero(t, metrics.Pending)
+	assert.EqualValues(t, 1, metrics.Flushes)
+	assert.EqualValues(t, 2, metrics.FlushedEvents)
+}
+
+func TestReadEventBatcherWritesChannelReads(t *testing.T) {
+	s := store.NewMemoryStore()
+	b := newReadEventBatcher(s, 10, time.Hour, 100)
+
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: 2}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 3}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg3", UserID: "user1", Timestamp: 4}))
+	require.NoError(t, b.Flush())
+
+	reads, err := s.GetChannelReads("channel1")
+	require.NoError(t, err)
+	assert.Equal(t, []types.ChannelRead{
+		{ChannelID: "channel1", UserID: "user2", LastPostID: "msg1", LastSeenAt: 3, Source: types.ReadSourceClient},
+		{ChannelID: "channel1", UserID: "user1", LastPostID: "msg2", LastSeenAt: 2, Source: types.ReadSourceClient},
+	}, reads)
+}
+
+func TestReadEventBatcherFlushTriggers(t *testing.T) {
+	t.Run("batch size", func(t *testing.T) {
+		s := store.NewMemoryStore()
+		b := newReadEventBatcher(s, 2, time.Hour, 100)
+		b.Start()
+		t.Cleanup(func() { b.Stop() })
+
+		require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+		require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 1}))
+
+		require.Eventually(t, func() bool {
+			events, err := s.GetByChannel("channel1", "")
+			return err == nil && len(events) == 2
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		s := store.NewMemoryStore()
+		b := newReadEventBatcher(s, 100, 10*time.Millisecond, 100)
+		b.Start()
+		t.Cleanup(func() { b.Stop() })
+
+		require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+
+		require.Eventually(t, func() bool {
+			events, err := s.GetByChannel("channel1", "")
+			return err == nil && len(events) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestReadEventBatcherStopDrains(t *testing.T) {
+	s := store.NewMemoryStore()
+	b := newReadEventBatcher(s, 100, time.Hour, 100)
+	b.Start()
+
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.NoError(t, b.Stop())
+
+	events, err := s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	assert.Error(t, b.Enqueue(store.ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	assert.NoError(t, b.Stop())
+}
+
+func TestReadEventBatcherBackpressure(t *testing.T) {
+	b := newReadEventBatcher(store.NewMemoryStore(), 2, time.Hour, 2)
+
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", Timestamp: 1}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user2", Timestamp: 1}))
+
+	err := b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user3", Timestamp: 1})
+	assert.ErrorIs(t, err, errWriteQueueFull)
+
+	// A pending pair still coalesces when the queue is full
+	assert.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", Timestamp: 2}))
+
+	metrics := b.Metrics()
+	assert.Equal(t, 2, metrics.Pending)
+	assert.Equal(t, 2, metrics.Capacity)
+	assert.EqualValues(t, 1, metrics.Rejected)
+}
+
+func TestReadEventBatcherRetriesFailedFlush(t *testing.T) {
+	s := &failingStore{MemoryStore: store.NewMemoryStore(), fail: true}
+	b := newReadEventBatcher(s, 100, time.Hour, 100)
+
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.Error(t, b.Flush())
+
+	metrics := b.Metrics()
+	assert.Equal(t, 1, metrics.Pending)
+	assert.EqualValues(t, 1, metrics.FailedFlushes)
+	assert.NotEmpty(t, metrics.LastError)
+
+	// A newer read arriving before the retry is merged, not lost
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", Timestamp: 5}))
+
+	s.fail = false
+	require.NoError(t, b.Flush())
+
+	events, err := s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.EqualValues(t, 5, events[0].Timestamp)
+	assert.Empty(t, b.Metrics().LastError)
+}
+
+func TestReadEventBatcherIsolatesBadEvent(t *testing.T) {
+	s := &failingStore{MemoryStore: store.NewMemoryStore(), poison: "bad"}
+	b := newReadEventBatcher(s, 100, time.Hour, 100)
+
+	for _, messageID := range []string{"msg1", "msg2", "bad", "msg3"} {
+		require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: messageID, UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	}
+	require.Error(t, b.Flush())
+
+	// The rest of the batch is written around it
+	events, err := s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+	metrics := b.Metrics()
+	assert.Equal(t, 1, metrics.Pending)
+	assert.EqualValues(t, 3, metrics.FlushedEvents)
+
+	for i := 1; i < maxWriteAttempts; i++ {
+		require.Error(t, b.Flush())
+	}
+	metrics = b.Metrics()
+	assert.Zero(t, metrics.Pending)
+	assert.EqualValues(t, 1, metrics.DroppedEvents)
+	assert.NoError(t, b.Flush())
+}
+
+func TestReadEventBatcherDropsAfterOutage(t *testing.T) {
+	s := &failingStore{MemoryStore: store.NewMemoryStore(), fail: true}
+	b := newReadEventBatcher(s, 100, time.Hour, 2)
+
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	for i := 0; i < maxWriteAttempts; i++ {
+		require.Error(t, b.Flush())
+	}
+
+	// The queue has room again once the events give up
+	metrics := b.Metrics()
+	assert.Zero(t, metrics.Pending)
+	assert.EqualValues(t, 2, metrics.DroppedEvents)
+	assert.EqualValues(t, maxWriteAttempts, metrics.FailedFlushes)
+	assert.NoError(t, b.Enqueue(store.ReadEvent{MessageID: "msg3", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+}
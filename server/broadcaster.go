@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultReadersBroadcastIntervalMs = 1000
+
+// clock schedules the broadcaster's flushes; tests swap in a fake one.
+type clock interface {
+	AfterFunc(d time.Duration, f func()) timer
+}
+
+// timer is the part of *time.Timer the broadcaster uses.
+type timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) AfterFunc(d time.Duration, f func()) timer {
+	return time.AfterFunc(d, f)
+}
+
+// readersBroadcaster buffers the readers added to each channel and sends one
+// merged channel readers event per channel per interval, rather than one per
+// read. A channel's first reader after a quiet spell starts its interval;
+// later readers ride along. Only added user IDs are sent, as a map of post
+// ID to user IDs, so clients merge them into what they have.
+type readersBroadcaster struct {
+	interval time.Duration
+	clock    clock
+	publish  func(channelID string, added map[string][]string)
+
+	mu      sync.Mutex
+	pending map[string]map[string][]string // channel ID -> post ID -> added user IDs
+	timers  map[string]timer               // channel ID -> scheduled flush
+	stopped bool
+}
+
+// newReadersBroadcaster returns a broadcaster that hands merged deltas to
+// publish. A non-positive interval falls back to the default.
+func newReadersBroadcaster(interval time.Duration, c clock, publish func(channelID string, added map[string][]string)) *readersBroadcaster {
+	if interval <= 0 {
+		interval = defaultReadersBroadcastIntervalMs * time.Millisecond
+	}
+	return &readersBroadcaster{
+		interval: interval,
+		clock:    c,
+		publish:  publish,
+		pending:  make(map[string]map[string][]string),
+		timers:   make(map[string]timer),
+	}
+}
+
+// Add buffers userIDs as new readers of postID. Once stopped, the delta is
+// published at once.
+func (b *readersBroadcaster) Add(channelID, postID string, userIDs ...string) {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		b.publish(channelID, map[string][]string{postID: userIDs})
+		return
+	}
+
+	posts, ok := b.pending[channelID]
+	if !ok {
+		posts = make(map[string][]string)
+		b.pending[channelID] = posts
+	}
+	for _, userID := range userIDs {
+		if !containsUser(posts[postID], userID) {
+			posts[postID] = append(posts[postID], userID)
+		}
+	}
+	if _, scheduled := b.timers[channelID]; !scheduled {
+		b.timers[channelID] = b.clock.AfterFunc(b.interval, func() { b.flush(channelID) })
+	}
+	b.mu.Unlock()
+}
+
+// Remove drops userIDs from channelID's buffered readers, so that a flush
+// after they left the channel does not add them back.
+func (b *readersBroadcaster) Remove(channelID string, userIDs []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	posts := b.pending[channelID]
+	for postID, readers := range posts {
+		kept := readers[:0]
+		for _, userID := range readers {
+			if !containsUser(userIDs, userID) {
+				kept = append(kept, userID)
+			}
+		}
+		if len(kept) == 0 {
+			delete(posts, postID)
+		} else {
+			posts[postID] = kept
+		}
+	}
+}
+
+// flush publishes channelID's buffered readers.
+func (b *readersBroadcaster) flush(channelID string) {
+	b.mu.Lock()
+	posts := b.pending[channelID]
+	delete(b.pending, channelID)
+	delete(b.timers, channelID)
+	b.mu.Unlock()
+
+	if len(posts) > 0 {
+		b.publish(channelID, posts)
+	}
+}
+
+// Stop cancels the scheduled flushes and publishes everything still
+// buffered. Later readers are published one by one.
+func (b *readersBroadcaster) Stop() {
+	b.mu.Lock()
+	b.stopped = true
+	channelIDs := make([]string, 0, len(b.pending))
+	for channelID := range b.pending {
+		channelIDs = append(channelIDs, channelID)
+	}
+	for _, t := range b.timers {
+		t.Stop()
+	}
+	b.mu.Unlock()
+
+	for _, channelID := range channelIDs {
+		b.flush(channelID)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock runs scheduled functions only when the test advances it.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	wasActive := !t.stopped
+	t.stopped = true
+	return wasActive
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now + d, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and fires the timers that came due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now += d
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		switch {
+		case t.stopped:
+		case t.at <= c.now:
+			t.stopped = true
+			due = append(due, t)
+		default:
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	for _, t := range due {
+		t.f()
+	}
+}
+
+type readersDelta struct {
+	channelID string
+	added     map[string][]string
+}
+
+func newTestBroadcaster() (*readersBroadcaster, *fakeClock, *[]readersDelta) {
+	clock := &fakeClock{}
+	var published []readersDelta
+	b := newReadersBroadcaster(time.Second, clock, func(channelID string, added map[string][]string) {
+		published = append(published, readersDelta{channelID, added})
+	})
+	return b, clock, &published
+}
+
+func TestReadersBroadcasterMergesPerChannel(t *testing.T) {
+	b, clock, published := newTestBroadcaster()
+
+	b.Add("channel1", "post1", "user1")
+	clock.Advance(500 * time.Millisecond)
+	b.Add("channel1", "post1", "user2", "user1")
+	b.Add("channel1", "post2", "user1")
+	b.Add("channel2", "post3", "user3")
+	assert.Empty(t, *published)
+
+	// channel1's interval started with its first reader
+	clock.Advance(500 * time.Millisecond)
+	require.Len(t, *published, 1)
+	assert.Equal(t, readersDelta{"channel1", map[string][]string{"post1": {"user1", "user2"}, "post2": {"user1"}}}, (*published)[0])
+
+	clock.Advance(500 * time.Millisecond)
+	require.Len(t, *published, 2)
+	assert.Equal(t, readersDelta{"channel2", map[string][]string{"post3": {"user3"}}}, (*published)[1])
+
+	// A quiet channel does not publish empty events
+	clock.Advance(time.Hour)
+	assert.Len(t, *published, 2)
+
+	b.Add("channel1", "post1", "user4")
+	clock.Advance(time.Second)
+	require.Len(t, *published, 3)
+	assert.Equal(t, readersDelta{"channel1", map[string][]string{"post1": {"user4"}}}, (*published)[2])
+}
+
+func TestReadersBroadcasterRemove(t *testing.T) {
+	b, clock, published := newTestBroadcaster()
+
+	b.Add("channel1", "post1", "user1", "user2")
+	b.Add("channel1", "post2", "user1")
+	b.Remove("channel1", []string{"user1"})
+	clock.Advance(time.Second)
+
+	require.Len(t, *published, 1)
+	assert.Equal(t, readersDelta{"channel1", map[string][]string{"post1": {"user2"}}}, (*published)[0])
+}
+
+func TestReadersBroadcasterStopFlushes(t *testing.T) {
+	b, clock, published := newTestBroadcaster()
+
+	b.Add("channel1", "post1", "user1")
+	b.Add("channel2", "post2", "user2")
+	b.Stop()
+	assert.ElementsMatch(t, []readersDelta{
+		{"channel1", map[string][]string{"post1": {"user1"}}},
+		{"channel2", map[string][]string{"post2": {"user2"}}},
+	}, *published)
+
+	// Nothing is left for the cancelled timers, and late readers go out at once
+	clock.Advance(time.Hour)
+	assert.Len(t, *published, 2)
+	b.Add("channel1", "post1", "user3")
+	require.Len(t, *published, 3)
+	assert.Equal(t, readersDelta{"channel1", map[string][]string{"post1": {"user3"}}}, (*published)[2])
+}
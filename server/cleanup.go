@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+)
+
+// Receipts of deleted posts, archived or deleted channels and deactivated
+// users are removed so they stop showing up in "Seen by" lists. The plugin
+// API this plugin builds against has no hook for deleted posts or
+// deactivated users, and none exists for channels, so the nightly sweep
+// finds them all. Rows under legal hold are always kept.
+
+const (
+	// postSweepBudget caps the posts one sweep looks up. Larger histories
+	// are covered over several nights, resuming where the last sweep
+	// stopped.
+	postSweepBudget = 10000
+
+	// postSweepCursorKey holds the postSweepCursor of an unfinished sweep.
+	postSweepCursorKey = "cleanup_post_cursor"
+)
+
+// UserHasLeftChannel tombstones the user's channel read, so they no longer
+// show up as a reader of posts made after they left. The row is kept for
+// legal holds and comes back once they read the channel again.
+func (p *Plugin) UserHasLeftChannel(_ *plugin.Context, member *model.ChannelMember, _ *model.User) {
+	if p.store == nil {
+		return
+	}
+	p.flushWriteQueue()
+
+	if err := p.store.MarkChannelReadLeft(member.ChannelId, member.UserId, time.Now().UnixMilli()); err != nil {
+		p.logError("[Cleanup] Failed to mark channel read left", "channel_id", member.ChannelId, "user_id", member.UserId, "error", err.Error())
+		return
+	}
+	if p.readersQueue != nil {
+		p.readersQueue.Remove(member.ChannelId, []string{member.UserId})
+	}
+	p.PublishChannelReadersRemoved(member.ChannelId, []string{member.UserId})
+}
+
+// flushWriteQueue writes out queued read events so a delete that follows
+// covers them too.
+func (p *Plugin) flushWriteQueue() {
+	if p.writeQueue == nil {
+		return
+	}
+	if err := p.writeQueue.Flush(); err != nil {
+		p.logError("[Cleanup] Failed to flush write queue", "error", err.Error())
+	}
+}
+
+// CleanupSweep is the outcome of one sweep.
+type CleanupSweep struct {
+	PostsRemoved    int   `json:"posts_removed"`
+	ChannelsRemoved int   `json:"channels_removed"`
+	UsersRemoved    int   `json:"users_removed"`
+	RowsDeleted     int64 `json:"rows_deleted"`
+}
+
+// runCleanupSweep removes the receipts of deleted posts, of archived or
+// deleted channels and of deactivated users. It shares the retention mutex, so only one node
+// sweeps at a time.
+func (p *Plugin) runCleanupSweep(ctx context.Context) (*CleanupSweep, error) {
+	if p.retention == nil {
+		return nil, errors.New("retention is not running")
+	}
+	if err := p.retention.mutex.LockWithContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to acquire retention lock")
+	}
+	defer p.retention.mutex.Unlock()
+
+	p.flushWriteQueue()
+
+	sweep := &CleanupSweep{}
+	liveChannelIDs, err := p.sweepChannels(ctx, sweep)
+	if err != nil {
+		return sweep, err
+	}
+	if err := p.sweepPosts(ctx, liveChannelIDs, postSweepBudget, sweep); err != nil {
+		return sweep, err
+	}
+	if err := p.sweepUsers(ctx, sweep); err != nil {
+		return sweep, err
+	}
+
+	p.logInfo("[Cleanup] Sweep finished",
+		"posts_removed", sweep.PostsRemoved,
+		"channels_removed", sweep.ChannelsRemoved,
+		"users_removed", sweep.UsersRemoved,
+		"rows_deleted", sweep.RowsDeleted,
+	)
+	return sweep, nil
+}
+
+// sweepChannels removes the receipts of archived and deleted channels and
+// returns the live ones, sorted.
+func (p *Plugin) sweepChannels(ctx context.Context, sweep *CleanupSweep) ([]string, error) {
+	channelIDs, err := p.store.GetReceiptChannelIDs()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list receipt channels")
+	}
+
+	var live []string
+
+	for _, channelID := range channelIDs {
+		channel, appErr := p.API.GetChannel(channelID)
+		switch {
+		case appErr != nil && appErr.StatusCode == http.StatusNotFound:
+			// deleted
+		case appErr != nil:
+			// Never delete on a transient error
+			p.logError("[Cleanup] Failed to get channel", "channel_id", channelID, "error", appErr.Error())
+			continue
+		case channel.DeleteAt == 0:
+			live = append(live, channelID)
+			continue
+		}
+
+		deleted, err := p.purgeInBatches(ctx, retentionBatchSize, func(limit int) (int64, error) {
+			return p.store.DeleteChannelReceipts(channelID, limit)
+		})
+		sweep.RowsDeleted += deleted
+		if err != nil {
+			return nil, err
+		}
+		sweep.ChannelsRemoved++
+	}
+	return live, nil
+}
+
+// postSweepCursor is the last post an unfinished post sweep looked up.
+type postSweepCursor struct {
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+}
+
+// sweepPosts removes the receipts of the live channels' deleted posts. The
+// plugin API does not return deleted posts, so a post counts as deleted when
+// looking it up answers 404. At most budget posts are looked up; the sweep
+// records where it stopped and the next one carries on from there.
+func (p *Plugin) sweepPosts(ctx context.Context, channelIDs []string, budget int, sweep *CleanupSweep) error {
+	cursor, err := p.getPostSweepCursor()
+	if err != nil {
+		p.logError("[Cleanup] Failed to get post sweep cursor, starting over", "error", err.Error())
+		cursor = postSweepCursor{}
+	}
+
+	for _, channelID := range channelIDs {
+		if channelID < cursor.ChannelID {
+			continue
+		}
+		afterID := ""
+		if channelID == cursor.ChannelID {
+			afterID = cursor.MessageID
+		}
+
+		for {
+			if budget == 0 {
+				p.savePostSweepCursor(postSweepCursor{ChannelID: channelID, MessageID: afterID})
+				return nil
+			}
+			limit := retentionBatchSize
+			if budget < limit {
+				limit = budget
+			}
+			messageIDs, err := p.store.GetReceiptMessageIDs(channelID, afterID, limit)
+			if err != nil {
+				return errors.Wrap(err, "failed to list receipt posts")
+			}
+
+			for _, messageID := range messageIDs {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				budget--
+				afterID = messageID
+				if err := p.sweepPost(messageID, sweep); err != nil {
+					return err
+				}
+			}
+			if len(messageIDs) < limit {
+				break
+			}
+		}
+	}
+
+	// Every channel is done, so the next sweep starts over
+	p.savePostSweepCursor(postSweepCursor{})
+	return nil
+}
+
+// sweepPost removes the receipts of messageID if the post is gone.
+func (p *Plugin) sweepPost(messageID string, sweep *CleanupSweep) error {
+	post, appErr := p.API.GetPost(messageID)
+	switch {
+	case appErr != nil && appErr.StatusCode == http.StatusNotFound:
+		// deleted
+	case appErr != nil:
+		p.logError("[Cleanup] Failed to get post", "post_id", messageID, "error", appErr.Error())
+		return nil
+	case post.DeleteAt == 0:
+		return nil
+	}
+
+	deleted, err := p.store.DeleteMessageReceipts(messageID)
+	sweep.RowsDeleted += deleted
+	if err != nil {
+		return err
+	}
+	sweep.PostsRemoved++
+	return nil
+}
+
+func (p *Plugin) getPostSweepCursor() (postSweepCursor, error) {
+	var cursor postSweepCursor
+	data, appErr := p.API.KVGet(postSweepCursorKey)
+	if appErr != nil {
+		return cursor, appErr
+	}
+	if data == nil {
+		return cursor, nil
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, errors.Wrap(err, "failed to decode post sweep cursor")
+	}
+	return cursor, nil
+}
+
+// savePostSweepCursor records where the post sweep stopped. Failing to is
+// only logged: the next sweep then repeats some lookups.
+func (p *Plugin) savePostSweepCursor(cursor postSweepCursor) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		p.logError("[Cleanup] Failed to encode post sweep cursor", "error", err.Error())
+		return
+	}
+	if appErr := p.API.KVSet(postSweepCursorKey, data); appErr != nil {
+		p.logError("[Cleanup] Failed to save post sweep cursor", "error", appErr.Error())
+	}
+}
+
+// sweepUsers pages through the inactive users rather than looking up every
+// reader one by one.
+func (p *Plugin) sweepUsers(ctx context.Context, sweep *CleanupSweep) error {
+	userIDs, err := p.store.GetReceiptUserIDs()
+	if err != nil {
+		return errors.Wrap(err, "failed to list receipt users")
+	}
+	readers := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		readers[userID] = true
+	}
+
+	for page := 0; ; page++ {
+		users, appErr := p.API.GetUsers(&model.UserGetOptions{Inactive: true, Page: page, PerPage: maxPerPage})
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to list inactive users")
+		}
+
+		for _, user := range users {
+			if !readers[user.Id] {
+				continue
+			}
+			deleted, err := p.purgeInBatches(ctx, retentionBatchSize, func(limit int) (int64, error) {
+				return p.store.DeleteUserReceipts(user.Id, limit)
+			})
+			sweep.RowsDeleted += deleted
+			if err != nil {
+				return err
+			}
+			sweep.UsersRemoved++
+		}
+
+		if len(users) < maxPerPage {
+			return nil
+		}
+	}
+}
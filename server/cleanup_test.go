@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserHasLeftChannel(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "user1", "post1", 100))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "user2", "post1", 100))
+
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventChannelReaders,
+		map[string]interface{}{"ChannelID": "channel1", "RemovedUserIDs": []string{"user1"}},
+		&model.WebsocketBroadcast{ChannelId: "channel1"},
+	).Return().Once()
+
+	p.UserHasLeftChannel(nil, &model.ChannelMember{ChannelId: "channel1", UserId: "user1"}, nil)
+
+	readers, err := p.store.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, readers)
+}
+
+func TestRunCleanupSweep(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	allowKV(api)
+	setupRetention(t, p)
+
+	api.On("GetChannel", "active").Return(&model.Channel{Id: "active"}, nil)
+	api.On("GetChannel", "archived").Return(&model.Channel{Id: "archived", DeleteAt: 1}, nil)
+	api.On("GetChannel", "deleted").Return(nil, model.NewAppError("GetChannel", "app.channel.get.existing.app_error", nil, "", http.StatusNotFound))
+	api.On("GetChannel", "unreachable").Return(nil, model.NewAppError("GetChannel", "app.channel.get.find.app_error", nil, "", http.StatusInternalServerError))
+	api.On("GetPost", "active-post").Return(&model.Post{Id: "active-post", ChannelId: "active"}, nil)
+	api.On("GetPost", "removed-post").Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusNotFound))
+	api.On("GetPost", "failing-post").Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusInternalServerError))
+	api.On("GetUsers", &model.UserGetOptions{Inactive: true, Page: 0, PerPage: maxPerPage}).Return([]*model.User{
+		{Id: "deactivated", DeleteAt: 1},
+		{Id: "never-read", DeleteAt: 1},
+	}, nil)
+
+	for _, channelID := range []string{"active", "archived", "deleted", "unreachable"} {
+		require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: channelID + "-post", UserID: "user1", ChannelID: channelID, Timestamp: 100}))
+	}
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "active-post", UserID: "deactivated", ChannelID: "active", Timestamp: 100}))
+	for _, messageID := range []string{"removed-post", "failing-post"} {
+		require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: messageID, UserID: "user1", ChannelID: "active", Timestamp: 100}))
+	}
+	require.NoError(t, p.store.SaveDeliveries([]store.DeliveryEvent{{MessageID: "removed-post", UserID: "user2", ChannelID: "active", DeliveredAt: 100}}))
+	require.NoError(t, p.store.UpsertChannelRead("archived", "user1", "archived-post", 100))
+
+	sweep, err := p.runCleanupSweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &CleanupSweep{PostsRemoved: 1, ChannelsRemoved: 2, UsersRemoved: 1, RowsDeleted: 6}, sweep)
+
+	// A post that could not be looked up keeps its receipts
+	messageIDs, err := p.store.GetReceiptMessageIDs("active", "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"active-post", "failing-post"}, messageIDs)
+
+	channelIDs, err := p.store.GetReceiptChannelIDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"active", "unreachable"}, channelIDs)
+
+	userIDs, err := p.store.GetReceiptUserIDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1"}, userIDs)
+}
+
+func TestSweepPostsResumes(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	var cursor []byte
+	api.On("KVGet", postSweepCursorKey).Return(func(string) []byte { return cursor }, nil)
+	api.On("KVSet", postSweepCursorKey, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cursor = args.Get(1).([]byte)
+	})
+	looked := make(map[string]int)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		looked[args.String(0)]++
+	})
+
+	for _, event := range []store.ReadEvent{
+		{MessageID: "post1", ChannelID: "channel1"},
+		{MessageID: "post2", ChannelID: "channel1"},
+		{MessageID: "post3", ChannelID: "channel2"},
+	} {
+		event.UserID = "user1"
+		require.NoError(t, p.store.Upsert(event))
+	}
+	channelIDs := []string{"channel1", "channel2"}
+
+	// Each sweep picks up where the last one ran out of budget
+	require.NoError(t, p.sweepPosts(context.Background(), channelIDs, 2, &CleanupSweep{}))
+	assert.Equal(t, map[string]int{"post1": 1, "post2": 1}, looked)
+	require.NoError(t, p.sweepPosts(context.Background(), channelIDs, 2, &CleanupSweep{}))
+	assert.Equal(t, map[string]int{"post1": 1, "post2": 1, "post3": 1}, looked)
+	assert.JSONEq(t, `{"channel_id":"","message_id":""}`, string(cursor))
+
+	// and a finished sweep starts over
+	require.NoError(t, p.sweepPosts(context.Background(), channelIDs, 2, &CleanupSweep{}))
+	assert.Equal(t, 2, looked["post1"])
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+
+	"github.com/mattermost/mattermost-server/v6/model"
 )
 
 // Configuration holds all tunable settings exposed through the System Console.
@@ -14,7 +16,34 @@ type Configuration struct {
 	Enable                bool   `json:"enable"                 mapstructure:"Enable"`                // Master on/off switch for the feature
 	VisibilityThresholdMs int    `json:"visibility_threshold_ms" mapstructure:"VisibilityThresholdMs"` // Milliseconds a post must be visible before it counts as “read”
 	RetentionDays         int    `json:"retention_days"          mapstructure:"RetentionDays"`         // Purge receipts older than N days
+	RetentionPolicy       string `json:"retention_policy"        mapstructure:"RetentionPolicy"`       // Optional JSON overrides per channel type, team and channel
 	LogLevel              string `json:"log_level"               mapstructure:"LogLevel"`              // debug | info | error
+	SQLiteFile            string `json:"sqlite_file"             mapstructure:"SQLiteFile"`            // Optional dedicated SQLite file instead of the Mattermost database
+
+	// Optional plugin-owned database. When DatabaseDriver is empty the plugin
+	// falls back to Mattermost's own SqlSettings.
+	DatabaseDriver            string `json:"database_driver"              mapstructure:"DatabaseDriver"`            // postgres | mysql
+	DatabaseDataSource        string `json:"database_data_source"         mapstructure:"DatabaseDataSource"`        // DSN for the receipts tables
+	DatabaseReplicaDataSource string `json:"database_replica_data_source" mapstructure:"DatabaseReplicaDataSource"` // Optional read-replica DSN
+
+	// Write-behind queue for read events. Zero values use the built-in defaults.
+	WriteBatchSize       int `json:"write_batch_size"        mapstructure:"WriteBatchSize"`       // Flush once this many events are pending
+	WriteFlushIntervalMs int `json:"write_flush_interval_ms" mapstructure:"WriteFlushIntervalMs"` // Flush at least this often
+	WriteQueueCapacity   int `json:"write_queue_capacity"    mapstructure:"WriteQueueCapacity"`   // Reject new events beyond this many pending
+
+	ReadersBroadcastIntervalMs int `json:"readers_broadcast_interval_ms" mapstructure:"ReadersBroadcastIntervalMs"` // Merge a channel's new readers into one event this often; zero uses the default
+
+	LastViewedSyncIntervalMinutes int  `json:"last_viewed_sync_interval_minutes" mapstructure:"LastViewedSyncIntervalMinutes"` // Copy Mattermost's LastViewedAt into channel reads this often; 0 disables
+	InferReadsFromChannelViews    bool `json:"infer_reads_from_channel_views"    mapstructure:"InferReadsFromChannelViews"`    // Refresh a channel's reads from LastViewedAt whenever its readers are listed
+
+	ReadPrivacyReciprocity bool `json:"read_privacy_reciprocity" mapstructure:"ReadPrivacyReciprocity"`  // Users who hide their read receipts cannot see anyone else's
+	RestrictToEnabledTeams bool `json:"restrict_to_enabled_teams" mapstructure:"RestrictToEnabledTeams"` // Receipts only work in teams a system admin enabled
+
+	LargeChannelThreshold int `json:"large_channel_threshold" mapstructure:"LargeChannelThreshold"` // Channels with more members get read counts instead of reader lists; 0 disables
+
+	ReaderCacheSize int `json:"reader_cache_size" mapstructure:"ReaderCacheSize"` // Reader lookups kept in memory per node; 0 disables the cache
+
+	retentionPolicy *RetentionPolicy // parsed RetentionPolicy, set by IsValid
 }
 
 // getDefaultConfiguration returns the hard-coded defaults that are used
@@ -25,6 +54,12 @@ func getDefaultConfiguration() *Configuration {
 		VisibilityThresholdMs: 2000,
 		RetentionDays:         30,
 		LogLevel:              "info",
+		WriteBatchSize:        defaultWriteBatchSize,
+		WriteFlushIntervalMs:  defaultWriteFlushIntervalMs,
+		WriteQueueCapacity:    defaultWriteQueueCapacity,
+
+		ReadersBroadcastIntervalMs: defaultReadersBroadcastIntervalMs,
+		ReaderCacheSize:            defaultReaderCacheSize,
 	}
 }
 
@@ -40,12 +75,62 @@ func (c *Configuration) IsValid() error {
 	if c.RetentionDays < 0 {
 		return fmt.Errorf("retention days must be non-negative")
 	}
+	policy, err := parseRetentionPolicy(c.RetentionPolicy)
+	if err != nil {
+		return err
+	}
+	c.retentionPolicy = policy
+	if c.WriteBatchSize < 0 || c.WriteFlushIntervalMs < 0 || c.WriteQueueCapacity < 0 {
+		return fmt.Errorf("write queue settings must be non-negative")
+	}
+	if c.ReadersBroadcastIntervalMs < 0 {
+		return fmt.Errorf("readers broadcast interval must be non-negative")
+	}
+	if c.LastViewedSyncIntervalMinutes < 0 {
+		return fmt.Errorf("last viewed sync interval must be non-negative")
+	}
+	if c.LargeChannelThreshold < 0 {
+		return fmt.Errorf("large channel threshold must be non-negative")
+	}
+	if c.ReaderCacheSize < 0 {
+		return fmt.Errorf("reader cache size must be non-negative")
+	}
 	switch c.LogLevel {
 	case "debug", "info", "error":
 		// valid
 	default:
 		return fmt.Errorf("log level must be one of: debug, info, error")
 	}
+	return c.validateDatabase()
+}
+
+// validateDatabase checks the optional plugin-owned database settings.
+func (c *Configuration) validateDatabase() error {
+	c.DatabaseDriver = strings.ToLower(strings.TrimSpace(c.DatabaseDriver))
+	c.DatabaseDataSource = strings.TrimSpace(c.DatabaseDataSource)
+	c.DatabaseReplicaDataSource = strings.TrimSpace(c.DatabaseReplicaDataSource)
+
+	switch c.DatabaseDriver {
+	case "":
+		if c.DatabaseDataSource != "" || c.DatabaseReplicaDataSource != "" {
+			return fmt.Errorf("database driver is required when a database data source is set")
+		}
+		return nil
+	case "postgres", "mysql":
+		// valid
+	default:
+		return fmt.Errorf("database driver must be one of: postgres, mysql")
+	}
+
+	if c.SQLiteFile != "" {
+		return fmt.Errorf("a dedicated database driver and a SQLite file cannot both be configured")
+	}
+	if c.DatabaseDataSource == "" {
+		return fmt.Errorf("database data source is required when a database driver is set")
+	}
+	if c.DatabaseDataSource == model.FakeSetting || c.DatabaseReplicaDataSource == model.FakeSetting {
+		return fmt.Errorf("database data source is masked; enter the real connection string")
+	}
 	return nil
 }
 
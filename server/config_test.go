@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigurationIsValidDatabase(t *testing.T) {
+	for name, tc := range map[string]struct {
+		mutate func(c *Configuration)
+		valid  bool
+	}{
+		"defaults": {
+			mutate: func(c *Configuration) {},
+			valid:  true,
+		},
+		"dedicated postgres": {
+			mutate: func(c *Configuration) {
+				c.DatabaseDriver = "Postgres"
+				c.DatabaseDataSource = "postgres://u:p@db/receipts"
+				c.DatabaseReplicaDataSource = "postgres://u:p@replica/receipts"
+			},
+			valid: true,
+		},
+		"unknown driver": {
+			mutate: func(c *Configuration) {
+				c.DatabaseDriver = "oracle"
+				c.DatabaseDataSource = "dsn"
+			},
+		},
+		"driver without data source": {
+			mutate: func(c *Configuration) { c.DatabaseDriver = "mysql" },
+		},
+		"data source without driver": {
+			mutate: func(c *Configuration) { c.DatabaseDataSource = "dsn" },
+		},
+		"replica without driver": {
+			mutate: func(c *Configuration) { c.DatabaseReplicaDataSource = "dsn" },
+		},
+		"masked data source": {
+			mutate: func(c *Configuration) {
+				c.DatabaseDriver = "mysql"
+				c.DatabaseDataSource = model.FakeSetting
+			},
+		},
+		"driver and sqlite file": {
+			mutate: func(c *Configuration) {
+				c.DatabaseDriver = "mysql"
+				c.DatabaseDataSource = "dsn"
+				c.SQLiteFile = "/tmp/receipts.db"
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := getDefaultConfiguration()
+			tc.mutate(c)
+			err := c.IsValid()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigurationIsValidRetentionPolicy(t *testing.T) {
+	for name, tc := range map[string]struct {
+		policy string
+		valid  bool
+	}{
+		"empty":         {policy: "", valid: true},
+		"all rules":     {policy: `{"channel_types": {"d": 365, "O": 7}, "teams": {"team1": 90}, "channels": {"channel1": 0}}`, valid: true},
+		"unknown type":  {policy: `{"channel_types": {"X": 1}}`},
+		"negative days": {policy: `{"teams": {"team1": -1}}`},
+		"unknown key":   {policy: `{"users": {"user1": 1}}`},
+		"not json":      {policy: `D=365`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := getDefaultConfiguration()
+			c.RetentionPolicy = tc.policy
+			err := c.IsValid()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	c := getDefaultConfiguration()
+	c.RetentionPolicy = `{"channel_types": {"d": 365}}`
+	assert.NoError(t, c.IsValid())
+	assert.Equal(t, map[string]int{"D": 365}, c.retentionPolicy.ChannelTypes)
+}
+
+func TestRetentionPolicyDaysFor(t *testing.T) {
+	policy := &RetentionPolicy{
+		ChannelTypes: map[string]int{"D": 365, "O": 7},
+		Teams:        map[string]int{"compliance": 0},
+		Channels:     map[string]int{"announcements": 30},
+	}
+
+	for name, tc := range map[string]struct {
+		channel *model.Channel
+		days    int
+	}{
+		"channel rule":          {channel: &model.Channel{Id: "announcements", TeamId: "compliance", Type: model.ChannelTypeOpen}, days: 30},
+		"team rule":             {channel: &model.Channel{Id: "c1", TeamId: "compliance", Type: model.ChannelTypeOpen}, days: 0},
+		"type rule":             {channel: &model.Channel{Id: "c2", TeamId: "sales", Type: model.ChannelTypeOpen}, days: 7},
+		"direct message":        {channel: &model.Channel{Id: "dm", Type: model.ChannelTypeDirect}, days: 365},
+		"fallback":              {channel: &model.Channel{Id: "c3", TeamId: "sales", Type: model.ChannelTypePrivate}, days: 14},
+		"unknown channel by ID": {channel: &model.Channel{Id: "announcements"}, days: 30},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.days, policy.DaysFor(tc.channel, 14))
+		})
+	}
+
+	var empty *RetentionPolicy
+	assert.True(t, empty.IsEmpty())
+	assert.Equal(t, 14, empty.DaysFor(&model.Channel{Id: "c1"}, 14))
+}
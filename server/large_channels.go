@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// Channels with more than LargeChannelThreshold members get counts instead of
+// reader lists. Reads are still stored per user, but no read is broadcast as
+// a list of user IDs: members receive throttled read counts, and only the
+// post's author and system admins may page through who read it.
+
+const (
+	// channelSizeTTL is how long a channel's member count is trusted.
+	channelSizeTTL = time.Minute
+
+	// channelSizeMaxKeys bounds the member count cache.
+	channelSizeMaxKeys = 10000
+
+	// readCountsInterval is how often at most a post's read counts are
+	// broadcast in a large channel.
+	readCountsInterval = 5 * time.Second
+)
+
+// channelSize is a cached member count.
+type channelSize struct {
+	members   int64
+	checkedAt time.Time
+}
+
+// channelSizeCache remembers member counts, so that large channels cost one
+// GetChannelStats call per channelSizeTTL rather than one per read.
+type channelSizeCache struct {
+	mu    sync.Mutex
+	sizes map[string]channelSize
+}
+
+func (c *channelSizeCache) get(channelID string, now time.Time) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size, ok := c.sizes[channelID]
+	if !ok || now.Sub(size.checkedAt) >= channelSizeTTL {
+		return 0, false
+	}
+	return size.members, true
+}
+
+func (c *channelSizeCache) set(channelID string, members int64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sizes == nil || len(c.sizes) >= channelSizeMaxKeys {
+		// Expired counts would be fetched again anyway
+		fresh := make(map[string]channelSize)
+		for id, size := range c.sizes {
+			if now.Sub(size.checkedAt) < channelSizeTTL {
+				fresh[id] = size
+			}
+		}
+		c.sizes = fresh
+	}
+	c.sizes[channelID] = channelSize{members: members, checkedAt: now}
+}
+
+// readCountThrottle sends a post's read counts at most once per interval.
+// The first read of a quiet post schedules a broadcast; reads until it fires
+// are covered by it.
+type readCountThrottle struct {
+	clock clock // nil means realClock
+
+	mu      sync.Mutex
+	pending map[string]timer // post ID -> scheduled broadcast
+}
+
+// schedule runs publish after the interval unless a broadcast is already
+// pending for postID.
+func (t *readCountThrottle) schedule(postID string, publish func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.pending[postID]; ok {
+		return
+	}
+	if t.pending == nil {
+		t.pending = make(map[string]timer)
+	}
+	c := t.clock
+	if c == nil {
+		c = realClock{}
+	}
+	t.pending[postID] = c.AfterFunc(readCountsInterval, func() {
+		t.mu.Lock()
+		delete(t.pending, postID)
+		t.mu.Unlock()
+		publish()
+	})
+}
+
+// stop drops the pending broadcasts.
+func (t *readCountThrottle) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, timer := range t.pending {
+		timer.Stop()
+	}
+	t.pending = nil
+}
+
+// isLargeChannel reports whether channelID has more members than
+// LargeChannelThreshold. A failed lookup is logged and counts as large, so
+// that reader lists are never broadcast by mistake.
+func (p *Plugin) isLargeChannel(channelID string) bool {
+	threshold := p.getConfiguration().LargeChannelThreshold
+	if threshold == 0 {
+		return false
+	}
+
+	now := time.Now()
+	members, ok := p.channelSizes.get(channelID, now)
+	if !ok {
+		stats, appErr := p.API.GetChannelStats(channelID)
+		if appErr != nil {
+			p.logError("[API] Failed to get channel stats", "channel_id", channelID, "error", appErr.Error())
+			return true
+		}
+		members = stats.MemberCount
+		p.channelSizes.set(channelID, members, now)
+	}
+	return members > int64(threshold)
+}
+
+// scheduleReadCounts queues a read counts broadcast for post, which lives in
+// a large channel.
+func (p *Plugin) scheduleReadCounts(post *model.Post) {
+	p.readCounts.schedule(post.Id, func() { p.publishReadCounts(post) })
+}
+
+// publishReadCounts sends the channel post's delivered and read counts.
+// Readers who hide their receipts are not counted.
+func (p *Plugin) publishReadCounts(post *model.Post) {
+	privacy := p.getBroadcastPrivacy()
+	if privacy == nil {
+		return
+	}
+	counts, err := p.getPostReceiptCounts(post, privacy, "")
+	if err != nil {
+		p.logError("[API] Failed to get receipt counts", "post_id", post.Id, "error", err.Error())
+		return
+	}
+	p.PublishReadCounts(post.ChannelId, counts, privacy.channelBroadcast(post.ChannelId))
+}
+
+// ReaderListsRequired refuses channel-wide reader lists in large channels.
+// It runs after ChannelReadRequired.
+func (p *Plugin) ReaderListsRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.isLargeChannel(channelIDFromRequest(r)) {
+			http.Error(w, "Reader lists are not available in large channels; use /api/v2/posts/{postID}/readers", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeChannelBroadcastsCounts(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+	p.conf.LargeChannelThreshold = 2
+
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}
+	api.On("GetPost", post.Id).Return(post, nil)
+	allowOpenChannels(api, "channel1")
+	api.On("GetChannelStats", "channel1").Return(&model.ChannelStats{ChannelId: "channel1", MemberCount: 3}, nil).Once()
+	api.On("GetChannelMember", "channel1", mock.AnythingOfType("string")).Return(&model.ChannelMember{ChannelId: "channel1"}, nil)
+
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReadCounts,
+		map[string]interface{}{"MessageID": "post1", "ChannelID": "channel1", "DeliveredCount": 2, "ReadCount": 2},
+		&model.WebsocketBroadcast{ChannelId: "channel1"},
+	).Return().Once()
+
+	for _, userID := range []string{"reader1", "reader2"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/read", strings.NewReader(`{"message_id":"post1"}`))
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// Both reads end up in a single counts event, and no reader list is sent
+	clock := p.readCounts.clock.(*fakeClock)
+	clock.Advance(readCountsInterval - time.Millisecond)
+	api.AssertNotCalled(t, "PublishWebSocketEvent", WebSocketEventReadCounts, mock.Anything, mock.Anything)
+	clock.Advance(time.Millisecond)
+	api.AssertNotCalled(t, "PublishWebSocketEvent", WebSocketEventChannelReaders, mock.Anything, mock.Anything)
+	api.AssertNotCalled(t, "PublishWebSocketEvent", WebSocketEventReadReceipt, mock.Anything, mock.Anything)
+}
+
+func TestLargeChannelReaderLists(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	p.conf.LargeChannelThreshold = 2
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "reader", ChannelID: "channel1", Timestamp: 100}))
+
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}, nil)
+	allowOpenChannels(api, "channel1")
+	api.On("GetChannelStats", "channel1").Return(&model.ChannelStats{ChannelId: "channel1", MemberCount: 3}, nil).Once()
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), "channel1", model.PermissionReadChannel).Return(true)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "member", model.PermissionManageSystem).Return(false)
+
+	serve := func(path, userID string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve("/api/v1/channel/channel1/readers?since=0", "member"))
+	assert.Equal(t, http.StatusForbidden, serve("/api/v1/channel/channel1/reads", "admin"))
+	assert.Equal(t, http.StatusForbidden, serve("/api/v2/posts/post1/readers", "member"))
+	assert.Equal(t, http.StatusOK, serve("/api/v2/posts/post1/readers", "author"))
+	assert.Equal(t, http.StatusOK, serve("/api/v2/posts/post1/readers", "admin"))
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// Mattermost tracks when each member last viewed a channel, including on
+// mobile and desktop clients that never load the webapp bundle. The sync
+// copies LastViewedAt into channel_reads wherever it is newer, so those
+// users show up in "Seen by" too.
+
+const (
+	lastViewedSyncJobKey     = "last_viewed_sync"
+	lastViewedSyncMutexKey   = "last_viewed_sync_run"
+	lastViewedSyncLastRunKey = "last_viewed_sync_last_run"
+
+	// How often a disabled schedule checks whether it has been enabled
+	lastViewedSyncIdlePoll = 15 * time.Minute
+
+	// With InferReadsFromChannelViews, how long a channel's inferred reads
+	// are reused before the reader endpoints look at LastViewedAt again
+	inferredReadsRefresh = 30 * time.Second
+	inferredReadsMaxKeys = 10000
+)
+
+// LastViewedSync records the outcome of one sync. The last one is kept in
+// the plugin KV store so every node in a cluster can report it.
+type LastViewedSync struct {
+	StartedAt      int64  `json:"started_at"`
+	FinishedAt     int64  `json:"finished_at"`
+	ChannelID      string `json:"channel_id,omitempty"` // set when a single channel was synced
+	ChannelsSynced int    `json:"channels_synced"`
+	MembersScanned int    `json:"members_scanned"`
+	ReadsUpdated   int    `json:"reads_updated"`
+	Error          string `json:"error,omitempty"`
+}
+
+// lastViewedSync runs the sync on a cluster-wide schedule. The job and
+// manual runs share a cluster mutex, so only one node syncs at a time.
+type lastViewedSync struct {
+	job    *cluster.Job
+	mutex  *cluster.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// startLastViewedSync schedules the periodic sync. The schedule follows
+// LastViewedSyncIntervalMinutes as it changes; zero only pauses it.
+func (p *Plugin) startLastViewedSync() error {
+	mutex, err := cluster.NewMutex(p.API, lastViewedSyncMutexKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to create last viewed sync mutex")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &lastViewedSync{mutex: mutex, ctx: ctx, cancel: cancel}
+
+	job, err := cluster.Schedule(p.API, lastViewedSyncJobKey, p.nextLastViewedSync, func() {
+		if p.getConfiguration().LastViewedSyncIntervalMinutes == 0 {
+			return
+		}
+		if _, err := p.runLastViewedSync(s.ctx, ""); err != nil {
+			p.logError("[Sync] Last viewed sync failed", "error", err.Error())
+		}
+	})
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to schedule last viewed sync job")
+	}
+	s.job = job
+
+	p.lastViewedSync = s
+	return nil
+}
+
+// nextLastViewedSync is the job's cluster.NextWaitInterval.
+func (p *Plugin) nextLastViewedSync(now time.Time, metadata cluster.JobMetadata) time.Duration {
+	minutes := p.getConfiguration().LastViewedSyncIntervalMinutes
+	if minutes == 0 {
+		return lastViewedSyncIdlePoll
+	}
+	return cluster.MakeWaitForInterval(time.Duration(minutes)*time.Minute)(now, metadata)
+}
+
+// stopLastViewedSync cancels an in-flight sync between pages and stops the schedule.
+func (p *Plugin) stopLastViewedSync() {
+	if p.lastViewedSync == nil {
+		return
+	}
+	p.lastViewedSync.cancel()
+	if p.lastViewedSync.job != nil {
+		if err := p.lastViewedSync.job.Close(); err != nil {
+			p.logError("[Sync] Failed to stop last viewed sync job", "error", err.Error())
+		}
+	}
+	p.lastViewedSync = nil
+}
+
+// runLastViewedSync takes the cluster mutex and syncs channelID, or every
+// channel an active user belongs to when channelID is empty.
+func (p *Plugin) runLastViewedSync(ctx context.Context, channelID string) (*LastViewedSync, error) {
+	if p.lastViewedSync == nil {
+		return nil, errors.New("last viewed sync is not running")
+	}
+	if err := p.lastViewedSync.mutex.LockWithContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to acquire last viewed sync lock")
+	}
+	defer p.lastViewedSync.mutex.Unlock()
+
+	run := &LastViewedSync{
+		StartedAt: time.Now().UnixMilli(),
+		ChannelID: channelID,
+	}
+
+	err := p.syncChannelsLastViewed(ctx, run, channelID)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().UnixMilli()
+
+	if saveErr := p.saveLastViewedSync(run); saveErr != nil {
+		p.logError("[Sync] Failed to record last viewed sync", "error", saveErr.Error())
+	}
+	p.logInfo("[Sync] Last viewed sync finished",
+		"channels_synced", run.ChannelsSynced,
+		"reads_updated", run.ReadsUpdated,
+		"duration_ms", run.FinishedAt-run.StartedAt,
+	)
+	return run, err
+}
+
+// syncChannelsLastViewed syncs one channel after another. A channel that
+// fails is logged and skipped; only cancellation stops the run early.
+func (p *Plugin) syncChannelsLastViewed(ctx context.Context, run *LastViewedSync, channelID string) error {
+	channelIDs := []string{channelID}
+	if channelID == "" {
+		ids, err := p.listSyncChannels(ctx)
+		if err != nil {
+			return err
+		}
+		channelIDs = ids
+	}
+
+	var lastErr error
+	for _, id := range channelIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.syncChannelLastViewed(ctx, run, id); err != nil {
+			p.logError("[Sync] Failed to sync channel", "channel_id", id, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		run.ChannelsSynced++
+	}
+	return lastErr
+}
+
+// listSyncChannels lists the channels of every active user, sorted. It asks
+// Mattermost rather than the receipt tables, since channels used only from
+// mobile or desktop apps, such as most DMs, have no receipts yet. The
+// plugin API cannot list a team's private channels, so they are found
+// through their members. DMs and group messages belong to no team.
+func (p *Plugin) listSyncChannels(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	for page := 0; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		users, appErr := p.API.GetUsers(&model.UserGetOptions{Active: true, Page: page, PerPage: maxPerPage})
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to list active users")
+		}
+
+		for _, user := range users {
+			if user.IsBot {
+				continue
+			}
+			if err := p.addUserChannels(seen, user.Id); err != nil {
+				// One user's channels are not worth the whole run
+				p.logError("[Sync] Failed to list user channels", "user_id", user.Id, "error", err.Error())
+			}
+		}
+
+		if len(users) < maxPerPage {
+			break
+		}
+	}
+
+	channelIDs := make([]string, 0, len(seen))
+	for channelID := range seen {
+		channelIDs = append(channelIDs, channelID)
+	}
+	sort.Strings(channelIDs)
+	return channelIDs, nil
+}
+
+// addUserChannels adds the IDs of userID's channels to seen.
+func (p *Plugin) addUserChannels(seen map[string]bool, userID string) error {
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return appErr
+	}
+	teamIDs := []string{""}
+	for _, team := range teams {
+		teamIDs = append(teamIDs, team.Id)
+	}
+
+	for _, teamID := range teamIDs {
+		channels, appErr := p.API.GetChannelsForTeamForUser(teamID, userID, false)
+		if appErr != nil {
+			return appErr
+		}
+		for _, channel := range channels {
+			seen[channel.Id] = true
+		}
+	}
+	return nil
+}
+
+// syncChannelLastViewed pages through a channel's members and upserts a
+// channel read for everyone whose LastViewedAt is newer than their stored
+// one. Each page is written in one transaction.
+func (p *Plugin) syncChannelLastViewed(ctx context.Context, run *LastViewedSync, channelID string) error {
+	reads, err := p.store.GetChannelReads(channelID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get channel reads")
+	}
+	existing := make(map[string]types.ChannelRead, len(reads))
+	for _, read := range reads {
+		existing[read.UserID] = read
+	}
+
+	for page := 0; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		members, appErr := p.API.GetChannelMembers(channelID, page, maxPerPage)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to get members of channel %s", channelID)
+		}
+		run.MembersScanned += len(members)
+
+		var updates []types.ChannelRead
+		for _, member := range members {
+			read := existing[member.UserId]
+			if member.LastViewedAt <= read.LastSeenAt {
+				continue
+			}
+			// LastViewedAt carries no post, so the last post the user is
+			// known to have read is kept
+			updates = append(updates, types.ChannelRead{
+				ChannelID:  channelID,
+				UserID:     member.UserId,
+				LastPostID: read.LastPostID,
+				LastSeenAt: member.LastViewedAt,
+				Source:     types.ReadSourceInferred,
+			})
+		}
+		if err := p.saveChannelReads(updates); err != nil {
+			return err
+		}
+		run.ReadsUpdated += len(updates)
+
+		if len(members) < maxPerPage {
+			return nil
+		}
+	}
+}
+
+// refreshInferredReads brings a channel's inferred reads up to date when
+// its readers are listed. Paging through the members takes a while in big
+// channels, so the refresh runs in the background and the request answers
+// with what is stored; the refreshed reads show up on the next one. Each
+// node refreshes a channel at most once per inferredReadsRefresh, and
+// stopping the plugin cancels the refreshes still running.
+func (p *Plugin) refreshInferredReads(channelID string) {
+	if !p.getConfiguration().InferReadsFromChannelViews {
+		return
+	}
+	if !p.inferredRefreshed.due(channelID, time.Now()) {
+		return
+	}
+
+	ctx := p.lifetime
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.inferredRefreshed.running.Add(1)
+	go func() {
+		defer p.inferredRefreshed.running.Done()
+
+		run := &LastViewedSync{}
+		if err := p.syncChannelLastViewed(ctx, run, channelID); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logError("[Sync] Failed to refresh inferred reads", "channel_id", channelID, "error", err.Error())
+			return
+		}
+		p.logDebug("[Sync] Refreshed inferred reads", "channel_id", channelID, "reads_updated", run.ReadsUpdated)
+	}()
+}
+
+// refreshThrottle remembers when each channel was last refreshed and tracks
+// the refreshes still running.
+type refreshThrottle struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+
+	running sync.WaitGroup
+}
+
+// wait blocks until the running refreshes are done.
+func (t *refreshThrottle) wait() {
+	t.running.Wait()
+}
+
+// due reports whether channelID is due for a refresh, and if so records now
+// as its last refresh.
+func (t *refreshThrottle) due(channelID string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.last[channelID]; ok && now.Sub(last) < inferredReadsRefresh {
+		return false
+	}
+	if t.last == nil || len(t.last) >= inferredReadsMaxKeys {
+		// Anything older than the refresh interval is due anyway
+		fresh := make(map[string]time.Time)
+		for id, last := range t.last {
+			if now.Sub(last) < inferredReadsRefresh {
+				fresh[id] = last
+			}
+		}
+		t.last = fresh
+	}
+	t.last[channelID] = now
+	return true
+}
+
+func (p *Plugin) saveChannelReads(reads []types.ChannelRead) error {
+	if len(reads) == 0 {
+		return nil
+	}
+	tx, err := p.store.BeginTx()
+	if err != nil {
+		return err
+	}
+	for _, read := range reads {
+		if err := p.store.UpsertChannelReadTx(tx, read); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "failed to upsert channel read")
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *Plugin) saveLastViewedSync(run *LastViewedSync) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if appErr := p.API.KVSet(lastViewedSyncLastRunKey, data); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// getLastViewedSync returns the last recorded sync, or nil if none.
+func (p *Plugin) getLastViewedSync() (*LastViewedSync, error) {
+	data, appErr := p.API.KVGet(lastViewedSyncLastRunKey)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var run LastViewedSync
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, errors.Wrap(err, "failed to decode last viewed sync")
+	}
+	return &run, nil
+}
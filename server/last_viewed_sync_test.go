@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLastViewedSync gives p a sync runner without the background schedule.
+func setupLastViewedSync(t *testing.T, p *Plugin) {
+	mutex, err := cluster.NewMutex(p.API, lastViewedSyncMutexKey)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	p.lastViewedSync = &lastViewedSync{mutex: mutex, ctx: ctx, cancel: cancel}
+	t.Cleanup(p.stopLastViewedSync)
+}
+
+func TestRunLastViewedSync(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	allowKV(api)
+	setupLastViewedSync(t, p)
+
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "user1", ChannelID: "channel1", Timestamp: 100}))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "user1", "post1", 100))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "user2", "post1", 300))
+
+	// Channels are listed from Mattermost, so the DM used only on mobile is
+	// synced although it has no receipts
+	api.On("GetUsers", &model.UserGetOptions{Active: true, Page: 0, PerPage: maxPerPage}).Return([]*model.User{
+		{Id: "user1"}, {Id: "mobile"}, {Id: "bot", IsBot: true}, {Id: "broken"},
+	}, nil)
+	api.On("GetTeamsForUser", "user1").Return([]*model.Team{{Id: "team1"}}, nil)
+	api.On("GetTeamsForUser", "mobile").Return([]*model.Team{}, nil)
+	api.On("GetTeamsForUser", "broken").Return(nil, model.NewAppError("GetTeamsForUser", "app.team.get_all.app_error", nil, "", http.StatusInternalServerError))
+	api.On("GetChannelsForTeamForUser", "", "user1", false).Return([]*model.Channel{{Id: "dm"}}, nil)
+	api.On("GetChannelsForTeamForUser", "team1", "user1", false).Return([]*model.Channel{{Id: "channel1"}, {Id: "dm"}, {Id: "gone"}}, nil)
+	api.On("GetChannelsForTeamForUser", "", "mobile", false).Return([]*model.Channel{{Id: "dm"}}, nil)
+
+	api.On("GetChannelMembers", "dm", 0, maxPerPage).Return(model.ChannelMembers{
+		{ChannelId: "dm", UserId: "user1"},
+		{ChannelId: "dm", UserId: "mobile", LastViewedAt: 500},
+	}, nil)
+	api.On("GetChannelMembers", "channel1", 0, maxPerPage).Return(model.ChannelMembers{
+		{ChannelId: "channel1", UserId: "user1", LastViewedAt: 200},
+		{ChannelId: "channel1", UserId: "user2", LastViewedAt: 250},
+		{ChannelId: "channel1", UserId: "mobile", LastViewedAt: 400},
+		{ChannelId: "channel1", UserId: "never-viewed"},
+	}, nil)
+	api.On("GetChannelMembers", "gone", 0, maxPerPage).Return(nil, model.NewAppError("GetChannelMembers", "app.channel.get_members.app_error", nil, "", http.StatusNotFound))
+
+	run, err := p.runLastViewedSync(context.Background(), "")
+	require.Error(t, err)
+	assert.Equal(t, 2, run.ChannelsSynced)
+	assert.Equal(t, 6, run.MembersScanned)
+	assert.Equal(t, 3, run.ReadsUpdated)
+	assert.NotEmpty(t, run.Error)
+
+	reads, err := p.store.GetChannelReads("channel1")
+	require.NoError(t, err)
+	assert.Equal(t, []types.ChannelRead{
+		{ChannelID: "channel1", UserID: "mobile", LastPostID: "", LastSeenAt: 400, Source: types.ReadSourceInferred},
+		{ChannelID: "channel1", UserID: "user2", LastPostID: "post1", LastSeenAt: 300, Source: types.ReadSourceClient},
+		{ChannelID: "channel1", UserID: "user1", LastPostID: "post1", LastSeenAt: 200, Source: types.ReadSourceInferred},
+	}, reads)
+
+	reads, err = p.store.GetChannelReads("dm")
+	require.NoError(t, err)
+	assert.Equal(t, []types.ChannelRead{
+		{ChannelID: "dm", UserID: "mobile", LastSeenAt: 500, Source: types.ReadSourceInferred},
+	}, reads)
+}
+
+func TestNextLastViewedSync(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	now := time.Now()
+
+	assert.Equal(t, lastViewedSyncIdlePoll, p.nextLastViewedSync(now, cluster.JobMetadata{}))
+
+	p.conf.LastViewedSyncIntervalMinutes = 60
+	assert.Zero(t, p.nextLastViewedSync(now, cluster.JobMetadata{}))
+	assert.Equal(t, 50*time.Minute, p.nextLastViewedSync(now, cluster.JobMetadata{LastFinished: now.Add(-10 * time.Minute)}))
+}
+
+func TestRefreshInferredReads(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	// Disabled by default
+	p.refreshInferredReads("channel1")
+
+	p.conf.InferReadsFromChannelViews = true
+	api.On("GetChannelMembers", "channel1", 0, maxPerPage).Return(model.ChannelMembers{
+		{ChannelId: "channel1", UserId: "mobile", LastViewedAt: 400},
+	}, nil).Once()
+
+	p.refreshInferredReads("channel1")
+	// Throttled
+	p.refreshInferredReads("channel1")
+	p.inferredRefreshed.wait()
+
+	readers, err := p.store.GetPostReaderIDs("post1", "channel1", 300)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mobile"}, readers)
+}
+
+func TestRefreshInferredReadsStopsWithPlugin(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+	p.conf.InferReadsFromChannelViews = true
+	p.lifetime, p.stopLifetime = context.WithCancel(context.Background())
+
+	// The plugin stops while the first page is fetched; the refresh goes no
+	// further than that page
+	members := make(model.ChannelMembers, maxPerPage)
+	for i := range members {
+		members[i] = model.ChannelMember{ChannelId: "channel1", UserId: fmt.Sprintf("user%d", i), LastViewedAt: 400}
+	}
+	api.On("GetChannelMembers", "channel1", 0, maxPerPage).Return(members, nil).Run(func(mock.Arguments) {
+		p.stopLifetime()
+	}).Once()
+
+	p.refreshInferredReads("channel1")
+	p.inferredRefreshed.wait()
+}
+
+func TestRefreshThrottle(t *testing.T) {
+	var throttle refreshThrottle
+	now := time.Now()
+
+	assert.True(t, throttle.due("channel1", now))
+	assert.False(t, throttle.due("channel1", now.Add(inferredReadsRefresh-time.Second)))
+	assert.True(t, throttle.due("channel2", now))
+	assert.True(t, throttle.due("channel1", now.Add(inferredReadsRefresh)))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// Legal hold audit actions.
+const (
+	legalHoldCreate = "create"
+	legalHoldUpdate = "update"
+	legalHoldDelete = "delete"
+)
+
+var errLegalHoldNotFound = errors.New("legal hold not found")
+
+// LegalHoldRequest is the body of the legal hold create and update endpoints.
+type LegalHoldRequest struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	Reason    string `json:"reason"`
+}
+
+// IsValid checks that the request names exactly one channel or user.
+func (r *LegalHoldRequest) IsValid() error {
+	r.Reason = strings.TrimSpace(r.Reason)
+
+	if (r.ChannelID == "") == (r.UserID == "") {
+		return fmt.Errorf("exactly one of channel_id and user_id is required")
+	}
+	if r.ChannelID != "" && !model.IsValidId(r.ChannelID) {
+		return fmt.Errorf("invalid channel_id")
+	}
+	if r.UserID != "" && !model.IsValidId(r.UserID) {
+		return fmt.Errorf("invalid user_id")
+	}
+	if r.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	return nil
+}
+
+// createLegalHold places a new hold on behalf of actorID.
+func (p *Plugin) createLegalHold(actorID string, req LegalHoldRequest) (*store.LegalHold, error) {
+	now := time.Now().UnixMilli()
+	hold := store.LegalHold{
+		ID:        model.NewId(),
+		ChannelID: req.ChannelID,
+		UserID:    req.UserID,
+		Reason:    req.Reason,
+		CreatedBy: actorID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := p.changeLegalHold(actorID, legalHoldCreate, hold); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// updateLegalHold replaces the target and reason of an existing hold.
+func (p *Plugin) updateLegalHold(actorID, holdID string, req LegalHoldRequest) (*store.LegalHold, error) {
+	hold, err := p.store.GetLegalHold(holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, errLegalHoldNotFound
+	}
+
+	hold.ChannelID = req.ChannelID
+	hold.UserID = req.UserID
+	hold.Reason = req.Reason
+	hold.UpdatedAt = time.Now().UnixMilli()
+	if err := p.changeLegalHold(actorID, legalHoldUpdate, *hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// deleteLegalHold releases a hold. Purges resume on the next retention run.
+func (p *Plugin) deleteLegalHold(actorID, holdID string) error {
+	hold, err := p.store.GetLegalHold(holdID)
+	if err != nil {
+		return err
+	}
+	if hold == nil {
+		return errLegalHoldNotFound
+	}
+	return p.changeLegalHold(actorID, legalHoldDelete, *hold)
+}
+
+// changeLegalHold writes a hold change and its audit entry in one
+// transaction, then logs it. Audit log lines ignore LogLevel.
+func (p *Plugin) changeLegalHold(actorID, action string, hold store.LegalHold) error {
+	details, err := json.Marshal(hold)
+	if err != nil {
+		return err
+	}
+
+	entry := store.LegalHoldAudit{
+		ID:        model.NewId(),
+		HoldID:    hold.ID,
+		Action:    action,
+		ActorID:   actorID,
+		Details:   string(details),
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	tx, err := p.store.BeginTx()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if action == legalHoldDelete {
+		_, err = p.store.DeleteLegalHoldTx(tx, hold.ID)
+	} else {
+		err = p.store.SaveLegalHoldTx(tx, hold)
+	}
+	if err == nil {
+		err = p.store.AddLegalHoldAuditTx(tx, entry)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit legal hold change")
+	}
+
+	p.API.LogInfo("[Audit] Legal hold changed",
+		"action", action,
+		"hold_id", hold.ID,
+		"actor_id", actorID,
+		"channel_id", hold.ChannelID,
+		"user_id", hold.UserID,
+		"reason", hold.Reason,
+	)
+	return nil
+}
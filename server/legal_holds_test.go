@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegalHoldEndpoints(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Mattermost-User-Id", "admin")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w
+	}
+
+	channelID, userID := model.NewId(), model.NewId()
+	for _, body := range []string{
+		`{"reason": "no target"}`,
+		`{"channel_id": "` + channelID + `", "user_id": "` + userID + `", "reason": "both"}`,
+		`{"channel_id": "not-an-id", "reason": "bad id"}`,
+		`{"channel_id": "` + channelID + `"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v1/admin/legal_holds", body).Code, body)
+	}
+
+	w := serve(http.MethodPost, "/api/v1/admin/legal_holds", `{"channel_id": "`+channelID+`", "reason": "case 42"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var hold store.LegalHold
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&hold))
+	assert.Equal(t, channelID, hold.ChannelID)
+	assert.Equal(t, "admin", hold.CreatedBy)
+
+	w = serve(http.MethodPut, "/api/v1/admin/legal_holds/"+hold.ID, `{"user_id": "`+userID+`", "reason": "case 43"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(http.MethodGet, "/api/v1/admin/legal_holds", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var holds []store.LegalHold
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&holds))
+	require.Len(t, holds, 1)
+	assert.Equal(t, userID, holds[0].UserID)
+	assert.Empty(t, holds[0].ChannelID)
+	assert.Equal(t, "case 43", holds[0].Reason)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/v1/admin/legal_holds/"+hold.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/v1/admin/legal_holds/"+hold.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/v1/admin/legal_holds/"+hold.ID, "").Code)
+
+	// Every change is audited, newest first
+	w = serve(http.MethodGet, "/api/v1/admin/legal_holds/audit", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var audit []store.LegalHoldAudit
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&audit))
+	require.Len(t, audit, 3)
+	actions := map[string]bool{}
+	for _, entry := range audit {
+		assert.Equal(t, hold.ID, entry.HoldID)
+		assert.Equal(t, "admin", entry.ActorID)
+		actions[entry.Action] = true
+	}
+	assert.Equal(t, map[string]bool{legalHoldCreate: true, legalHoldUpdate: true, legalHoldDelete: true}, actions)
+}
+
+func TestRetentionSkipsLegalHolds(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	allowKV(api)
+	setupRetention(t, p)
+
+	heldChannel, heldUser := model.NewId(), model.NewId()
+	_, err := p.createLegalHold("admin", LegalHoldRequest{ChannelID: heldChannel, Reason: "case 1"})
+	require.NoError(t, err)
+	_, err = p.createLegalHold("admin", LegalHoldRequest{UserID: heldUser, Reason: "case 2"})
+	require.NoError(t, err)
+
+	old := time.Now().AddDate(0, 0, -31).UnixMilli()
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "user1", ChannelID: heldChannel, Timestamp: old}))
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post2", UserID: heldUser, ChannelID: "channel1", Timestamp: old}))
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post3", UserID: "user1", ChannelID: "channel1", Timestamp: old}))
+
+	run, err := p.runRetention(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, run.ReadEventsDeleted)
+
+	events, err := p.store.GetByChannel(heldChannel, "")
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	events, err = p.store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, heldUser, events[0].UserID)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// channelIDFromRequest returns the channel a request is about, taken from the
+// route or, for the legacy query-string endpoints, from ?channel_id=.
+func channelIDFromRequest(r *http.Request) string {
+	if channelID := mux.Vars(r)["channelID"]; channelID != "" {
+		return channelID
+	}
+	return r.URL.Query().Get("channel_id")
+}
+
+// ChannelReadRequired only lets the request through when the user may read
+// the channel it targets. Private channels, DMs and group messages are
+// therefore limited to their members.
+func (p *Plugin) ChannelReadRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("Mattermost-User-Id")
+		channelID := channelIDFromRequest(r)
+		if channelID == "" {
+			http.Error(w, "Missing channel ID", http.StatusBadRequest)
+			return
+		}
+
+		if !p.canReadChannel(userID, channelID) {
+			p.logError("[API] Forbidden channel access", "path", r.URL.Path, "user_id", userID, "channel_id", channelID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SystemAdminRequired limits the request to users who can manage the system.
+func (p *Plugin) SystemAdminRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("Mattermost-User-Id")
+		if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+			p.logError("[API] Forbidden admin access", "path", r.URL.Path, "user_id", userID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canReadChannel reports whether userID holds read_channel on channelID.
+func (p *Plugin) canReadChannel(userID, channelID string) bool {
+	return p.API.HasPermissionToChannel(userID, channelID, model.PermissionReadChannel)
+}
+
+// isChannelMember reports whether userID is a member of channelID. Marking a
+// post read requires membership rather than read_channel, so admins cannot
+// leave receipts in channels they only have read access to.
+func (p *Plugin) isChannelMember(userID, channelID string) bool {
+	member, appErr := p.API.GetChannelMember(channelID, userID)
+	return appErr == nil && member != nil
+}
+
+// canListPostReaders reports whether userID may see who read post in a large
+// channel: its author and system admins.
+func (p *Plugin) canListPostReaders(userID string, post *model.Post) bool {
+	return userID == post.UserId || p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+}
+
+// canManageChannelReceipts reports whether userID may turn receipts on or
+// off in channel: the channel, team and system admins of public and private
+// channels, and any member of a DM or group message, which have no admins.
+// The channel properties permissions are not enough, since the default
+// scheme gives them to every member.
+func (p *Plugin) canManageChannelReceipts(userID string, channel *model.Channel) bool {
+	switch channel.Type {
+	case model.ChannelTypeOpen, model.ChannelTypePrivate:
+		return p.API.HasPermissionToChannel(userID, channel.Id, model.PermissionManageChannelRoles)
+	default:
+		return p.isChannelMember(userID, channel.Id)
+	}
+}
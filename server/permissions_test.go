@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelQueriesRequireReadChannel(t *testing.T) {
+	paths := []string{
+		"/api/v1/channel/private-channel/readers?since=0",
+		"/api/v1/channel/private-channel/reads",
+		"/api/v1/receipts?channel_id=private-channel",
+		"/api/v1/read/channel/private-channel?since=0",
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			p, api := setupTestPlugin(t)
+			api.On("HasPermissionToChannel", "outsider", "private-channel", model.PermissionReadChannel).Return(false)
+			api.On("HasPermissionToChannel", "member", "private-channel", model.PermissionReadChannel).Return(true)
+			allowOpenChannels(api, "private-channel")
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Mattermost-User-Id", "outsider")
+			w := httptest.NewRecorder()
+			p.ServeHTTP(nil, w, req)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			req = httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Mattermost-User-Id", "member")
+			w = httptest.NewRecorder()
+			p.ServeHTTP(nil, w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestReceiptsRequiresChannelID(t *testing.T) {
+	p, api := setupTestPlugin(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/receipts", nil)
+	req.Header.Set("Mattermost-User-Id", "member")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	api.AssertNotCalled(t, "HasPermissionToChannel")
+}
+
+func TestReadReceiptRequiresMembership(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetPost", "post-id").Return(&model.Post{Id: "post-id", ChannelId: "dm-channel", UserId: "author"}, nil)
+	api.On("GetChannelMember", "dm-channel", "outsider").Return(nil, model.NewAppError("GetChannelMember", "app.channel.get_member.missing.app_error", nil, "", http.StatusNotFound))
+
+	serve := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader([]byte(body)))
+		req.Header.Set("Mattermost-User-Id", "outsider")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(`{"message_id":"post-id"}`))
+
+	// Naming a channel the user belongs to does not help
+	assert.Equal(t, http.StatusBadRequest, serve(`{"message_id":"post-id","channel_id":"own-channel"}`))
+
+	events, err := p.store.GetByChannel("dm-channel", "")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestDebugEndpointsRequireSystemAdmin(t *testing.T) {
+	for _, path := range []string{"/api/v1/debug/db", "/api/v1/debug/metrics"} {
+		t.Run(path, func(t *testing.T) {
+			p, api := setupTestPlugin(t)
+			api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Mattermost-User-Id", "user")
+			w := httptest.NewRecorder()
+			p.ServeHTTP(nil, w, req)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	}
+
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/debug/db", nil)
+	req.Header.Set("Mattermost-User-Id", "admin")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCanManageChannelReceipts(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	private := &model.Channel{Id: "private-channel", Type: model.ChannelTypePrivate}
+	dm := &model.Channel{Id: "dm-channel", Type: model.ChannelTypeDirect}
+	api.On("HasPermissionToChannel", "member", "private-channel", model.PermissionManagePrivateChannelProperties).Return(true).Maybe()
+	api.On("HasPermissionToChannel", "member", "private-channel", model.PermissionManageChannelRoles).Return(false)
+	api.On("HasPermissionToChannel", "channel-admin", "private-channel", model.PermissionManageChannelRoles).Return(true)
+	api.On("GetChannelMember", "dm-channel", "member").Return(&model.ChannelMember{ChannelId: "dm-channel", UserId: "member"}, nil)
+	api.On("GetChannelMember", "dm-channel", "outsider").Return(nil, model.NewAppError("GetChannelMember", "app.channel.get_member.missing.app_error", nil, "", http.StatusNotFound))
+
+	assert.False(t, p.canManageChannelReceipts("member", private))
+	assert.True(t, p.canManageChannelReceipts("channel-admin", private))
+	assert.True(t, p.canManageChannelReceipts("member", dm))
+	assert.False(t, p.canManageChannelReceipts("outsider", dm))
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -19,15 +20,31 @@ import (
 type Plugin struct {
 	plugin.MattermostPlugin
 
-	store            store.ReceiptStore // backing DB store
-	readReceiptStore *ReadReceiptStore  // helper wrapper
+	store            store.ReceiptStore  // backing DB store
+	readReceiptStore *ReadReceiptStore   // helper wrapper
+	writeQueue       *readEventBatcher   // write-behind queue for read events
+	readersQueue     *readersBroadcaster // merges channel readers events, see broadcaster.go
+	readerCache      *store.CachedStore  // wraps store when reader caching is on, see reader_cache.go
+	retention        *retention          // scheduled purge, see retention.go
+	lastViewedSync   *lastViewedSync     // scheduled LastViewedAt sync, see last_viewed_sync.go
+
+	inferredRefreshed refreshThrottle      // last on-demand refresh of inferred reads per channel
+	channelSizes      channelSizeCache     // member counts, see large_channels.go
+	readCounts        readCountThrottle    // pending read count broadcasts in large channels
+	receiptCounts     receiptCountThrottle // pending counts events to post authors
 
 	// Add connection tracking
-	isConnected  bool
-	dbConnection *sql.DB
+	isConnected        bool
+	dbConnection       *sql.DB
+	replicaConnections []*sql.DB // read-only pools, may be empty
 
 	conf   *Configuration
 	stopCh chan struct{}
+
+	// lifetime is cancelled when the plugin stops, ending the background
+	// work that is not tied to a request
+	lifetime     context.Context
+	stopLifetime context.CancelFunc
 }
 
 func (p *Plugin) getConfiguration() *Configuration {
@@ -76,14 +93,196 @@ func (p *Plugin) OnActivate() error {
 		return nil
 	}
 
-	// Close any existing connection before re-initializing
-	if p.dbConnection != nil {
-		if err := p.dbConnection.Close(); err != nil {
-			p.logError("[Plugin] Error closing existing database connection:", "error", err.Error())
+	// Stop whatever an earlier activation started before re-initializing
+	p.shutdown()
+
+	settings, err := p.getDatabaseSettings()
+	if err != nil {
+		return err
+	}
+
+	db, err := p.openDatabase(settings)
+	if err != nil {
+		return err
+	}
+	p.dbConnection = db
+	p.replicaConnections = p.openReplicas(settings)
+
+	// Leave nothing running when activation fails part way
+	if err := p.start(settings.driverName); err != nil {
+		p.shutdown()
+		return err
+	}
+
+	p.API.LogWarn("[DEBUG-RR] Plugin activation completed successfully")
+	return nil
+}
+
+// start sets up the store on the open database and starts the background
+// work.
+func (p *Plugin) start(driverName string) error {
+	p.lifetime, p.stopLifetime = context.WithCancel(context.Background())
+
+	// Initialize store with new connection
+	switch driverName {
+	case "postgres":
+		p.store = store.NewPostgresStore(p.dbConnection)
+	case "mysql":
+		p.store = store.NewMySQLStore(p.dbConnection)
+	case store.DialectSQLite:
+		p.store = store.NewSQLiteStore(p.dbConnection)
+	default:
+		return errors.Errorf("unsupported database driver: %s", driverName)
+	}
+
+	// Route read-only queries to replicas when any are configured
+	if router, ok := p.store.(interface{ SetReplicas(...*sql.DB) }); ok {
+		router.SetReplicas(p.replicaConnections...)
+	}
+
+	// Apply pending schema migrations; refuses to start if the DB is ahead of this build
+	if err := p.store.Initialize(); err != nil {
+		return errors.Wrap(err, "failed to migrate database schema")
+	}
+	p.cacheReaders()
+
+	p.readReceiptStore = &ReadReceiptStore{Store: p.store}
+	p.startWriteQueue()
+	p.startReadersQueue()
+	p.isConnected = true
+
+	// Purge expired receipts nightly; the job runs on one node at a time
+	if err := p.startRetention(); err != nil {
+		return err
+	}
+	if err := p.startLastViewedSync(); err != nil {
+		return err
+	}
+	if err := p.registerCommands(); err != nil {
+		return err
+	}
+
+	// Start health check goroutine
+	p.stopCh = make(chan struct{})
+	go p.runHealthCheck(p.stopCh)
+	return nil
+}
+
+// shutdown stops the background work and closes the database, undoing a
+// full or partial activation.
+func (p *Plugin) shutdown() {
+	if p.stopLifetime != nil {
+		p.stopLifetime()
+		p.stopLifetime = nil
+	}
+
+	// Stop the cleanup goroutine
+	if p.stopCh != nil {
+		close(p.stopCh)
+		p.stopCh = nil
+	}
+
+	// Stop background work before the pools go away
+	p.stopLastViewedSync()
+	p.stopRetention()
+	p.stopWriteQueue()
+	p.stopReadersQueue()
+	p.readCounts.stop()
+	p.receiptCounts.stop()
+	p.inferredRefreshed.wait()
+
+	// Close the database connections if they exist
+	p.closeDatabase()
+	p.store = nil
+	p.readReceiptStore = nil
+	p.readerCache = nil
+	p.isConnected = false
+}
+
+// startWriteQueue starts the write-behind queue for the current store.
+func (p *Plugin) startWriteQueue() {
+	conf := p.getConfiguration()
+	queue := newReadEventBatcher(
+		p.store,
+		conf.WriteBatchSize,
+		time.Duration(conf.WriteFlushIntervalMs)*time.Millisecond,
+		conf.WriteQueueCapacity,
+	)
+	queue.logError = p.logError
+	queue.Start()
+	p.writeQueue = queue
+}
+
+// stopWriteQueue drains pending read events into the store.
+func (p *Plugin) stopWriteQueue() {
+	if p.writeQueue == nil {
+		return
+	}
+	if err := p.writeQueue.Stop(); err != nil {
+		p.logError("[Plugin] Failed to drain read event queue", "error", err.Error())
+	}
+	p.writeQueue = nil
+}
+
+// startReadersQueue starts merging channel readers events.
+func (p *Plugin) startReadersQueue() {
+	interval := time.Duration(p.getConfiguration().ReadersBroadcastIntervalMs) * time.Millisecond
+	p.readersQueue = newReadersBroadcaster(interval, realClock{}, p.PublishChannelReadersAdded)
+}
+
+// stopReadersQueue publishes the readers still waiting for a broadcast.
+func (p *Plugin) stopReadersQueue() {
+	if p.readersQueue == nil {
+		return
+	}
+	p.readersQueue.Stop()
+	p.readersQueue = nil
+}
+
+// queueReaders announces new readers, as a map of post ID to user IDs,
+// merged with other reads of the channel when the broadcaster is running.
+func (p *Plugin) queueReaders(channelID string, added map[string][]string) {
+	if p.readersQueue == nil {
+		p.PublishChannelReadersAdded(channelID, added)
+		return
+	}
+	for postID, userIDs := range added {
+		p.readersQueue.Add(channelID, postID, userIDs...)
+	}
+}
+
+// saveReadEvent queues event for a batched write, or writes it directly
+// when the queue is not running. Either way the reader's channel read is
+// updated in the same transaction.
+func (p *Plugin) saveReadEvent(event store.ReadEvent) error {
+	if p.writeQueue != nil {
+		return p.writeQueue.Enqueue(event)
+	}
+	return writeReadEvents(p.store, []store.ReadEvent{event})
+}
+
+// databaseSettings describes where receipts are stored.
+type databaseSettings struct {
+	driverName string
+	dataSource string
+	replicas   []string // read-replica DSNs, may be empty
+}
+
+// getDatabaseSettings resolves the receipts database, in order of preference:
+// a dedicated SQLite file, a dedicated plugin-owned DSN, or the Mattermost
+// database together with its configured read replicas.
+func (p *Plugin) getDatabaseSettings() (*databaseSettings, error) {
+	conf := p.getConfiguration()
+	if conf.SQLiteFile != "" {
+		return &databaseSettings{driverName: store.DialectSQLite, dataSource: conf.SQLiteFile}, nil
+	}
+
+	if conf.DatabaseDriver != "" {
+		settings := &databaseSettings{driverName: conf.DatabaseDriver, dataSource: conf.DatabaseDataSource}
+		if conf.DatabaseReplicaDataSource != "" {
+			settings.replicas = []string{conf.DatabaseReplicaDataSource}
 		}
-		p.dbConnection = nil
-		p.store = nil
-		p.isConnected = false
+		return settings, nil
 	}
 
 	// Get database configuration with retries
@@ -98,18 +297,85 @@ func (p *Plugin) OnActivate() error {
 	}
 
 	if config == nil || config.SqlSettings.DriverName == nil {
-		return errors.New("failed to get Mattermost config after retries")
+		return nil, errors.New("failed to get Mattermost config after retries")
 	}
 
-	driverName := *config.SqlSettings.DriverName
-	p.logInfo("[Plugin] Using database driver", "driver", driverName)
-
 	if config.SqlSettings.DataSource == nil || *config.SqlSettings.DataSource == "" {
-		return errors.New("database connection string not configured")
+		return nil, errors.New("database connection string not configured")
+	}
+	if *config.SqlSettings.DataSource == model.FakeSetting {
+		return nil, errors.New("Mattermost database connection string is masked; configure a dedicated database for the plugin instead")
 	}
 
-	dsn := *config.SqlSettings.DataSource
+	settings := &databaseSettings{
+		driverName: *config.SqlSettings.DriverName,
+		dataSource: *config.SqlSettings.DataSource,
+	}
+	for _, dsn := range config.SqlSettings.DataSourceReplicas {
+		if dsn != "" && dsn != model.FakeSetting {
+			settings.replicas = append(settings.replicas, dsn)
+		}
+	}
+	return settings, nil
+}
+
+// openDatabase opens the primary pool described by settings.
+func (p *Plugin) openDatabase(settings *databaseSettings) (*sql.DB, error) {
+	p.logInfo("[Plugin] Using database driver", "driver", settings.driverName, "replicas", len(settings.replicas))
 
+	if settings.driverName == store.DialectSQLite {
+		db, err := store.OpenSQLite(settings.dataSource)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open SQLite database")
+		}
+		return db, nil
+	}
+
+	return p.connect(settings.driverName, settings.dataSource)
+}
+
+// openReplicas opens the read-replica pools. A replica that cannot be reached
+// is skipped rather than failing activation; reads then use the primary.
+func (p *Plugin) openReplicas(settings *databaseSettings) []*sql.DB {
+	var replicas []*sql.DB
+	for i, dsn := range settings.replicas {
+		db, err := sql.Open(settings.driverName, dsn)
+		if err == nil {
+			err = db.Ping()
+		}
+		if err != nil {
+			p.logError("[Plugin] Skipping unreachable read replica", "replica", i, "error", err.Error())
+			if db != nil {
+				db.Close()
+			}
+			continue
+		}
+		db.SetMaxOpenConns(5)
+		db.SetMaxIdleConns(2)
+		db.SetConnMaxLifetime(time.Hour)
+		replicas = append(replicas, db)
+	}
+	return replicas
+}
+
+// closeDatabase closes the primary and replica pools.
+func (p *Plugin) closeDatabase() {
+	if p.dbConnection != nil {
+		if err := p.dbConnection.Close(); err != nil {
+			p.logError("[Plugin] Error closing database connection:", "error", err.Error())
+		}
+		p.dbConnection = nil
+	}
+	for _, replica := range p.replicaConnections {
+		if err := replica.Close(); err != nil {
+			p.logError("[Plugin] Error closing replica connection:", "error", err.Error())
+		}
+	}
+	p.replicaConnections = nil
+}
+
+// connect opens a connection pool, retrying a few times before giving up.
+func (p *Plugin) connect(driverName, dsn string) (*sql.DB, error) {
 	// Open database with retry logic
 	var db *sql.DB
 	var err error
@@ -117,45 +383,25 @@ func (p *Plugin) OnActivate() error {
 		db, err = sql.Open(driverName, dsn)
 		if err == nil {
 			// Test the connection
-			if err := db.Ping(); err == nil {
+			if err = db.Ping(); err == nil {
 				break
 			}
 			db.Close()
 		}
-		p.logError("[Plugin] Database connection attempt %d failed: %v", attempts+1, err)
+		p.logError("[Plugin] Database connection attempt failed", "attempt", attempts+1, "error", err.Error())
 		time.Sleep(time.Second)
 	}
 
 	if err != nil {
-		return errors.Wrap(err, "failed to establish database connection after retries")
+		return nil, errors.Wrap(err, "failed to establish database connection after retries")
 	}
 
-	p.dbConnection = db
-
 	// Configure connection pool
 	db.SetMaxOpenConns(5)
 	db.SetMaxIdleConns(2)
 	db.SetConnMaxLifetime(time.Hour)
 
-	// Initialize store with new connection
-	switch driverName {
-	case "postgres":
-		p.store = store.NewPostgresStore(db)
-	case "mysql":
-		p.store = store.NewMySQLStore(db)
-	default:
-		return errors.Errorf("unsupported database driver: %s", driverName)
-	}
-
-	p.readReceiptStore = &ReadReceiptStore{Store: p.store}
-	p.isConnected = true
-
-	// Start health check goroutine
-	p.stopCh = make(chan struct{})
-	go p.runHealthCheck(p.stopCh)
-
-	p.API.LogWarn("[DEBUG-RR] Plugin activation completed successfully")
-	return nil
+	return db, nil
 }
 
 // Add health check routine
@@ -213,8 +459,9 @@ func (p *Plugin) GetChannelReceipts(channelID, excludeUserID string) ([]store.Re
 	return events, nil
 }
 
+// CleanupOldReceipts runs a retention pass immediately, in bounded batches.
 func (p *Plugin) CleanupOldReceipts() error {
-	if err := p.store.CleanupOlderThan(p.getConfiguration().RetentionDays); err != nil {
+	if _, err := p.runRetention(context.Background()); err != nil {
 		p.logDebug("Failed to cleanup old receipts",
 			"retentionDays", p.getConfiguration().RetentionDays,
 			"error", err.Error())
@@ -225,32 +472,18 @@ func (p *Plugin) CleanupOldReceipts() error {
 
 func (p *Plugin) OnDeactivate() error {
 	p.logDebug("[Plugin] Deactivating read receipts plugin...")
-
-	// Stop the cleanup goroutine
-	if p.stopCh != nil {
-		close(p.stopCh)
-		p.stopCh = nil
-	}
-
-	// Close the database connection if it exists
-	if p.dbConnection != nil {
-		if err := p.dbConnection.Close(); err != nil {
-			p.logError("[Plugin] Error closing database connection:", "error", err.Error())
-		}
-		p.dbConnection = nil
-	}
-
+	p.shutdown()
 	return nil
 }
 
 func (p *Plugin) logDebug(msg string, kv ...interface{}) {
-	if p.conf.LogLevel == "debug" {
+	if p.getConfiguration().LogLevel == "debug" {
 		p.API.LogDebug(msg, kv...)
 	}
 }
 
 func (p *Plugin) logInfo(msg string, kv ...interface{}) {
-	if p.conf.LogLevel == "info" || p.conf.LogLevel == "debug" {
+	if level := p.getConfiguration().LogLevel; level == "info" || level == "debug" {
 		p.API.LogInfo(msg, kv...)
 	}
 }
@@ -272,13 +505,18 @@ func (p *Plugin) MessageHasBeenPosted(_ *plugin.Context, post *model.Post) {
 		return
 	}
 
+	if !p.receiptsAllowed(post.ChannelId) {
+		return
+	}
+
 	// 1) Persist
-	_ = p.readReceiptStore.MarkPostAsRead(post.Id, post.UserId)
-
-	// 2) Broadcast channel-level update (single-element array)
-	p.API.PublishWebSocketEvent(EventChannelReaders, map[string]interface{}{
-		"ChannelID":  post.ChannelId,
-		"LastPostID": post.Id,
-		"UserIDs":    []string{post.UserId},
-	}, &model.WebsocketBroadcast{ChannelId: post.ChannelId})
+	_ = p.readReceiptStore.MarkPostAsRead(post.Id, post.ChannelId, post.UserId)
+
+	// 2) Announce the sender as a reader, unless they hide their receipts or
+	// the channel only gets counts
+	privacy := p.getBroadcastPrivacy()
+	if privacy == nil || privacy.isHidden(post.UserId) || p.isLargeChannel(post.ChannelId) {
+		return
+	}
+	p.queueReaders(post.ChannelId, map[string][]string{post.Id: {post.UserId}})
 }
@@ -3,68 +3,287 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
-	"time"
 
-	"github.com/arg/mattermost-readreceipts/server/types"
-	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-// MockPlugin is a mock implementation of Plugin for testing.
-type MockPlugin struct {
-	Plugin
-	mock.Mock
+// allowLogs lets the mock API accept any log call, whatever its arity.
+func allowLogs(api *plugintest.API) {
+	for _, level := range []string{"LogDebug", "LogInfo", "LogWarn", "LogError"} {
+		for n := 1; n <= 21; n += 2 {
+			args := make([]interface{}, n)
+			for i := range args {
+				args[i] = mock.Anything
+			}
+			api.On(level, args...).Maybe()
+		}
+	}
+}
+
+// allowKV lets the mock API accept the KV calls made by cluster mutexes and
+// jobs. Every lock succeeds and the store always looks empty.
+func allowKV(api *plugintest.API) {
+	api.On("KVSetWithOptions", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(true, nil).Maybe()
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil).Maybe()
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil).Maybe()
+}
+
+// fakeHiddenReaders keeps the hidden readers KV key in memory, so privacy
+// settings behave as they would against a real KV store.
+func fakeHiddenReaders(api *plugintest.API) {
+	var value []byte
+	api.On("KVGet", hiddenReadersKey).Return(func(string) []byte { return value }, nil).Maybe()
+	api.On("KVCompareAndSet", hiddenReadersKey, mock.Anything, mock.Anything).Return(func(_ string, oldValue, newValue []byte) bool {
+		if !bytes.Equal(oldValue, value) {
+			return false
+		}
+		value = newValue
+		return true
+	}, nil).Maybe()
+}
+
+// allowOpenChannels makes GetChannel return an open channel for each ID.
+func allowOpenChannels(api *plugintest.API, channelIDs ...string) {
+	for _, channelID := range channelIDs {
+		api.On("GetChannel", channelID).Return(&model.Channel{Id: channelID, Type: model.ChannelTypeOpen}, nil).Maybe()
+	}
+}
+
+// setupTestPlugin returns a plugin backed by a throwaway SQLite database.
+func setupTestPlugin(t *testing.T) (*Plugin, *plugintest.API) {
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "receipts.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s := store.NewSQLiteStore(db)
+	require.NoError(t, s.Initialize())
+
+	api := &plugintest.API{}
+	allowLogs(api)
+	fakeHiddenReaders(api)
+
+	p := &Plugin{
+		store:            s,
+		readReceiptStore: &ReadReceiptStore{Store: s},
+		conf:             getDefaultConfiguration(),
+	}
+	// Throttled counts events go out when a test advances these clocks
+	p.receiptCounts.clock = &fakeClock{}
+	p.readCounts.clock = &fakeClock{}
+	p.SetAPI(api)
+	return p, api
 }
 
-func (m *MockPlugin) SetAPI(api plugin.API) {
-	m.API = api
+// sendReceiptCounts fires the counts events p has queued for authors.
+func sendReceiptCounts(p *Plugin) {
+	p.receiptCounts.clock.(*fakeClock).Advance(receiptCountsInterval)
 }
 
 func TestHandleReadReceipt(t *testing.T) {
-	// Create a mock plugin.
-	mockPlugin := new(MockPlugin)
-
-	// Initialize the mock API.
-	mockAPI := &plugintest.API{}
-	mockPlugin.SetAPI(mockAPI)
-
-	// Set up expectations for the mock API.
-	mockAPI.On("LogInfo", "Received read receipt request").Return(nil)
-	mockAPI.On("LogInfo", "Read event stored successfully", "message_id", "sample-message-id", "user_id", "sample-user-id").Return(nil)
-	mockAPI.On("LogInfo", "WebSocket event broadcasted", "payload", mock.Anything).Return(nil)
-	mockAPI.On(
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	post := &model.Post{Id: "sample-message-id", ChannelId: "channel-id", UserId: "author-id"}
+	api.On("GetPost", post.Id).Return(post, nil)
+	api.On("GetChannel", "channel-id").Return(&model.Channel{Id: "channel-id", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannelMember", "channel-id", "sample-user-id").Return(&model.ChannelMember{ChannelId: "channel-id", UserId: "sample-user-id"}, nil)
+	api.On(
 		"PublishWebSocketEvent",
-		"read_receipt", // event name
-		mock.AnythingOfType("map[string]interface {}"), // payload
-		mock.AnythingOfType("*model.WebsocketBroadcast"),
-	).Return(nil)
-
-	// Create a sample read event request.
-	readEvent := types.ReadEvent{
-		MessageID: "sample-message-id",
-		UserID:    "sample-user-id",
-		Timestamp: time.Now().Unix(),
-	}
+		WebSocketEventReadReceipt,
+		mock.AnythingOfType("map[string]interface {}"),
+		&model.WebsocketBroadcast{UserId: post.UserId},
+	).Return().Once()
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventChannelReaders,
+		map[string]interface{}{
+			"ChannelID":    "channel-id",
+			"AddedReaders": map[string]interface{}{post.Id: []string{"sample-user-id"}},
+		},
+		&model.WebsocketBroadcast{ChannelId: "channel-id"},
+	).Return().Once()
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReceiptCounts,
+		map[string]interface{}{"MessageID": post.Id, "ChannelID": "channel-id", "DeliveredCount": 1, "ReadCount": 1},
+		&model.WebsocketBroadcast{UserId: post.UserId},
+	).Return().Once()
+
 	requestBody, _ := json.Marshal(map[string]string{
-		"message_id": readEvent.MessageID,
+		"message_id": post.Id,
 	})
-
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader(requestBody))
-	req.Header.Set("Mattermost-User-ID", readEvent.UserID)
+	req.Header.Set("Mattermost-User-ID", "sample-user-id")
 	w := httptest.NewRecorder()
 
-	// Call the handler.
-	http.HandlerFunc(mockPlugin.HandleReadReceipt).ServeHTTP(w, req)
+	p.ServeHTTP(nil, w, req)
+	sendReceiptCounts(p)
 
-	// Verify the response.
 	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
 
-	// Assert expectations for WebSocket events.
-	assert.NotZero(t, readEvent.Timestamp)
-	mockAPI.AssertExpectations(t)
+	events, err := p.store.GetByChannel("channel-id", "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "sample-user-id", events[0].UserID)
+	assert.Equal(t, post.Id, events[0].MessageID)
+	assert.NotZero(t, events[0].Timestamp)
+
+	reads, err := p.store.GetChannelReads("channel-id")
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Equal(t, post.Id, reads[0].LastPostID)
+	assert.Equal(t, events[0].Timestamp, reads[0].LastSeenAt)
+}
+
+func TestHandleReadReceiptRequiresUser(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader([]byte(`{"message_id":"x"}`)))
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(nil, w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+}
+
+func TestActivateWithSQLiteFile(t *testing.T) {
+	api := &plugintest.API{}
+	allowLogs(api)
+
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*main.Configuration")).Run(func(args mock.Arguments) {
+		cfg := args.Get(0).(*Configuration)
+		*cfg = *getDefaultConfiguration()
+		cfg.SQLiteFile = path
+	}).Return(nil)
+
+	allowKV(api)
+	api.On("RegisterCommand", mock.MatchedBy(func(cmd *model.Command) bool { return cmd.Trigger == ackCommandTrigger })).Return(nil)
+
+	// The maintenance job may run as soon as the plugin activates
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(&model.Channel{}, nil).Maybe()
+	api.On("GetPost", mock.AnythingOfType("string")).Return(&model.Post{}, nil).Maybe()
+	api.On("GetUsers", mock.Anything).Return([]*model.User{}, nil).Maybe()
+	api.On("PublishPluginClusterEvent", mock.MatchedBy(func(ev model.PluginClusterEvent) bool { return ev.Id == readerCacheClusterEvent }), mock.Anything).Return(nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	require.NoError(t, p.OnActivate())
+	t.Cleanup(func() { require.NoError(t, p.OnDeactivate()) })
+
+	require.NotNil(t, p.readerCache)
+	_, isSQLite := p.readerCache.ReceiptStore.(*store.SQLiteStore)
+	assert.True(t, isSQLite)
+	api.AssertNotCalled(t, "GetUnsanitizedConfig")
+
+	require.NoError(t, p.readReceiptStore.MarkPostAsRead("post-id", "channel-id", "user-id"))
+	readers, err := p.store.GetReadersSince("channel-id", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-id"}, readers)
+}
+
+func TestReactivationTearsDown(t *testing.T) {
+	api := &plugintest.API{}
+	allowLogs(api)
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*main.Configuration")).Run(func(args mock.Arguments) {
+		cfg := args.Get(0).(*Configuration)
+		*cfg = *getDefaultConfiguration()
+		cfg.SQLiteFile = path
+		cfg.ReaderCacheSize = 0
+	}).Return(nil)
+	allowKV(api)
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(&model.Channel{}, nil).Maybe()
+	api.On("GetPost", mock.AnythingOfType("string")).Return(&model.Post{}, nil).Maybe()
+	api.On("GetUsers", mock.Anything).Return([]*model.User{}, nil).Maybe()
+	api.On("RegisterCommand", mock.Anything).Return(nil).Once()
+	api.On("RegisterCommand", mock.Anything).Return(errors.New("command taken"))
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	require.NoError(t, p.OnActivate())
+
+	clock := &fakeClock{}
+	p.receiptCounts.clock = clock
+	published := false
+	p.receiptCounts.schedule("post1", nil, func([]string) { published = true })
+
+	// Reactivation drops the old activation's pending events, and its own
+	// failure leaves nothing running
+	require.Error(t, p.OnActivate())
+	clock.Advance(receiptCountsInterval)
+	assert.False(t, published)
+	assert.Nil(t, p.dbConnection)
+	assert.Nil(t, p.store)
+	assert.Nil(t, p.writeQueue)
+	assert.Nil(t, p.readersQueue)
+	assert.Nil(t, p.retention)
+	assert.Nil(t, p.lastViewedSync)
+	assert.Nil(t, p.stopCh)
+}
+
+func TestActivateRejectsMaskedMattermostDSN(t *testing.T) {
+	api := &plugintest.API{}
+	allowLogs(api)
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*main.Configuration")).Run(func(args mock.Arguments) {
+		*args.Get(0).(*Configuration) = *getDefaultConfiguration()
+	}).Return(nil)
+
+	config := &model.Config{}
+	config.SetDefaults()
+	*config.SqlSettings.DataSource = model.FakeSetting
+	api.On("GetUnsanitizedConfig").Return(config)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	err := p.OnActivate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "masked")
+}
+
+func TestGetDatabaseSettingsReplicas(t *testing.T) {
+	t.Run("mattermost replicas", func(t *testing.T) {
+		api := &plugintest.API{}
+		allowLogs(api)
+		config := &model.Config{}
+		config.SetDefaults()
+		*config.SqlSettings.DataSource = "postgres://primary"
+		config.SqlSettings.DataSourceReplicas = []string{"postgres://replica1", model.FakeSetting, "postgres://replica2"}
+		api.On("GetUnsanitizedConfig").Return(config)
+
+		p := &Plugin{conf: getDefaultConfiguration()}
+		p.SetAPI(api)
+
+		settings, err := p.getDatabaseSettings()
+		require.NoError(t, err)
+		assert.Equal(t, "postgres://primary", settings.dataSource)
+		assert.Equal(t, []string{"postgres://replica1", "postgres://replica2"}, settings.replicas)
+	})
+
+	t.Run("dedicated replica", func(t *testing.T) {
+		conf := getDefaultConfiguration()
+		conf.DatabaseDriver = "mysql"
+		conf.DatabaseDataSource = "mysql://primary"
+		conf.DatabaseReplicaDataSource = "mysql://replica"
+
+		p := &Plugin{conf: conf}
+		p.SetAPI(&plugintest.API{})
+
+		settings, err := p.getDatabaseSettings()
+		require.NoError(t, err)
+		assert.Equal(t, "mysql", settings.driverName)
+		assert.Equal(t, []string{"mysql://replica"}, settings.replicas)
+	})
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// Users may hide their read receipts. Their reads are still stored, so their
+// own clients and the unread counts keep working, but nobody else is told
+// about them. With ReadPrivacyReciprocity on, hiding your receipts also
+// hides everyone else's from you.
+
+const (
+	// hiddenReadersKey holds the sorted user IDs that hide their receipts.
+	// One key keeps filtering to a single KV read per request.
+	hiddenReadersKey = "hidden_readers"
+
+	// hiddenReadersRetries bounds the compare-and-set loop on concurrent updates
+	hiddenReadersRetries = 5
+)
+
+// ReadPrivacy is the body of GET and PUT /api/v1/privacy.
+type ReadPrivacy struct {
+	HideReadReceipts bool `json:"hide_read_receipts"`
+	Reciprocity      bool `json:"reciprocity"` // read-only; hiding also hides others' receipts from you
+}
+
+// readPrivacy is a snapshot of who hides their receipts.
+type readPrivacy struct {
+	hidden     map[string]bool
+	reciprocal bool
+}
+
+// getReadPrivacy loads the current privacy settings.
+func (p *Plugin) getReadPrivacy() (*readPrivacy, error) {
+	userIDs, _, err := p.getHiddenReaders()
+	if err != nil {
+		return nil, err
+	}
+	privacy := &readPrivacy{
+		hidden:     make(map[string]bool, len(userIDs)),
+		reciprocal: p.getConfiguration().ReadPrivacyReciprocity,
+	}
+	for _, userID := range userIDs {
+		privacy.hidden[userID] = true
+	}
+	return privacy, nil
+}
+
+// getHiddenReaders returns the users hiding their receipts along with the
+// raw value, for compare-and-set.
+func (p *Plugin) getHiddenReaders() ([]string, []byte, error) {
+	data, appErr := p.API.KVGet(hiddenReadersKey)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to get hidden readers")
+	}
+	if data == nil {
+		return nil, nil, nil
+	}
+
+	var userIDs []string
+	if err := json.Unmarshal(data, &userIDs); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to decode hidden readers")
+	}
+	return userIDs, data, nil
+}
+
+// setReadReceiptsHidden adds userID to or removes it from the hidden set.
+func (p *Plugin) setReadReceiptsHidden(userID string, hide bool) error {
+	for attempt := 0; attempt < hiddenReadersRetries; attempt++ {
+		userIDs, oldData, err := p.getHiddenReaders()
+		if err != nil {
+			return err
+		}
+
+		updated := make([]string, 0, len(userIDs)+1)
+		for _, id := range userIDs {
+			if id != userID {
+				updated = append(updated, id)
+			}
+		}
+		if hide {
+			updated = append(updated, userID)
+		}
+		if len(updated) == len(userIDs) && containsUser(userIDs, userID) == hide {
+			return nil
+		}
+		sort.Strings(updated)
+
+		newData, err := json.Marshal(updated)
+		if err != nil {
+			return err
+		}
+		ok, appErr := p.API.KVCompareAndSet(hiddenReadersKey, oldData, newData)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to save hidden readers")
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("hidden readers changed concurrently, try again")
+}
+
+// isHidden reports whether userID hides their receipts.
+func (rp *readPrivacy) isHidden(userID string) bool {
+	return rp.hidden[userID]
+}
+
+// isBlind reports whether viewerID may not see anyone else's receipts.
+func (rp *readPrivacy) isBlind(viewerID string) bool {
+	return rp.reciprocal && rp.hidden[viewerID]
+}
+
+// visibleTo reports whether viewerID may see readerID's receipts. Everyone
+// sees their own. An empty viewerID stands for a channel-wide audience.
+func (rp *readPrivacy) visibleTo(viewerID, readerID string) bool {
+	if viewerID != "" && readerID == viewerID {
+		return true
+	}
+	return !rp.hidden[readerID] && !rp.isBlind(viewerID)
+}
+
+// filterUserIDs keeps the readers viewerID may see.
+func (rp *readPrivacy) filterUserIDs(viewerID string, userIDs []string) []string {
+	visible := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if rp.visibleTo(viewerID, userID) {
+			visible = append(visible, userID)
+		}
+	}
+	return visible
+}
+
+// filterEvents keeps the read events viewerID may see.
+func (rp *readPrivacy) filterEvents(viewerID string, events []store.ReadEvent) []store.ReadEvent {
+	visible := make([]store.ReadEvent, 0, len(events))
+	for _, event := range events {
+		if rp.visibleTo(viewerID, event.UserID) {
+			visible = append(visible, event)
+		}
+	}
+	return visible
+}
+
+// filterReads keeps the channel reads viewerID may see.
+func (rp *readPrivacy) filterReads(viewerID string, reads []types.ChannelRead) []types.ChannelRead {
+	visible := make([]types.ChannelRead, 0, len(reads))
+	for _, read := range reads {
+		if rp.visibleTo(viewerID, read.UserID) {
+			visible = append(visible, read)
+		}
+	}
+	return visible
+}
+
+// channelBroadcast addresses a channel while leaving out users who may not
+// see others' receipts.
+func (rp *readPrivacy) channelBroadcast(channelID string) *model.WebsocketBroadcast {
+	broadcast := &model.WebsocketBroadcast{ChannelId: channelID}
+	if !rp.reciprocal {
+		return broadcast
+	}
+	for userID := range rp.hidden {
+		if broadcast.OmitUsers == nil {
+			broadcast.OmitUsers = make(map[string]bool)
+		}
+		broadcast.OmitUsers[userID] = true
+	}
+	return broadcast
+}
+
+// getRequestPrivacy loads the privacy settings for an HTTP handler. It
+// writes the error response and returns nil when they cannot be loaded, as
+// receipts must not leak because of a KV failure.
+func (p *Plugin) getRequestPrivacy(w http.ResponseWriter) *readPrivacy {
+	privacy, err := p.getReadPrivacy()
+	if err != nil {
+		p.logError("[Privacy] Failed to load hidden readers", "error", err.Error())
+		http.Error(w, "Failed to load privacy settings", http.StatusInternalServerError)
+		return nil
+	}
+	return privacy
+}
+
+// getBroadcastPrivacy loads the privacy settings before a broadcast. It
+// returns nil when they cannot be loaded and the broadcast should be
+// skipped.
+func (p *Plugin) getBroadcastPrivacy() *readPrivacy {
+	privacy, err := p.getReadPrivacy()
+	if err != nil {
+		p.logError("[Privacy] Failed to load hidden readers, skipping broadcast", "error", err.Error())
+		return nil
+	}
+	return privacy
+}
+
+// HandleGetPrivacy handles GET /api/v1/privacy
+func (p *Plugin) HandleGetPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	privacy := p.getRequestPrivacy(w)
+	if privacy == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReadPrivacy{
+		HideReadReceipts: privacy.isHidden(userID),
+		Reciprocity:      privacy.reciprocal,
+	})
+}
+
+// HandleSetPrivacy handles PUT /api/v1/privacy
+func (p *Plugin) HandleSetPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var req ReadPrivacy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := p.setReadReceiptsHidden(userID, req.HideReadReceipts); err != nil {
+		p.logError("[Privacy] Failed to update hidden readers", "user_id", userID, "error", err.Error())
+		http.Error(w, "Failed to save privacy settings", http.StatusInternalServerError)
+		return
+	}
+	p.logInfo("[Privacy] Read receipt visibility changed", "user_id", userID, "hidden", req.HideReadReceipts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReadPrivacy{
+		HideReadReceipts: req.HideReadReceipts,
+		Reciprocity:      p.getConfiguration().ReadPrivacyReciprocity,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePrivacy(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	p.conf.ReadPrivacyReciprocity = true
+
+	get := func() ReadPrivacy {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/privacy", nil)
+		req.Header.Set("Mattermost-User-Id", "user1")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var privacy ReadPrivacy
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&privacy))
+		return privacy
+	}
+	set := func(hide bool) {
+		body, _ := json.Marshal(ReadPrivacy{HideReadReceipts: hide})
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/privacy", bytes.NewReader(body))
+		req.Header.Set("Mattermost-User-Id", "user1")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Equal(t, ReadPrivacy{Reciprocity: true}, get())
+
+	set(true)
+	set(true)
+	assert.Equal(t, ReadPrivacy{HideReadReceipts: true, Reciprocity: true}, get())
+	require.NoError(t, p.setReadReceiptsHidden("user2", true))
+	userIDs, _, err := p.getHiddenReaders()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1", "user2"}, userIDs)
+
+	set(false)
+	assert.Equal(t, ReadPrivacy{Reciprocity: true}, get())
+}
+
+func TestHiddenReadIsNotBroadcast(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	require.NoError(t, p.setReadReceiptsHidden("hidden", true))
+
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}
+	api.On("GetPost", post.Id).Return(post, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannelMember", "channel1", "hidden").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "hidden"}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/read", strings.NewReader(`{"message_id":"post1"}`))
+	req.Header.Set("Mattermost-User-Id", "hidden")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	api.AssertNotCalled(t, "PublishWebSocketEvent", mock.Anything, mock.Anything, mock.Anything)
+
+	// Stored all the same
+	events, err := p.store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "hidden", events[0].UserID)
+}
+
+func TestReadBroadcastOmitsHiddenUsers(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+	p.conf.ReadPrivacyReciprocity = true
+	require.NoError(t, p.setReadReceiptsHidden("hidden", true))
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "post1", UserID: "hidden", ChannelID: "channel1", Timestamp: 100}))
+
+	post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}
+	api.On("GetPost", post.Id).Return(post, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannelMember", "channel1", "reader").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "reader"}, nil)
+	api.On("PublishWebSocketEvent", WebSocketEventReadReceipt, mock.Anything, &model.WebsocketBroadcast{UserId: "author"}).Return().Once()
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventChannelReaders,
+		map[string]interface{}{
+			"ChannelID":    "channel1",
+			"AddedReaders": map[string]interface{}{"post1": []string{"reader"}},
+		},
+		&model.WebsocketBroadcast{ChannelId: "channel1", OmitUsers: map[string]bool{"hidden": true}},
+	).Return().Once()
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReceiptCounts,
+		map[string]interface{}{"MessageID": "post1", "ChannelID": "channel1", "DeliveredCount": 1, "ReadCount": 1},
+		&model.WebsocketBroadcast{UserId: "author"},
+	).Return().Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/read", strings.NewReader(`{"message_id":"post1"}`))
+	req.Header.Set("Mattermost-User-Id", "reader")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+	sendReceiptCounts(p)
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestChannelReadersHideHiddenUsers(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), "channel1", model.PermissionReadChannel).Return(true)
+	allowOpenChannels(api, "channel1")
+	require.NoError(t, p.setReadReceiptsHidden("hidden", true))
+	for _, userID := range []string{"hidden", "reader", "viewer"} {
+		require.NoError(t, p.store.UpsertChannelRead("channel1", userID, "post1", 100))
+	}
+
+	getReaders := func(viewerID string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/channel/channel1/readers?since=0", nil)
+		req.Header.Set("Mattermost-User-Id", viewerID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			UserIDs []string `json:"user_ids"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response.UserIDs
+	}
+
+	assert.ElementsMatch(t, []string{"reader"}, getReaders("viewer"))
+	assert.ElementsMatch(t, []string{"reader", "viewer"}, getReaders("hidden"))
+
+	// With reciprocity, hiding your receipts hides everyone else's from you
+	p.conf.ReadPrivacyReciprocity = true
+	assert.Empty(t, getReaders("hidden"))
+	assert.ElementsMatch(t, []string{"reader"}, getReaders("viewer"))
+}
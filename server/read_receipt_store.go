@@ -11,12 +11,14 @@ type ReadReceiptStore struct {
 	Store store.ReceiptStore
 }
 
-// MarkPostAsRead inserts or updates the read receipt.
-func (s *ReadReceiptStore) MarkPostAsRead(postID, userID string) error {
+// MarkPostAsRead inserts or updates the read receipt and the user's channel
+// read.
+func (s *ReadReceiptStore) MarkPostAsRead(postID, channelID, userID string) error {
 	event := store.ReadEvent{
 		MessageID: postID,
 		UserID:    userID,
+		ChannelID: channelID,
 		Timestamp: time.Now().UnixMilli(),
 	}
-	return s.Store.Upsert(event)
+	return writeReadEvents(s.Store, []store.ReadEvent{event})
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+)
+
+const (
+	defaultReaderCacheSize = 10000
+
+	// readerCacheClusterEvent carries a store.Invalidation to the other nodes.
+	readerCacheClusterEvent = "reader_cache_invalidate"
+)
+
+// cacheReaders puts an LRU of reader lookups in front of p.store, unless
+// ReaderCacheSize is 0. In HA deployments each node keeps its own cache and
+// tells the others which channels its writes made stale.
+func (p *Plugin) cacheReaders() {
+	size := p.getConfiguration().ReaderCacheSize
+	if size == 0 {
+		p.readerCache = nil
+		return
+	}
+	cache := store.NewCachedStore(p.store, size)
+	cache.SetInvalidationHandler(p.publishReaderCacheInvalidation)
+	p.readerCache = cache
+	p.store = cache
+}
+
+// publishReaderCacheInvalidation passes a local invalidation on to the
+// other nodes of the cluster.
+func (p *Plugin) publishReaderCacheInvalidation(inv store.Invalidation) {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		p.logError("[Cache] Failed to encode reader cache invalidation", "error", err.Error())
+		return
+	}
+	event := model.PluginClusterEvent{Id: readerCacheClusterEvent, Data: data}
+	options := model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable}
+	if err := p.API.PublishPluginClusterEvent(event, options); err != nil {
+		p.logError("[Cache] Failed to publish reader cache invalidation", "error", err.Error())
+	}
+}
+
+// OnPluginClusterEvent drops the cached readers another node's writes made
+// stale.
+func (p *Plugin) OnPluginClusterEvent(_ *plugin.Context, event model.PluginClusterEvent) {
+	if event.Id != readerCacheClusterEvent || p.readerCache == nil {
+		return
+	}
+
+	var inv store.Invalidation
+	if err := json.Unmarshal(event.Data, &inv); err != nil {
+		p.logError("[Cache] Failed to decode reader cache invalidation", "error", err.Error())
+		// Better to drop everything than to keep serving stale readers
+		inv = store.Invalidation{All: true}
+	}
+	p.readerCache.Apply(inv)
+}
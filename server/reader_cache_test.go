@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderCacheClusterInvalidation(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+	p.cacheReaders()
+	require.NotNil(t, p.readerCache)
+
+	// Local writes are announced to the other nodes
+	data, err := json.Marshal(store.Invalidation{ChannelIDs: []string{"channel1"}})
+	require.NoError(t, err)
+	api.On(
+		"PublishPluginClusterEvent",
+		model.PluginClusterEvent{Id: readerCacheClusterEvent, Data: data},
+		model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+	).Return(nil).Once()
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "user1", "post1", 100))
+
+	readers, err := p.store.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1"}, readers)
+
+	// Another node's write reaches the database without passing this cache
+	require.NoError(t, p.readerCache.ReceiptStore.UpsertChannelRead("channel1", "user2", "post1", 200))
+	readers, err = p.store.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1"}, readers)
+
+	p.OnPluginClusterEvent(nil, model.PluginClusterEvent{Id: readerCacheClusterEvent, Data: data})
+	readers, err = p.store.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user1", "user2"}, readers)
+
+	metrics := p.readerCache.Metrics()
+	assert.Equal(t, uint64(1), metrics.Hits)
+	assert.Equal(t, uint64(2), metrics.Misses)
+}
+
+func TestReaderCacheDisabled(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	p.conf.ReaderCacheSize = 0
+	p.cacheReaders()
+
+	assert.Nil(t, p.readerCache)
+	_, isSQLite := p.store.(*store.SQLiteStore)
+	assert.True(t, isSQLite)
+
+	// Events for the cache are ignored while it is off
+	p.OnPluginClusterEvent(nil, model.PluginClusterEvent{Id: readerCacheClusterEvent, Data: []byte(`{"all":true}`)})
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// Besides the plugin-wide Enable flag, receipts can be turned off for a
+// team by a system admin and for a channel by its admins. Receipts are on in
+// a channel only when the plugin, its team and the channel all allow them.
+// DMs and group messages belong to no team, so only the channel setting
+// applies to them.
+
+// ReceiptSettingRequest is the body of the settings PUT endpoints.
+type ReceiptSettingRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// ChannelReceiptSettings describes whether receipts are on in a channel.
+type ChannelReceiptSettings struct {
+	ChannelID      string `json:"channel_id"`
+	Enabled        bool   `json:"enabled"` // the plugin, team and channel all allow receipts
+	TeamEnabled    bool   `json:"team_enabled"`
+	ChannelEnabled bool   `json:"channel_enabled"`
+}
+
+// TeamReceiptSettings lists the saved team settings.
+type TeamReceiptSettings struct {
+	RestrictToEnabledTeams bool                   `json:"restrict_to_enabled_teams"`
+	Teams                  []store.ReceiptSetting `json:"teams"`
+}
+
+// teamReceiptsEnabled reports whether teamID allows receipts. A team without
+// a setting follows RestrictToEnabledTeams.
+func (p *Plugin) teamReceiptsEnabled(teamID string) (bool, error) {
+	if teamID == "" {
+		return true, nil
+	}
+	setting, err := p.store.GetReceiptSetting(store.SettingScopeTeam, teamID)
+	if err != nil {
+		return false, err
+	}
+	if setting == nil {
+		return !p.getConfiguration().RestrictToEnabledTeams, nil
+	}
+	return setting.Enabled, nil
+}
+
+// channelReceiptsEnabled reports whether channelID itself allows receipts.
+func (p *Plugin) channelReceiptsEnabled(channelID string) (bool, error) {
+	setting, err := p.store.GetReceiptSetting(store.SettingScopeChannel, channelID)
+	if err != nil {
+		return false, err
+	}
+	return setting == nil || setting.Enabled, nil
+}
+
+// getChannelReceiptSettings combines the settings that apply to channel.
+func (p *Plugin) getChannelReceiptSettings(channel *model.Channel) (*ChannelReceiptSettings, error) {
+	teamEnabled, err := p.teamReceiptsEnabled(channel.TeamId)
+	if err != nil {
+		return nil, err
+	}
+	channelEnabled, err := p.channelReceiptsEnabled(channel.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelReceiptSettings{
+		ChannelID:      channel.Id,
+		Enabled:        p.getConfiguration().Enable && teamEnabled && channelEnabled,
+		TeamEnabled:    teamEnabled,
+		ChannelEnabled: channelEnabled,
+	}, nil
+}
+
+// receiptsEnabled reports whether receipts are on in channel.
+func (p *Plugin) receiptsEnabled(channel *model.Channel) (bool, error) {
+	settings, err := p.getChannelReceiptSettings(channel)
+	if err != nil {
+		return false, err
+	}
+	return settings.Enabled, nil
+}
+
+// receiptsEnabledInChannel is receiptsEnabled for callers that only hold
+// the channel's ID.
+func (p *Plugin) receiptsEnabledInChannel(channelID string) (bool, error) {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get channel")
+	}
+	return p.receiptsEnabled(channel)
+}
+
+// receiptsAllowed is receiptsEnabledInChannel for background work and
+// bulk requests; a failed check is logged and counts as disabled.
+func (p *Plugin) receiptsAllowed(channelID string) bool {
+	enabled, err := p.receiptsEnabledInChannel(channelID)
+	if err != nil {
+		p.logError("[API] Failed to check receipt settings", "channel_id", channelID, "error", err.Error())
+		return false
+	}
+	return enabled
+}
+
+// requireReceiptsEnabled writes a 403 and returns false when receipts are
+// off in channelID.
+func (p *Plugin) requireReceiptsEnabled(w http.ResponseWriter, channelID string) bool {
+	enabled, err := p.receiptsEnabledInChannel(channelID)
+	if err != nil {
+		p.logError("[API] Failed to check receipt settings", "channel_id", channelID, "error", err.Error())
+		http.Error(w, "Failed to check receipt settings", http.StatusInternalServerError)
+		return false
+	}
+	if !enabled {
+		http.Error(w, "Read receipts are disabled in this channel", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ReceiptsEnabledRequired only lets the request through when receipts are
+// on in the channel it targets. It runs after ChannelReadRequired.
+func (p *Plugin) ReceiptsEnabledRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.requireReceiptsEnabled(w, channelIDFromRequest(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// decodeReceiptSettingRequest reads the body of a settings PUT. It writes
+// the error response and returns false when the body is invalid.
+func decodeReceiptSettingRequest(w http.ResponseWriter, r *http.Request) (ReceiptSettingRequest, bool) {
+	var req ReceiptSettingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Enabled == nil {
+		http.Error(w, "enabled is required", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// HandleGetChannelSettings handles GET /api/v1/channel/{channelID}/settings
+func (p *Plugin) HandleGetChannelSettings(w http.ResponseWriter, r *http.Request) {
+	channel, appErr := p.API.GetChannel(mux.Vars(r)["channelID"])
+	if appErr != nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := p.getChannelReceiptSettings(channel)
+	if err != nil {
+		p.logError("[API] Failed to get receipt settings", "channel_id", channel.Id, "error", err.Error())
+		http.Error(w, "Failed to get receipt settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// HandleSetChannelSettings handles PUT /api/v1/channel/{channelID}/settings.
+// Only channel, team and system admins can change it, or any member of a DM
+// or group message.
+func (p *Plugin) HandleSetChannelSettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	req, ok := decodeReceiptSettingRequest(w, r)
+	if !ok {
+		return
+	}
+	enabled := *req.Enabled
+
+	channel, appErr := p.API.GetChannel(mux.Vars(r)["channelID"])
+	if appErr != nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if !p.canManageChannelReceipts(userID, channel) {
+		p.logError("[API] Forbidden receipt settings change", "channel_id", channel.Id, "user_id", userID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := p.store.SaveReceiptSetting(store.ReceiptSetting{
+		Scope:     store.SettingScopeChannel,
+		ScopeID:   channel.Id,
+		Enabled:   enabled,
+		UpdatedBy: userID,
+		UpdatedAt: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		p.logError("[API] Failed to save receipt settings", "channel_id", channel.Id, "error", err.Error())
+		http.Error(w, "Failed to save receipt settings", http.StatusInternalServerError)
+		return
+	}
+	p.logInfo("[API] Channel receipts changed", "channel_id", channel.Id, "enabled", enabled, "user_id", userID)
+
+	settings, err := p.getChannelReceiptSettings(channel)
+	if err != nil {
+		p.logError("[API] Failed to get receipt settings", "channel_id", channel.Id, "error", err.Error())
+		http.Error(w, "Failed to get receipt settings", http.StatusInternalServerError)
+		return
+	}
+	p.PublishReceiptsEnabled(channel.Id, "", settings.Enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// HandleGetTeamSettings handles GET /api/v1/admin/teams/settings
+func (p *Plugin) HandleGetTeamSettings(w http.ResponseWriter, r *http.Request) {
+	teams, err := p.store.GetReceiptSettings(store.SettingScopeTeam)
+	if err != nil {
+		p.logError("[API] Failed to get team receipt settings", "error", err.Error())
+		http.Error(w, "Failed to get receipt settings", http.StatusInternalServerError)
+		return
+	}
+	if teams == nil {
+		teams = []store.ReceiptSetting{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TeamReceiptSettings{
+		RestrictToEnabledTeams: p.getConfiguration().RestrictToEnabledTeams,
+		Teams:                  teams,
+	})
+}
+
+// HandleSetTeamSettings handles PUT /api/v1/admin/teams/{teamID}/settings
+func (p *Plugin) HandleSetTeamSettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	req, ok := decodeReceiptSettingRequest(w, r)
+	if !ok {
+		return
+	}
+	enabled := *req.Enabled
+
+	team, appErr := p.API.GetTeam(mux.Vars(r)["teamID"])
+	if appErr != nil {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+
+	setting := store.ReceiptSetting{
+		Scope:     store.SettingScopeTeam,
+		ScopeID:   team.Id,
+		Enabled:   enabled,
+		UpdatedBy: userID,
+		UpdatedAt: time.Now().UnixMilli(),
+	}
+	if err := p.store.SaveReceiptSetting(setting); err != nil {
+		p.logError("[API] Failed to save team receipt settings", "team_id", team.Id, "error", err.Error())
+		http.Error(w, "Failed to save receipt settings", http.StatusInternalServerError)
+		return
+	}
+	p.logInfo("[API] Team receipts changed", "team_id", team.Id, "enabled", enabled, "user_id", userID)
+
+	p.PublishReceiptsEnabled("", team.Id, p.getConfiguration().Enable && enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(setting)
+}
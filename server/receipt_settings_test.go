@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSetChannelSettings(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	allowOpenChannels(api, "channel1")
+	// Plain members hold manage_public_channel_properties in the default
+	// scheme, so the channel admin role is what counts
+	api.On("HasPermissionToChannel", "member", "channel1", model.PermissionManagePublicChannelProperties).Return(true).Maybe()
+	api.On("HasPermissionToChannel", "member", "channel1", model.PermissionManageChannelRoles).Return(false)
+	api.On("HasPermissionToChannel", "admin", "channel1", model.PermissionManageChannelRoles).Return(true)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), "channel1", model.PermissionReadChannel).Return(true)
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "channel1", UserId: "author"}, nil)
+	api.On("GetChannelMember", "channel1", "member").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "member"}, nil)
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReceiptsEnabled,
+		map[string]interface{}{"ChannelID": "channel1", "TeamID": "", "Enabled": false},
+		&model.WebsocketBroadcast{ChannelId: "channel1"},
+	).Return().Once()
+
+	serve := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/v1/channel/channel1/settings", "admin", `{}`).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/v1/channel/channel1/settings", "member", `{"enabled":false}`).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/v1/channel/channel1/settings", "admin", `{"enabled":false}`).Code)
+
+	w := serve(http.MethodGet, "/api/v1/channel/channel1/settings", "member", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var settings ChannelReceiptSettings
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&settings))
+	assert.Equal(t, ChannelReceiptSettings{ChannelID: "channel1", Enabled: false, TeamEnabled: true, ChannelEnabled: false}, settings)
+
+	// Neither reads nor queries go through any more
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/v1/read", "member", `{"message_id":"post1"}`).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/channel/channel1/readers?since=0", "member", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v2/posts/post1/readers", "member", "").Code)
+
+	w = serve(http.MethodPost, "/api/v2/read/batch", "member", `{"message_ids":["post1"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response BatchReadResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, map[string]string{"post1": "read receipts are disabled in the channel"}, response.Rejected)
+
+	events, err := p.store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestHandleSetTeamSettings(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "member", model.PermissionManageSystem).Return(false)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannel", "channel2").Return(&model.Channel{Id: "channel2", TeamId: "team2", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", Type: model.ChannelTypeDirect}, nil)
+	api.On(
+		"PublishWebSocketEvent",
+		WebSocketEventReceiptsEnabled,
+		map[string]interface{}{"ChannelID": "", "TeamID": "team1", "Enabled": true},
+		&model.WebsocketBroadcast{TeamId: "team1"},
+	).Return().Once()
+
+	serve := func(userID, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/teams/team1/settings", strings.NewReader(body))
+		req.Header.Set("Mattermost-User-Id", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve("member", `{"enabled":true}`))
+	require.Equal(t, http.StatusOK, serve("admin", `{"enabled":true}`))
+
+	// Only enabled teams get receipts once restricted; DMs have no team
+	p.conf.RestrictToEnabledTeams = true
+	for channelID, want := range map[string]bool{"channel1": true, "channel2": false, "dm": true} {
+		enabled, err := p.receiptsEnabledInChannel(channelID)
+		require.NoError(t, err)
+		assert.Equal(t, want, enabled, channelID)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/teams/settings", nil)
+	req.Header.Set("Mattermost-User-Id", "admin")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var settings TeamReceiptSettings
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&settings))
+	assert.True(t, settings.RestrictToEnabledTeams)
+	require.Len(t, settings.Teams, 1)
+	assert.Equal(t, store.ReceiptSetting{Scope: store.SettingScopeTeam, ScopeID: "team1", Enabled: true, UpdatedBy: "admin", UpdatedAt: settings.Teams[0].UpdatedAt}, settings.Teams[0])
+}
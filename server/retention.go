@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	retentionJobKey     = "retention"
+	retentionMutexKey   = "retention_run"
+	retentionLastRunKey = "retention_last_run"
+	retentionInterval   = 24 * time.Hour
+
+	// Rows removed per statement, and the pause between statements, so a
+	// large purge never holds long locks or starves other writers.
+	retentionBatchSize  = 1000
+	retentionBatchPause = 100 * time.Millisecond
+)
+
+// RetentionRun records the outcome of one retention pass. The last run is
+// kept in the plugin KV store so every node in a cluster can report it.
+type RetentionRun struct {
+	StartedAt           int64  `json:"started_at"`
+	FinishedAt          int64  `json:"finished_at"`
+	RetentionDays       int    `json:"retention_days"`
+	CutoffMs            int64  `json:"cutoff_ms,omitempty"`       // zero when a retention policy is set
+	ChannelsPurged      int    `json:"channels_purged,omitempty"` // channels visited under a retention policy
+	ReadEventsDeleted   int64  `json:"read_events_deleted"`
+	ChannelReadsDeleted int64  `json:"channel_reads_deleted"`
+	DeliveriesDeleted   int64  `json:"deliveries_deleted"`
+	Error               string `json:"error,omitempty"`
+}
+
+// retention runs the purge on a cluster-wide schedule. The job and manual
+// runs share a cluster mutex, so only one node purges at a time.
+type retention struct {
+	job    *cluster.Job
+	mutex  *cluster.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// startRetention schedules the nightly purge.
+func (p *Plugin) startRetention() error {
+	mutex, err := cluster.NewMutex(p.API, retentionMutexKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to create retention mutex")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &retention{mutex: mutex, ctx: ctx, cancel: cancel}
+
+	job, err := cluster.Schedule(p.API, retentionJobKey, cluster.MakeWaitForRoundedInterval(retentionInterval), func() {
+		p.runMaintenance(r.ctx)
+	})
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "failed to schedule retention job")
+	}
+	r.job = job
+
+	p.retention = r
+	return nil
+}
+
+// stopRetention cancels an in-flight purge between batches and stops the schedule.
+func (p *Plugin) stopRetention() {
+	if p.retention == nil {
+		return
+	}
+	p.retention.cancel()
+	if p.retention.job != nil {
+		if err := p.retention.job.Close(); err != nil {
+			p.logError("[Retention] Failed to stop retention job", "error", err.Error())
+		}
+	}
+	p.retention = nil
+}
+
+// runMaintenance runs the retention purge and then the sweep for deleted
+// channels and users, see cleanup.go.
+func (p *Plugin) runMaintenance(ctx context.Context) {
+	if _, err := p.runRetention(ctx); err != nil {
+		p.logError("[Retention] Purge failed", "error", err.Error())
+	}
+	if _, err := p.runCleanupSweep(ctx); err != nil {
+		p.logError("[Cleanup] Sweep failed", "error", err.Error())
+	}
+}
+
+// runRetention takes the cluster mutex and purges receipts older than
+// RetentionDays, or older than each channel's RetentionPolicy rule when a
+// policy is configured. Zero days disables purging.
+func (p *Plugin) runRetention(ctx context.Context) (*RetentionRun, error) {
+	if p.retention == nil {
+		return nil, errors.New("retention is not running")
+	}
+	if err := p.retention.mutex.LockWithContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to acquire retention lock")
+	}
+	defer p.retention.mutex.Unlock()
+
+	conf := p.getConfiguration()
+	days, policy := conf.RetentionDays, conf.retentionPolicy
+	if days == 0 && policy.IsEmpty() {
+		p.logDebug("[Retention] Retention disabled, nothing to purge")
+		return nil, nil
+	}
+
+	now := time.Now()
+	run := &RetentionRun{
+		StartedAt:     now.UnixMilli(),
+		RetentionDays: days,
+	}
+
+	var err error
+	if policy.IsEmpty() {
+		run.CutoffMs = now.AddDate(0, 0, -days).UnixMilli()
+		err = p.purgeChannel(ctx, run, "", run.CutoffMs)
+	} else {
+		err = p.purgeWithPolicy(ctx, run, policy, now)
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().UnixMilli()
+
+	if saveErr := p.saveRetentionRun(run); saveErr != nil {
+		p.logError("[Retention] Failed to record retention run", "error", saveErr.Error())
+	}
+	p.logInfo("[Retention] Purge finished",
+		"read_events_deleted", run.ReadEventsDeleted,
+		"channel_reads_deleted", run.ChannelReadsDeleted,
+		"deliveries_deleted", run.DeliveriesDeleted,
+		"duration_ms", run.FinishedAt-run.StartedAt,
+	)
+	return run, err
+}
+
+// purgeWithPolicy is the policy-aware form of CleanupOlderThan. It resolves
+// the retention of every channel holding receipts and purges them one
+// channel at a time.
+func (p *Plugin) purgeWithPolicy(ctx context.Context, run *RetentionRun, policy *RetentionPolicy, now time.Time) error {
+	channelIDs, err := p.store.GetReceiptChannelIDs()
+	if err != nil {
+		return errors.Wrap(err, "failed to list receipt channels")
+	}
+
+	for _, channelID := range channelIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		days := policy.DaysFor(p.getRetentionChannel(channelID), run.RetentionDays)
+		if days == 0 {
+			continue
+		}
+		if err := p.purgeChannel(ctx, run, channelID, now.AddDate(0, 0, -days).UnixMilli()); err != nil {
+			return err
+		}
+		run.ChannelsPurged++
+	}
+	return nil
+}
+
+// getRetentionChannel loads the channel a policy is matched against. When
+// the channel no longer exists only its channel rule can apply.
+func (p *Plugin) getRetentionChannel(channelID string) *model.Channel {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		p.logDebug("[Retention] Channel not found, matching by ID only", "channel_id", channelID, "error", appErr.Error())
+		return &model.Channel{Id: channelID}
+	}
+	return channel
+}
+
+// purgeChannel removes read events and channel reads older than cutoffMs
+// from channelID, or from every channel when channelID is empty.
+func (p *Plugin) purgeChannel(ctx context.Context, run *RetentionRun, channelID string, cutoffMs int64) error {
+	deleted, err := p.purgeInBatches(ctx, retentionBatchSize, func(limit int) (int64, error) {
+		return p.store.DeleteReadEventsBefore(channelID, cutoffMs, limit)
+	})
+	run.ReadEventsDeleted += deleted
+	if err != nil {
+		return err
+	}
+
+	deleted, err = p.purgeInBatches(ctx, retentionBatchSize, func(limit int) (int64, error) {
+		return p.store.DeleteChannelReadsBefore(channelID, cutoffMs, limit)
+	})
+	run.ChannelReadsDeleted += deleted
+	if err != nil {
+		return err
+	}
+
+	deleted, err = p.purgeInBatches(ctx, retentionBatchSize, func(limit int) (int64, error) {
+		return p.store.DeleteDeliveriesBefore(channelID, cutoffMs, limit)
+	})
+	run.DeliveriesDeleted += deleted
+	return err
+}
+
+// purgeInBatches calls deleteBatch until it removes fewer than batchSize
+// rows, pausing between batches. It stops early when ctx is cancelled.
+func (p *Plugin) purgeInBatches(ctx context.Context, batchSize int, deleteBatch func(limit int) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		deleted, err := deleteBatch(batchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < int64(batchSize) {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(retentionBatchPause):
+		}
+	}
+}
+
+func (p *Plugin) saveRetentionRun(run *RetentionRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if appErr := p.API.KVSet(retentionLastRunKey, data); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// getLastRetentionRun returns the last recorded run, or nil if none.
+func (p *Plugin) getLastRetentionRun() (*RetentionRun, error) {
+	data, appErr := p.API.KVGet(retentionLastRunKey)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var run RetentionRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, errors.Wrap(err, "failed to decode last retention run")
+	}
+	return &run, nil
+}
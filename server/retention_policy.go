@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// RetentionPolicy overrides RetentionDays for some channels. The most
+// specific rule wins: channel, then team, then channel type, then
+// RetentionDays. A value of 0 keeps receipts forever.
+type RetentionPolicy struct {
+	ChannelTypes map[string]int `json:"channel_types,omitempty"` // O, P, D or G
+	Teams        map[string]int `json:"teams,omitempty"`         // team ID -> days
+	Channels     map[string]int `json:"channels,omitempty"`      // channel ID -> days
+}
+
+// parseRetentionPolicy reads the RetentionPolicy setting. An empty setting
+// yields a nil policy.
+func parseRetentionPolicy(raw string) (*RetentionPolicy, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var policy RetentionPolicy
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("retention policy is not valid JSON: %w", err)
+	}
+
+	// Accept "o" as well as "O"
+	channelTypes := make(map[string]int, len(policy.ChannelTypes))
+	for channelType, days := range policy.ChannelTypes {
+		channelType = strings.ToUpper(channelType)
+		switch model.ChannelType(channelType) {
+		case model.ChannelTypeOpen, model.ChannelTypePrivate, model.ChannelTypeDirect, model.ChannelTypeGroup:
+		default:
+			return nil, fmt.Errorf("retention policy channel type must be one of: O, P, D, G")
+		}
+		channelTypes[channelType] = days
+	}
+	policy.ChannelTypes = channelTypes
+
+	for _, rules := range []map[string]int{policy.ChannelTypes, policy.Teams, policy.Channels} {
+		for _, days := range rules {
+			if days < 0 {
+				return nil, fmt.Errorf("retention policy days must be non-negative")
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// IsEmpty reports whether the policy has no rules, so RetentionDays applies
+// everywhere.
+func (rp *RetentionPolicy) IsEmpty() bool {
+	return rp == nil || len(rp.ChannelTypes) == 0 && len(rp.Teams) == 0 && len(rp.Channels) == 0
+}
+
+// DaysFor returns the retention for channel, or fallback when no rule matches.
+func (rp *RetentionPolicy) DaysFor(channel *model.Channel, fallback int) int {
+	if rp == nil {
+		return fallback
+	}
+	if days, ok := rp.Channels[channel.Id]; ok {
+		return days
+	}
+	if channel.TeamId != "" {
+		if days, ok := rp.Teams[channel.TeamId]; ok {
+			return days
+		}
+	}
+	if days, ok := rp.ChannelTypes[string(channel.Type)]; ok {
+		return days
+	}
+	return fallback
+}
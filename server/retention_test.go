@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/store"
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRetention gives p a retention runner without the background schedule.
+func setupRetention(t *testing.T, p *Plugin) {
+	mutex, err := cluster.NewMutex(p.API, retentionMutexKey)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	p.retention = &retention{mutex: mutex, ctx: ctx, cancel: cancel}
+	t.Cleanup(p.stopRetention)
+}
+
+func TestRunRetention(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("KVSetWithOptions", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(true, nil)
+
+	var saved []byte
+	api.On("KVSet", retentionLastRunKey, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).([]byte)
+	}).Return(nil).Once()
+	setupRetention(t, p)
+
+	old := time.Now().AddDate(0, 0, -31).UnixMilli()
+	recent := time.Now().UnixMilli()
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "old", UserID: "user1", ChannelID: "channel1", Timestamp: old}))
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "new", UserID: "user1", ChannelID: "channel1", Timestamp: recent}))
+	require.NoError(t, p.store.UpsertChannelRead("channel1", "user1", "old", old))
+	require.NoError(t, p.store.SaveDeliveries([]store.DeliveryEvent{{MessageID: "old", UserID: "user2", ChannelID: "channel1", DeliveredAt: old}}))
+
+	run, err := p.runRetention(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 30, run.RetentionDays)
+	assert.EqualValues(t, 1, run.ReadEventsDeleted)
+	assert.EqualValues(t, 1, run.ChannelReadsDeleted)
+	assert.EqualValues(t, 1, run.DeliveriesDeleted)
+	assert.Empty(t, run.Error)
+
+	events, err := p.store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "new", events[0].MessageID)
+
+	// The run is recorded for GET /api/v1/admin/retention
+	api.On("KVGet", retentionLastRunKey).Return(saved, nil)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/retention", nil)
+	req.Header.Set("Mattermost-User-Id", "admin")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var status RetentionStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, 30, status.RetentionDays)
+	assert.Equal(t, run, status.LastRun)
+}
+
+func TestRunRetentionWithPolicy(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	allowKV(api)
+	p.conf.RetentionPolicy = `{"channel_types": {"D": 365, "O": 7}, "channels": {"keep": 0}}`
+	require.NoError(t, p.conf.IsValid())
+	setupRetention(t, p)
+
+	api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", Type: model.ChannelTypeDirect}, nil)
+	api.On("GetChannel", "public").Return(&model.Channel{Id: "public", TeamId: "team1", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannel", "keep").Return(&model.Channel{Id: "keep", TeamId: "team1", Type: model.ChannelTypeOpen}, nil)
+	api.On("GetChannel", "deleted").Return(nil, model.NewAppError("GetChannel", "app.channel.get.existing.app_error", nil, "", http.StatusNotFound))
+
+	tenDaysAgo := time.Now().AddDate(0, 0, -10).UnixMilli()
+	for _, channelID := range []string{"dm", "public", "keep", "deleted"} {
+		require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: channelID + "-post", UserID: "user1", ChannelID: channelID, Timestamp: tenDaysAgo}))
+	}
+	require.NoError(t, p.store.UpsertChannelRead("public", "user1", "public-post", tenDaysAgo))
+
+	run, err := p.runRetention(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, run.ReadEventsDeleted)
+	assert.EqualValues(t, 1, run.ChannelReadsDeleted)
+	assert.Equal(t, 3, run.ChannelsPurged)
+
+	// The 7-day public rule purges; DMs keep a year, "keep" keeps forever and
+	// the deleted channel falls back to the 30-day default
+	for channelID, remaining := range map[string]int{"dm": 1, "public": 0, "keep": 1, "deleted": 1} {
+		events, err := p.store.GetByChannel(channelID, "")
+		require.NoError(t, err)
+		assert.Len(t, events, remaining, channelID)
+	}
+}
+
+func TestRunRetentionDisabled(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	allowKV(api)
+	p.conf.RetentionDays = 0
+	setupRetention(t, p)
+
+	require.NoError(t, p.store.Upsert(store.ReadEvent{MessageID: "old", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+
+	run, err := p.runRetention(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, run)
+	api.AssertNotCalled(t, "KVSet", retentionLastRunKey, mock.Anything)
+
+	events, err := p.store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestPurgeInBatches(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+
+	t.Run("stops on a short batch", func(t *testing.T) {
+		remaining := int64(5)
+		var calls int
+		total, err := p.purgeInBatches(context.Background(), 2, func(limit int) (int64, error) {
+			calls++
+			n := remaining
+			if n > int64(limit) {
+				n = int64(limit)
+			}
+			remaining -= n
+			return n, nil
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, total)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		total, err := p.purgeInBatches(ctx, 2, func(int) (int64, error) { return 2, nil })
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.EqualValues(t, 2, total)
+	})
+
+	t.Run("returns store errors", func(t *testing.T) {
+		_, err := p.purgeInBatches(context.Background(), 2, func(int) (int64, error) { return 0, errors.New("boom") })
+		assert.Error(t, err)
+	})
+}
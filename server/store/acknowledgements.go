@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Acknowledgement records that a user explicitly acknowledged a post that
+// requires it. Unlike a read it is never inferred, and only the first one
+// is kept.
+type Acknowledgement struct {
+	MessageID string
+	UserID    string
+	ChannelID string
+	AckedAt   int64
+}
+
+func scanAcknowledgements(rows *sql.Rows) ([]Acknowledgement, error) {
+	defer rows.Close()
+
+	var acks []Acknowledgement
+	for rows.Next() {
+		var ack Acknowledgement
+		if err := rows.Scan(&ack.MessageID, &ack.UserID, &ack.ChannelID, &ack.AckedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan acknowledgement: %w", err)
+		}
+		acks = append(acks, ack)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating acknowledgements: %w", err)
+	}
+	return acks, nil
+}
+
+// execSaveAcknowledgement runs an insert that leaves existing rows alone and
+// reports whether it added one.
+func (s *BaseStore) execSaveAcknowledgement(query string, ack Acknowledgement) (bool, error) {
+	result, err := s.db.Exec(query, ack.MessageID, ack.UserID, ack.ChannelID, ack.AckedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save acknowledgement: %w", err)
+	}
+	added, err := result.RowsAffected()
+	return added > 0, err
+}
+
+const selectAcknowledgements = `
+	SELECT message_id, user_id, channel_id, acked_at
+	FROM acknowledgements
+`
+
+func (s *PostgresStore) SaveAcknowledgement(ack Acknowledgement) (bool, error) {
+	return s.execSaveAcknowledgement(`
+		INSERT INTO acknowledgements (message_id, user_id, channel_id, acked_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, ack)
+}
+
+func (s *PostgresStore) GetAcknowledgements(messageID string) ([]Acknowledgement, error) {
+	rows, err := s.readQuery(selectAcknowledgements+`WHERE message_id = $1 ORDER BY acked_at, user_id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query acknowledgements: %w", err)
+	}
+	return scanAcknowledgements(rows)
+}
+
+func (s *MySQLStore) SaveAcknowledgement(ack Acknowledgement) (bool, error) {
+	return s.execSaveAcknowledgement(`
+		INSERT IGNORE INTO acknowledgements (message_id, user_id, channel_id, acked_at)
+		VALUES (?, ?, ?, ?)
+	`, ack)
+}
+
+func (s *MySQLStore) GetAcknowledgements(messageID string) ([]Acknowledgement, error) {
+	rows, err := s.readQuery(selectAcknowledgements+`WHERE message_id = ? ORDER BY acked_at, user_id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query acknowledgements: %w", err)
+	}
+	return scanAcknowledgements(rows)
+}
+
+func (s *SQLiteStore) SaveAcknowledgement(ack Acknowledgement) (bool, error) {
+	return s.execSaveAcknowledgement(`
+		INSERT INTO acknowledgements (message_id, user_id, channel_id, acked_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, ack)
+}
+
+func (s *SQLiteStore) GetAcknowledgements(messageID string) ([]Acknowledgement, error) {
+	rows, err := s.readQuery(selectAcknowledgements+`WHERE message_id = ? ORDER BY acked_at, user_id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query acknowledgements: %w", err)
+	}
+	return scanAcknowledgements(rows)
+}
@@ -0,0 +1,441 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/arg/mattermost-readreceipts/server/types"
+)
+
+// Invalidation names the channels whose cached readers a write made stale.
+// All drops every entry, for writes that may touch any channel.
+type Invalidation struct {
+	ChannelIDs []string `json:"channel_ids,omitempty"`
+	All        bool     `json:"all,omitempty"`
+}
+
+// CacheMetrics is a point-in-time snapshot of a CachedStore.
+type CacheMetrics struct {
+	Capacity      int    `json:"capacity"`
+	Entries       int    `json:"entries"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// cacheEntry is one cached reader lookup.
+type cacheEntry struct {
+	key       string
+	channelID string
+	value     interface{}
+}
+
+// CachedStore keeps the results of the reader lookups, per channel and per
+// post, in an LRU in front of another ReceiptStore. Every write drops the
+// entries of the channels it touches; writes made inside a transaction do
+// so once it commits. The invalidation handler hears about each local
+// invalidation so other cluster nodes can apply it too.
+//
+// Misses are filled from the primary: entries live until the next write to
+// their channel, so one filled from a lagging replica could hide that
+// channel's latest reads indefinitely.
+type CachedStore struct {
+	ReceiptStore
+
+	fill         ReceiptStore // answers misses; reads from the primary
+	capacity     int
+	onInvalidate func(Invalidation)
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List                     // most recently used first
+	byChannel map[string]map[string]struct{} // channel ID -> keys
+	versions  map[string]uint64              // channel ID -> invalidations so far
+	epoch     uint64                         // invalidations of everything so far
+	metrics   CacheMetrics
+}
+
+// NewCachedStore caches up to capacity reader lookups of s.
+func NewCachedStore(s ReceiptStore, capacity int) *CachedStore {
+	fill := s
+	if primary, ok := s.(PrimaryReader); ok {
+		fill = primary.Primary()
+	}
+	return &CachedStore{
+		ReceiptStore: s,
+		fill:         fill,
+		capacity:     capacity,
+		onInvalidate: func(Invalidation) {},
+		entries:      make(map[string]*list.Element),
+		order:        list.New(),
+		byChannel:    make(map[string]map[string]struct{}),
+		versions:     make(map[string]uint64),
+		metrics:      CacheMetrics{Capacity: capacity},
+	}
+}
+
+// SetInvalidationHandler sets the function told about local invalidations.
+// It is not called for invalidations passed to Apply.
+func (s *CachedStore) SetInvalidationHandler(handler func(Invalidation)) {
+	s.onInvalidate = handler
+}
+
+// Metrics returns the cache's counters.
+func (s *CachedStore) Metrics() CacheMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics := s.metrics
+	metrics.Entries = s.order.Len()
+	return metrics
+}
+
+// Apply drops the entries named by inv, e.g. on behalf of another node.
+func (s *CachedStore) Apply(inv Invalidation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics.Invalidations++
+	if inv.All {
+		s.entries = make(map[string]*list.Element)
+		s.order.Init()
+		s.byChannel = make(map[string]map[string]struct{})
+		s.versions = make(map[string]uint64)
+		s.epoch++
+		return
+	}
+	for _, channelID := range inv.ChannelIDs {
+		for key := range s.byChannel[channelID] {
+			s.order.Remove(s.entries[key])
+			delete(s.entries, key)
+		}
+		delete(s.byChannel, channelID)
+		s.versions[channelID]++
+	}
+}
+
+// invalidate applies inv locally and passes it on.
+func (s *CachedStore) invalidate(inv Invalidation) {
+	if !inv.All && len(inv.ChannelIDs) == 0 {
+		return
+	}
+	s.Apply(inv)
+	s.onInvalidate(inv)
+}
+
+// cacheVersion identifies the state of channelID's entries, so that a
+// lookup racing a write does not cache what the write made stale.
+type cacheVersion struct {
+	epoch   uint64
+	channel uint64
+}
+
+// lookup returns the cached value for key, or the version to store a fresh
+// value under.
+func (s *CachedStore) lookup(key, channelID string) (interface{}, cacheVersion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		s.metrics.Hits++
+		s.order.MoveToFront(element)
+		return element.Value.(*cacheEntry).value, cacheVersion{}, true
+	}
+	s.metrics.Misses++
+	return nil, cacheVersion{epoch: s.epoch, channel: s.versions[channelID]}, false
+}
+
+// store caches value unless channelID was invalidated since version was
+// taken, evicting the least recently used entry when full.
+func (s *CachedStore) store(key, channelID string, value interface{}, version cacheVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version.epoch != s.epoch || version.channel != s.versions[channelID] {
+		return
+	}
+	if _, ok := s.entries[key]; ok {
+		return
+	}
+	if s.order.Len() >= s.capacity {
+		oldest := s.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		s.order.Remove(oldest)
+		delete(s.entries, entry.key)
+		delete(s.byChannel[entry.channelID], entry.key)
+		if len(s.byChannel[entry.channelID]) == 0 {
+			delete(s.byChannel, entry.channelID)
+		}
+		s.metrics.Evictions++
+	}
+
+	s.entries[key] = s.order.PushFront(&cacheEntry{key: key, channelID: channelID, value: value})
+	if s.byChannel[channelID] == nil {
+		s.byChannel[channelID] = make(map[string]struct{})
+	}
+	s.byChannel[channelID][key] = struct{}{}
+}
+
+// Reader lookups. Cached slices are copied on the way out, as callers may
+// append to them.
+
+func (s *CachedStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent, error) {
+	key := "events:" + channelID
+	value, version, ok := s.lookup(key, channelID)
+	if !ok {
+		events, err := s.fill.GetByChannel(channelID, "")
+		if err != nil {
+			return nil, err
+		}
+		s.store(key, channelID, events, version)
+		value = events
+	}
+
+	var events []ReadEvent
+	for _, event := range value.([]ReadEvent) {
+		if excludeUserID == "" || event.UserID != excludeUserID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *CachedStore) GetChannelReads(channelID string) ([]types.ChannelRead, error) {
+	key := "reads:" + channelID
+	value, version, ok := s.lookup(key, channelID)
+	if !ok {
+		reads, err := s.fill.GetChannelReads(channelID)
+		if err != nil {
+			return nil, err
+		}
+		s.store(key, channelID, reads, version)
+		value = reads
+	}
+	return append([]types.ChannelRead(nil), value.([]types.ChannelRead)...), nil
+}
+
+func (s *CachedStore) GetReadersSince(channelID string, sinceMs int64, excludeUserID string) ([]string, error) {
+	key := fmt.Sprintf("since:%s:%d:%s", channelID, sinceMs, excludeUserID)
+	value, version, ok := s.lookup(key, channelID)
+	if !ok {
+		userIDs, err := s.fill.GetReadersSince(channelID, sinceMs, excludeUserID)
+		if err != nil {
+			return nil, err
+		}
+		s.store(key, channelID, userIDs, version)
+		value = userIDs
+	}
+	return append([]string(nil), value.([]string)...), nil
+}
+
+func (s *CachedStore) GetPostReaderIDs(messageID, channelID string, sinceMs int64) ([]string, error) {
+	key := fmt.Sprintf("post:%s:%s:%d", messageID, channelID, sinceMs)
+	value, version, ok := s.lookup(key, channelID)
+	if !ok {
+		userIDs, err := s.fill.GetPostReaderIDs(messageID, channelID, sinceMs)
+		if err != nil {
+			return nil, err
+		}
+		s.store(key, channelID, userIDs, version)
+		value = userIDs
+	}
+	return append([]string(nil), value.([]string)...), nil
+}
+
+// eventsInvalidation names the channels of events. An event without a
+// channel may belong to any of them.
+func eventsInvalidation(events ...ReadEvent) Invalidation {
+	var inv Invalidation
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.ChannelID == "" {
+			return Invalidation{All: true}
+		}
+		if !seen[event.ChannelID] {
+			seen[event.ChannelID] = true
+			inv.ChannelIDs = append(inv.ChannelIDs, event.ChannelID)
+		}
+	}
+	return inv
+}
+
+// channelInvalidation names channelID; an empty ID stands for every channel.
+func channelInvalidation(channelID string) Invalidation {
+	if channelID == "" {
+		return Invalidation{All: true}
+	}
+	return Invalidation{ChannelIDs: []string{channelID}}
+}
+
+// Writes outside a transaction
+
+func (s *CachedStore) Upsert(event ReadEvent) error {
+	err := s.ReceiptStore.Upsert(event)
+	s.invalidate(eventsInvalidation(event))
+	return err
+}
+
+func (s *CachedStore) SaveReadEvent(event ReadEvent) error {
+	err := s.ReceiptStore.SaveReadEvent(event)
+	s.invalidate(eventsInvalidation(event))
+	return err
+}
+
+func (s *CachedStore) UpsertChannelRead(channelID, userID, lastPostID string, lastSeenAt int64) error {
+	err := s.ReceiptStore.UpsertChannelRead(channelID, userID, lastPostID, lastSeenAt)
+	s.invalidate(channelInvalidation(channelID))
+	return err
+}
+
+func (s *CachedStore) MarkChannelReadLeft(channelID, userID string, leftAt int64) error {
+	err := s.ReceiptStore.MarkChannelReadLeft(channelID, userID, leftAt)
+	s.invalidate(channelInvalidation(channelID))
+	return err
+}
+
+func (s *CachedStore) InitializeChannelReads() error {
+	err := s.ReceiptStore.InitializeChannelReads()
+	s.invalidate(Invalidation{All: true})
+	return err
+}
+
+// Deletes. Those that may span channels drop everything, but only when
+// they removed something.
+
+func (s *CachedStore) invalidateDeleted(deleted int64, err error, inv Invalidation) (int64, error) {
+	if deleted > 0 || err != nil {
+		s.invalidate(inv)
+	}
+	return deleted, err
+}
+
+func (s *CachedStore) CleanupOlderThan(days int) error {
+	err := s.ReceiptStore.CleanupOlderThan(days)
+	s.invalidate(Invalidation{All: true})
+	return err
+}
+
+func (s *CachedStore) DeleteReadEventsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.ReceiptStore.DeleteReadEventsBefore(channelID, cutoffMs, limit)
+	return s.invalidateDeleted(deleted, err, channelInvalidation(channelID))
+}
+
+func (s *CachedStore) DeleteChannelReadsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.ReceiptStore.DeleteChannelReadsBefore(channelID, cutoffMs, limit)
+	return s.invalidateDeleted(deleted, err, channelInvalidation(channelID))
+}
+
+func (s *CachedStore) DeleteMessageReceipts(messageID string) (int64, error) {
+	deleted, err := s.ReceiptStore.DeleteMessageReceipts(messageID)
+	return s.invalidateDeleted(deleted, err, Invalidation{All: true})
+}
+
+func (s *CachedStore) DeleteChannelReceipts(channelID string, limit int) (int64, error) {
+	deleted, err := s.ReceiptStore.DeleteChannelReceipts(channelID, limit)
+	return s.invalidateDeleted(deleted, err, channelInvalidation(channelID))
+}
+
+func (s *CachedStore) DeleteUserReceipts(userID string, limit int) (int64, error) {
+	deleted, err := s.ReceiptStore.DeleteUserReceipts(userID, limit)
+	return s.invalidateDeleted(deleted, err, Invalidation{All: true})
+}
+
+// cachedTx collects the invalidations of the writes made in a transaction
+// and applies them once it commits. The wrapped stores only accept their
+// own transactions, so every *Tx method unwraps it.
+type cachedTx struct {
+	Tx
+	store *CachedStore
+	inv   Invalidation
+}
+
+func (tx *cachedTx) add(inv Invalidation) {
+	tx.inv.All = tx.inv.All || inv.All
+	for _, channelID := range inv.ChannelIDs {
+		if !containsString(tx.inv.ChannelIDs, channelID) {
+			tx.inv.ChannelIDs = append(tx.inv.ChannelIDs, channelID)
+		}
+	}
+}
+
+func (tx *cachedTx) Commit() error {
+	err := tx.Tx.Commit()
+	if err == nil {
+		if tx.inv.All {
+			tx.inv.ChannelIDs = nil
+		}
+		tx.store.invalidate(tx.inv)
+	}
+	return err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CachedStore) BeginTx() (Tx, error) {
+	tx, err := s.ReceiptStore.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	return &cachedTx{Tx: tx, store: s}, nil
+}
+
+// unwrap returns the wrapped store's transaction and a function recording
+// an invalidation for when it commits. Foreign transactions invalidate at
+// once.
+func (s *CachedStore) unwrap(tx Tx) (Tx, func(Invalidation)) {
+	if ctx, ok := tx.(*cachedTx); ok {
+		return ctx.Tx, ctx.add
+	}
+	return tx, s.invalidate
+}
+
+func (s *CachedStore) UpsertTx(tx Tx, event ReadEvent) error {
+	inner, record := s.unwrap(tx)
+	if err := s.ReceiptStore.UpsertTx(inner, event); err != nil {
+		return err
+	}
+	record(eventsInvalidation(event))
+	return nil
+}
+
+func (s *CachedStore) UpsertBatchTx(tx Tx, events []ReadEvent) error {
+	inner, record := s.unwrap(tx)
+	if err := s.ReceiptStore.UpsertBatchTx(inner, events); err != nil {
+		return err
+	}
+	record(eventsInvalidation(events...))
+	return nil
+}
+
+func (s *CachedStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error {
+	inner, record := s.unwrap(tx)
+	if err := s.ReceiptStore.UpsertChannelReadTx(inner, read); err != nil {
+		return err
+	}
+	record(channelInvalidation(read.ChannelID))
+	return nil
+}
+
+func (s *CachedStore) SaveLegalHoldTx(tx Tx, hold LegalHold) error {
+	inner, _ := s.unwrap(tx)
+	return s.ReceiptStore.SaveLegalHoldTx(inner, hold)
+}
+
+func (s *CachedStore) DeleteLegalHoldTx(tx Tx, holdID string) (bool, error) {
+	inner, _ := s.unwrap(tx)
+	return s.ReceiptStore.DeleteLegalHoldTx(inner, holdID)
+}
+
+func (s *CachedStore) AddLegalHoldAuditTx(tx Tx, entry LegalHoldAudit) error {
+	inner, _ := s.unwrap(tx)
+	return s.ReceiptStore.AddLegalHoldAuditTx(inner, entry)
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testReceiptStore(t, func(t *testing.T) ReceiptStore {
+			return NewCachedStore(NewMemoryStore(), 100)
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		testReceiptStore(t, func(t *testing.T) ReceiptStore {
+			return NewCachedStore(setupSQLiteTestStore(t), 100)
+		})
+	})
+}
+
+func TestCachedStoreHitsAndInvalidation(t *testing.T) {
+	s := NewCachedStore(NewMemoryStore(), 100)
+	var sent []Invalidation
+	s.SetInvalidationHandler(func(inv Invalidation) { sent = append(sent, inv) })
+
+	require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	assert.Equal(t, []Invalidation{{ChannelIDs: []string{"channel1"}}}, sent)
+
+	for i := 0; i < 3; i++ {
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+	}
+	events, err := s.GetByChannel("channel1", "user1")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	metrics := s.Metrics()
+	assert.Equal(t, uint64(1), metrics.Misses)
+	assert.Equal(t, uint64(3), metrics.Hits)
+	assert.Equal(t, 1, metrics.Entries)
+
+	// A write to another channel leaves channel1 cached
+	require.NoError(t, s.UpsertChannelRead("channel2", "user1", "msg2", 1))
+	_, err = s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), s.Metrics().Misses)
+
+	require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 2}))
+	events, err = s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, uint64(2), s.Metrics().Misses)
+}
+
+func TestCachedStoreTxInvalidatesOnCommit(t *testing.T) {
+	s := NewCachedStore(NewMemoryStore(), 100)
+	var sent []Invalidation
+	s.SetInvalidationHandler(func(inv Invalidation) { sent = append(sent, inv) })
+
+	readers, err := s.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.Empty(t, readers)
+
+	tx, err := s.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, s.UpsertBatchTx(tx, []ReadEvent{
+		{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1},
+		{MessageID: "msg2", UserID: "user1", ChannelID: "channel2", Timestamp: 1},
+	}))
+	require.NoError(t, s.UpsertChannelReadTx(tx, types.ChannelRead{ChannelID: "channel1", UserID: "user1", LastPostID: "msg1", LastSeenAt: 1}))
+	assert.Empty(t, sent)
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, []Invalidation{{ChannelIDs: []string{"channel1", "channel2"}}}, sent)
+
+	readers, err = s.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1"}, readers)
+
+	// A rolled back transaction has nothing to invalidate
+	tx, err = s.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, s.UpsertTx(tx, ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 2}))
+	require.NoError(t, tx.Rollback())
+	assert.Len(t, sent, 1)
+}
+
+func TestCachedStoreApply(t *testing.T) {
+	inner := NewMemoryStore()
+	s := NewCachedStore(inner, 100)
+	s.SetInvalidationHandler(func(Invalidation) { t.Fatal("applied invalidations are not sent on") })
+
+	_, err := s.GetPostReaderIDs("msg1", "channel1", 0)
+	require.NoError(t, err)
+
+	// Another node wrote behind this cache's back
+	require.NoError(t, inner.UpsertChannelRead("channel1", "user1", "msg1", 1))
+	require.NoError(t, inner.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	readers, err := s.GetPostReaderIDs("msg1", "channel1", 0)
+	require.NoError(t, err)
+	assert.Empty(t, readers)
+
+	s.Apply(Invalidation{ChannelIDs: []string{"channel1"}})
+	readers, err = s.GetPostReaderIDs("msg1", "channel1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user1"}, readers)
+
+	s.Apply(Invalidation{All: true})
+	assert.Zero(t, s.Metrics().Entries)
+	assert.Equal(t, uint64(2), s.Metrics().Invalidations)
+}
+
+func TestCachedStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewCachedStore(NewMemoryStore(), 2)
+
+	for _, channelID := range []string{"channel1", "channel2", "channel1", "channel3"} {
+		_, err := s.GetChannelReads(channelID)
+		require.NoError(t, err)
+	}
+	metrics := s.Metrics()
+	assert.Equal(t, 2, metrics.Entries)
+	assert.Equal(t, uint64(1), metrics.Evictions)
+
+	// channel2 went, channel1 stayed
+	_, err := s.GetChannelReads("channel1")
+	require.NoError(t, err)
+	_, err = s.GetChannelReads("channel2")
+	require.NoError(t, err)
+	metrics = s.Metrics()
+	assert.Equal(t, uint64(2), metrics.Hits)
+	assert.Equal(t, uint64(4), metrics.Misses)
+}
+
+func TestCachedStoreFillsFromPrimary(t *testing.T) {
+	primary := setupSQLiteTestStore(t)
+	lagging := setupSQLiteTestStore(t)
+	primary.SetReplicas(lagging.db)
+	s := NewCachedStore(primary, 100)
+
+	// The replica has yet to see the write when the next lookup misses
+	require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.NoError(t, s.UpsertChannelRead("channel1", "user2", "msg1", 1))
+	readers, err := s.GetReadersSince("channel1", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, readers)
+	readers, err = s.GetPostReaderIDs("msg1", "channel1", 0)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user1", "user2"}, readers)
+
+	// Lookups the cache does not keep still go to the replica
+	postReads, err := s.GetPostReaders("msg1", "channel1", 0, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, postReads)
+}
@@ -10,16 +10,18 @@ import (
 // UpsertChannelRead updates or inserts a channel read record
 func (s *MySQLStore) UpsertChannelRead(channelID, userID, lastPostID string, lastSeenAt int64) error {
 	query := `
-		INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at, source)
+		VALUES (?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE
 		last_post_id = CASE
 			WHEN last_seen_at < VALUES(last_seen_at) THEN VALUES(last_post_id)
 			ELSE last_post_id
 		END,
-		last_seen_at = GREATEST(last_seen_at, VALUES(last_seen_at))
+		source = IF(last_seen_at < VALUES(last_seen_at), VALUES(source), source),
+		last_seen_at = GREATEST(last_seen_at, VALUES(last_seen_at)),
+		left_at = IF(left_at < VALUES(last_seen_at), 0, left_at)
 	`
-	_, err := s.db.Exec(query, channelID, userID, lastPostID, lastSeenAt)
+	_, err := s.db.Exec(query, channelID, userID, lastPostID, lastSeenAt, types.ReadSourceClient)
 	if err != nil {
 		return fmt.Errorf("failed to upsert channel read: %w", err)
 	}
@@ -29,12 +31,12 @@ func (s *MySQLStore) UpsertChannelRead(channelID, userID, lastPostID string, las
 // GetChannelReads gets all read receipts for a channel
 func (s *MySQLStore) GetChannelReads(channelID string) ([]types.ChannelRead, error) {
 	query := `
-		SELECT channel_id, user_id, last_post_id, last_seen_at
+		SELECT channel_id, user_id, last_post_id, last_seen_at, source
 		FROM channel_reads
-		WHERE channel_id = ?
+		WHERE channel_id = ? AND left_at = 0
 		ORDER BY last_seen_at DESC
 	`
-	rows, err := s.db.Query(query, channelID)
+	rows, err := s.readQuery(query, channelID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query channel reads: %w", err)
 	}
@@ -43,7 +45,7 @@ func (s *MySQLStore) GetChannelReads(channelID string) ([]types.ChannelRead, err
 	var reads []types.ChannelRead
 	for rows.Next() {
 		var read types.ChannelRead
-		if err := rows.Scan(&read.ChannelID, &read.UserID, &read.LastPostID, &read.LastSeenAt); err != nil {
+		if err := rows.Scan(&read.ChannelID, &read.UserID, &read.LastPostID, &read.LastSeenAt, &read.Source); err != nil {
 			return nil, fmt.Errorf("failed to scan channel read: %w", err)
 		}
 		reads = append(reads, read)
@@ -54,27 +56,24 @@ func (s *MySQLStore) GetChannelReads(channelID string) ([]types.ChannelRead, err
 	return reads, nil
 }
 
-// Initialize creates required tables and indices for channel reads
-func (s *MySQLStore) InitializeChannelReads() error {
-	// Create channel_reads table if it doesn't exist
-	createTable := `
-	CREATE TABLE IF NOT EXISTS channel_reads (
-		channel_id VARCHAR(255) NOT NULL,
-		user_id VARCHAR(255) NOT NULL,
-		last_post_id VARCHAR(255) NOT NULL,
-		last_seen_at BIGINT NOT NULL,
-		PRIMARY KEY (channel_id, user_id),
-		INDEX idx_channel_reads_channel_id (channel_id),
-		INDEX idx_channel_reads_user_id (user_id),
-		INDEX idx_channel_reads_last_seen (last_seen_at)
-	)
+// MarkChannelReadLeft tombstones a user's channel read when they leave
+func (s *MySQLStore) MarkChannelReadLeft(channelID, userID string, leftAt int64) error {
+	query := `
+		UPDATE channel_reads SET left_at = ?
+		WHERE channel_id = ? AND user_id = ?
 	`
-	if _, err := s.db.Exec(createTable); err != nil {
-		return fmt.Errorf("failed to create channel_reads table: %w", err)
+	if _, err := s.db.Exec(query, leftAt, channelID, userID); err != nil {
+		return fmt.Errorf("failed to mark channel read left: %w", err)
 	}
 	return nil
 }
 
+// InitializeChannelReads is kept for interface compatibility; channel_reads
+// is created by the versioned migrations run in Initialize.
+func (s *MySQLStore) InitializeChannelReads() error {
+	return s.Initialize()
+}
+
 // UpsertChannelReadTx updates a channel read record within a transaction
 func (s *MySQLStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error {
 	sqlTx, ok := tx.(*sql.Tx)
@@ -83,28 +82,19 @@ func (s *MySQLStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error {
 	}
 
 	query := `
-		INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at, source)
+		VALUES (?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE
 		last_post_id = CASE
 			WHEN last_seen_at < VALUES(last_seen_at) THEN VALUES(last_post_id)
 			ELSE last_post_id
 		END,
-		last_seen_at = GREATEST(last_seen_at, VALUES(last_seen_at))
+		source = IF(last_seen_at < VALUES(last_seen_at), VALUES(source), source),
+		last_seen_at = GREATEST(last_seen_at, VALUES(last_seen_at)),
+		left_at = IF(left_at < VALUES(last_seen_at), 0, left_at)
 	`
-	result, err := sqlTx.Exec(query, read.ChannelID, read.UserID, read.LastPostID, read.LastSeenAt)
-	if err != nil {
+	if _, err := sqlTx.Exec(query, read.ChannelID, read.UserID, read.LastPostID, read.LastSeenAt, readSource(read)); err != nil {
 		return fmt.Errorf("failed to upsert channel read: %w", err)
 	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get affected rows: %w", err)
-	}
-
-	if rows == 0 {
-		return fmt.Errorf("channel read upsert affected 0 rows: %+v", read)
-	}
-
 	return nil
 }
@@ -0,0 +1,714 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReceiptStore is the conformance suite every ReceiptStore backend must
+// pass. newStore must return an empty, initialized store for each subtest.
+func testReceiptStore(t *testing.T, newStore func(t *testing.T) ReceiptStore) {
+	now := time.Now().UnixMilli()
+
+	t.Run("test upsert and get", func(t *testing.T) {
+		s := newStore(t)
+		event := ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}
+		require.NoError(t, s.Upsert(event))
+
+		events, err := s.GetByChannel("channel1", "user2")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, event, events[0])
+
+		// Upserting the same row again must be a no-op, not an error
+		require.NoError(t, s.Upsert(event))
+		events, err = s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+	})
+
+	t.Run("upsert keeps the greatest timestamp", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now - 1000}))
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, now, events[0].Timestamp)
+
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now + 1000}))
+		events, err = s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, now+1000, events[0].Timestamp)
+	})
+
+	t.Run("upsert without channel keeps the known channel", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", Timestamp: now + 1}))
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, now+1, events[0].Timestamp)
+	})
+
+	t.Run("get by channel filters and orders", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now - 2000}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: now - 1000}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg3", UserID: "user1", ChannelID: "channel2", Timestamp: now}))
+
+		// An empty excludeUserID excludes nobody
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.Equal(t, "user2", events[0].UserID)
+		assert.Equal(t, "msg2", events[1].MessageID)
+		assert.Equal(t, "msg1", events[2].MessageID)
+
+		events, err = s.GetByChannel("channel1", "user1")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "user2", events[0].UserID)
+
+		events, err = s.GetByChannel("missing", "")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("transaction commit and rollback", func(t *testing.T) {
+		s := newStore(t)
+
+		tx, err := s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.UpsertTx(tx, ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.UpsertChannelReadTx(tx, types.ChannelRead{ChannelID: "channel1", UserID: "user1", LastPostID: "msg1", LastSeenAt: now}))
+		require.NoError(t, tx.Commit())
+
+		tx, err = s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.UpsertTx(tx, ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.UpsertChannelReadTx(tx, types.ChannelRead{ChannelID: "channel1", UserID: "user2", LastPostID: "msg2", LastSeenAt: now}))
+		require.NoError(t, tx.Rollback())
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "msg1", events[0].MessageID)
+
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, "user1", reads[0].UserID)
+	})
+
+	t.Run("upsert tx keeps the greatest timestamp", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+
+		tx, err := s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.UpsertTx(tx, ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now - 1000}))
+		require.NoError(t, tx.Commit())
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, now, events[0].Timestamp)
+	})
+
+	t.Run("upsert batch tx", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+
+		// More rows than one statement holds, with duplicates inside the batch
+		batch := []ReadEvent{
+			{MessageID: "msg1", UserID: "user1", Timestamp: now - 1000},
+			{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: now},
+			{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: now + 1000},
+		}
+		for i := 0; i < batchChunkSize; i++ {
+			batch = append(batch, ReadEvent{MessageID: "bulk", UserID: fmt.Sprintf("user%03d", i), ChannelID: "channel2", Timestamp: now})
+		}
+
+		tx, err := s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.UpsertBatchTx(tx, batch))
+		require.NoError(t, tx.Commit())
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: now + 1000}, events[0])
+		assert.Equal(t, ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now}, events[1])
+
+		events, err = s.GetByChannel("channel2", "")
+		require.NoError(t, err)
+		assert.Len(t, events, batchChunkSize)
+
+		tx, err = s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.UpsertBatchTx(tx, []ReadEvent{{MessageID: "msg3", UserID: "user1", ChannelID: "channel1", Timestamp: now}}))
+		require.NoError(t, tx.Rollback())
+
+		events, err = s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		assert.Len(t, events, 2)
+	})
+
+	t.Run("get post reader ids", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user3", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg2", UserID: "user4", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "msg9", now))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user3", "msg9", now))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user2", "msg0", now-5000))
+		require.NoError(t, s.UpsertChannelRead("channel2", "user5", "msg8", now))
+
+		// user3 matches both rules but is listed once; user2 saw the channel before the post
+		readers, err := s.GetPostReaderIDs("msg1", "channel1", now-1000)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user1", "user3"}, readers)
+
+		readers, err = s.GetPostReaderIDs("missing", "channel3", 0)
+		require.NoError(t, err)
+		assert.Empty(t, readers)
+
+		// user3's read event wins over their channel read
+		require.NoError(t, s.UpsertChannelRead("channel1", "user6", "msg9", now+1000))
+		reads, err := s.GetPostReaders("msg1", "channel1", now-1000, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []PostRead{
+			{UserID: "user6", ReadAt: now + 1000, Source: types.ReadSourceInferred},
+			{UserID: "user1", ReadAt: now, Source: types.ReadSourceInferred},
+			{UserID: "user3", ReadAt: now, Source: types.ReadSourceClient},
+		}, reads)
+
+		reads, err = s.GetPostReaders("msg1", "channel1", now-1000, 1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []PostRead{{UserID: "user1", ReadAt: now, Source: types.ReadSourceInferred}}, reads)
+		reads, err = s.GetPostReaders("msg1", "channel1", now-1000, 3, 10)
+		require.NoError(t, err)
+		assert.Empty(t, reads)
+	})
+
+	t.Run("bounded deletes", func(t *testing.T) {
+		s := newStore(t)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, s.Upsert(ReadEvent{MessageID: fmt.Sprintf("old%d", i), UserID: "user1", ChannelID: "channel1", Timestamp: now - 1000}))
+			require.NoError(t, s.UpsertChannelRead(fmt.Sprintf("channel%d", i), "user1", "post1", now-1000))
+		}
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "new", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user2", "post1", now))
+
+		deleted, err := s.DeleteReadEventsBefore("", now, 3)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, deleted)
+		deleted, err = s.DeleteReadEventsBefore("", now, 3)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, deleted)
+		deleted, err = s.DeleteReadEventsBefore("", now, 3)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+
+		deleted, err = s.DeleteChannelReadsBefore("", now, 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, deleted)
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "new", events[0].MessageID)
+
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, "user2", reads[0].UserID)
+	})
+
+	t.Run("bounded deletes in one channel", func(t *testing.T) {
+		s := newStore(t)
+		for _, channelID := range []string{"channel1", "channel2"} {
+			require.NoError(t, s.Upsert(ReadEvent{MessageID: channelID + "-old", UserID: "user1", ChannelID: channelID, Timestamp: now - 1000}))
+			require.NoError(t, s.UpsertChannelRead(channelID, "user1", "post1", now-1000))
+		}
+		require.NoError(t, s.UpsertChannelRead("channel3", "user1", "post1", now))
+
+		channelIDs, err := s.GetReceiptChannelIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"channel1", "channel2", "channel3"}, channelIDs)
+
+		deleted, err := s.DeleteReadEventsBefore("channel1", now, 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		deleted, err = s.DeleteChannelReadsBefore("channel1", now, 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+
+		events, err := s.GetByChannel("channel2", "")
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+		reads, err := s.GetChannelReads("channel2")
+		require.NoError(t, err)
+		assert.Len(t, reads, 1)
+
+		channelIDs, err = s.GetReceiptChannelIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"channel2", "channel3"}, channelIDs)
+	})
+
+	t.Run("channel read keeps the newest post", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post2", now))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post1", now-1000))
+
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, types.ChannelRead{ChannelID: "channel1", UserID: "user1", LastPostID: "post2", LastSeenAt: now, Source: types.ReadSourceClient}, reads[0])
+
+		tx, err := s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.UpsertChannelReadTx(tx, types.ChannelRead{ChannelID: "channel1", UserID: "user1", LastPostID: "post0", LastSeenAt: now - 5000}))
+		require.NoError(t, tx.Commit())
+
+		reads, err = s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, "post2", reads[0].LastPostID)
+
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post3", now+1000))
+		reads, err = s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, "post3", reads[0].LastPostID)
+		assert.Equal(t, now+1000, reads[0].LastSeenAt)
+	})
+
+	t.Run("channel read source follows the newest read", func(t *testing.T) {
+		s := newStore(t)
+		inferred := func(lastSeenAt int64) {
+			tx, err := s.BeginTx()
+			require.NoError(t, err)
+			require.NoError(t, s.UpsertChannelReadTx(tx, types.ChannelRead{ChannelID: "channel1", UserID: "user1", LastSeenAt: lastSeenAt, Source: types.ReadSourceInferred}))
+			require.NoError(t, tx.Commit())
+		}
+
+		inferred(now)
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, types.ReadSourceInferred, reads[0].Source)
+
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post1", now+1000))
+		inferred(now + 500)
+		reads, err = s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, types.ChannelRead{ChannelID: "channel1", UserID: "user1", LastPostID: "post1", LastSeenAt: now + 1000, Source: types.ReadSourceClient}, reads[0])
+	})
+
+	t.Run("get channel reads orders by last seen", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post1", now-1000))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user2", "post2", now))
+		require.NoError(t, s.UpsertChannelRead("channel2", "user3", "post3", now))
+
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 2)
+		assert.Equal(t, "user2", reads[0].UserID)
+		assert.Equal(t, "user1", reads[1].UserID)
+	})
+
+	t.Run("get readers since", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post1", now-1000))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user2", "post2", now))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user3", "post2", now))
+		require.NoError(t, s.UpsertChannelRead("channel2", "user4", "post3", now))
+
+		// The since bound is inclusive
+		readers, err := s.GetReadersSince("channel1", now, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user2", "user3"}, readers)
+
+		readers, err = s.GetReadersSince("channel1", now-1000, "user2")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user3", "user1"}, readers)
+
+		readers, err = s.GetReadersSince("channel1", now+1, "")
+		require.NoError(t, err)
+		assert.Empty(t, readers)
+	})
+
+	t.Run("channel read left", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post1", now-1000))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user2", "post1", now-1000))
+		require.NoError(t, s.MarkChannelReadLeft("channel1", "user1", now))
+		// Unknown rows are ignored
+		require.NoError(t, s.MarkChannelReadLeft("channel1", "user3", now))
+
+		readers, err := s.GetReadersSince("channel1", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user2"}, readers)
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		assert.Equal(t, []types.ChannelRead{
+			{ChannelID: "channel1", UserID: "user2", LastPostID: "post1", LastSeenAt: now - 1000, Source: types.ReadSourceClient},
+		}, reads)
+		readers, err = s.GetPostReaderIDs("post1", "channel1", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user2"}, readers)
+
+		// A read queued before the user left does not bring the row back
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post1", now-500))
+		readers, err = s.GetReadersSince("channel1", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user2"}, readers)
+
+		// Reading after rejoining does
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "post2", now+1000))
+		readers, err = s.GetReadersSince("channel1", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user1", "user2"}, readers)
+	})
+
+	t.Run("test cleanup", func(t *testing.T) {
+		s := newStore(t)
+		old := time.Now().AddDate(0, 0, -31).UnixMilli()
+
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: old}))
+		require.NoError(t, s.Upsert(ReadEvent{MessageID: "msg3", UserID: "user1", ChannelID: "channel1", Timestamp: now}))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user1", "msg2", old))
+		require.NoError(t, s.UpsertChannelRead("channel1", "user2", "msg3", now))
+
+		// Cleanup events older than 30 days
+		require.NoError(t, s.CleanupOlderThan(30))
+
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1, "expected only one event after cleanup")
+		assert.Equal(t, "msg3", events[0].MessageID)
+
+		reads, err := s.GetChannelReads("channel1")
+		require.NoError(t, err)
+		require.Len(t, reads, 1)
+		assert.Equal(t, "user2", reads[0].UserID)
+	})
+
+	t.Run("delete by message, channel and user", func(t *testing.T) {
+		s := newStore(t)
+		for _, event := range []ReadEvent{
+			{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: now},
+			{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: now},
+			{MessageID: "msg2", UserID: "user1", ChannelID: "channel1", Timestamp: now},
+			{MessageID: "msg3", UserID: "user1", ChannelID: "channel2", Timestamp: now},
+			{MessageID: "msg4", UserID: "user2", ChannelID: "channel3", Timestamp: now},
+		} {
+			require.NoError(t, s.Upsert(event))
+			require.NoError(t, s.UpsertChannelRead(event.ChannelID, event.UserID, event.MessageID, now))
+		}
+
+		userIDs, err := s.GetReceiptUserIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user1", "user2"}, userIDs)
+		messageIDs, err := s.GetReceiptMessageIDs("channel1", "", 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"msg1", "msg2"}, messageIDs)
+		messageIDs, err = s.GetReceiptMessageIDs("channel1", "", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"msg1"}, messageIDs)
+		messageIDs, err = s.GetReceiptMessageIDs("channel1", "msg1", 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"msg2"}, messageIDs)
+
+		deleted, err := s.DeleteMessageReceipts("msg1")
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, deleted)
+		messageIDs, err = s.GetReceiptMessageIDs("channel1", "", 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"msg2"}, messageIDs)
+		events, err := s.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		for _, event := range events {
+			assert.NotEqual(t, "msg1", event.MessageID)
+		}
+
+		// channel1 has one read event and two channel reads left; the limit
+		// spans both tables
+		deleted, err = s.DeleteChannelReceipts("channel1", 2)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, deleted)
+		deleted, err = s.DeleteChannelReceipts("channel1", 2)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		channelIDs, err := s.GetReceiptChannelIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"channel2", "channel3"}, channelIDs)
+
+		deleted, err = s.DeleteUserReceipts("user1", 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, deleted)
+		userIDs, err = s.GetReceiptUserIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user2"}, userIDs)
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		s := newStore(t)
+		old := time.Now().AddDate(0, 0, -31).UnixMilli()
+
+		require.NoError(t, s.SaveDeliveries([]DeliveryEvent{
+			{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", DeliveredAt: old},
+			{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", DeliveredAt: now},
+			{MessageID: "msg2", UserID: "user1", ChannelID: "channel2", DeliveredAt: old},
+			{MessageID: "msg3", UserID: "held-user", ChannelID: "channel2", DeliveredAt: old},
+		}))
+		// The first delivery wins
+		require.NoError(t, s.SaveDeliveries([]DeliveryEvent{{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", DeliveredAt: now}}))
+
+		userIDs, err := s.GetDeliveredUserIDs("msg1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user1", "user2"}, userIDs)
+
+		channelIDs, err := s.GetReceiptChannelIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"channel1", "channel2"}, channelIDs)
+		userIDs, err = s.GetReceiptUserIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"held-user", "user1", "user2"}, userIDs)
+
+		tx, err := s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.SaveLegalHoldTx(tx, LegalHold{ID: "hold1", UserID: "held-user", Reason: "case 1", CreatedBy: "admin", CreatedAt: now, UpdatedAt: now}))
+		require.NoError(t, tx.Commit())
+
+		deleted, err := s.DeleteDeliveriesBefore("channel1", now, 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		userIDs, err = s.GetDeliveredUserIDs("msg1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user1"}, userIDs)
+
+		require.NoError(t, s.CleanupOlderThan(30))
+		userIDs, err = s.GetDeliveredUserIDs("msg2")
+		require.NoError(t, err)
+		assert.Empty(t, userIDs)
+		userIDs, err = s.GetDeliveredUserIDs("msg3")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"held-user"}, userIDs)
+
+		deleted, err = s.DeleteMessageReceipts("msg1")
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		deleted, err = s.DeleteChannelReceipts("channel2", 10)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		deleted, err = s.DeleteUserReceipts("held-user", 10)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+
+		require.NoError(t, s.SaveDeliveries([]DeliveryEvent{{MessageID: "msg4", UserID: "user1", ChannelID: "channel2", DeliveredAt: now}}))
+		deleted, err = s.DeleteChannelReceipts("channel2", 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		userIDs, err = s.GetReceiptUserIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"held-user"}, userIDs)
+	})
+
+	t.Run("acknowledgements", func(t *testing.T) {
+		s := newStore(t)
+		old := time.Now().AddDate(0, 0, -31).UnixMilli()
+
+		added, err := s.SaveAcknowledgement(Acknowledgement{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", AckedAt: old + 1})
+		require.NoError(t, err)
+		assert.True(t, added)
+		added, err = s.SaveAcknowledgement(Acknowledgement{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", AckedAt: old})
+		require.NoError(t, err)
+		assert.True(t, added)
+		// The first acknowledgement wins
+		added, err = s.SaveAcknowledgement(Acknowledgement{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", AckedAt: now})
+		require.NoError(t, err)
+		assert.False(t, added)
+		_, err = s.SaveAcknowledgement(Acknowledgement{MessageID: "msg2", UserID: "user1", ChannelID: "channel2", AckedAt: old})
+		require.NoError(t, err)
+
+		acks, err := s.GetAcknowledgements("msg1")
+		require.NoError(t, err)
+		assert.Equal(t, []Acknowledgement{
+			{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", AckedAt: old},
+			{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", AckedAt: old + 1},
+		}, acks)
+
+		channelIDs, err := s.GetReceiptChannelIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"channel1", "channel2"}, channelIDs)
+
+		// Retention keeps acknowledgements
+		require.NoError(t, s.CleanupOlderThan(30))
+		acks, err = s.GetAcknowledgements("msg1")
+		require.NoError(t, err)
+		assert.Len(t, acks, 2)
+
+		deleted, err := s.DeleteUserReceipts("user2", 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		deleted, err = s.DeleteChannelReceipts("channel2", 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		deleted, err = s.DeleteMessageReceipts("msg1")
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+
+		userIDs, err := s.GetReceiptUserIDs()
+		require.NoError(t, err)
+		assert.Empty(t, userIDs)
+	})
+
+	t.Run("receipt settings", func(t *testing.T) {
+		s := newStore(t)
+
+		setting, err := s.GetReceiptSetting(SettingScopeChannel, "channel1")
+		require.NoError(t, err)
+		assert.Nil(t, setting)
+
+		require.NoError(t, s.SaveReceiptSetting(ReceiptSetting{Scope: SettingScopeChannel, ScopeID: "channel1", Enabled: false, UpdatedBy: "admin", UpdatedAt: now}))
+		require.NoError(t, s.SaveReceiptSetting(ReceiptSetting{Scope: SettingScopeTeam, ScopeID: "team2", Enabled: true, UpdatedBy: "admin", UpdatedAt: now}))
+		require.NoError(t, s.SaveReceiptSetting(ReceiptSetting{Scope: SettingScopeTeam, ScopeID: "team1", Enabled: true, UpdatedBy: "admin", UpdatedAt: now}))
+		// Saving again replaces the setting
+		require.NoError(t, s.SaveReceiptSetting(ReceiptSetting{Scope: SettingScopeTeam, ScopeID: "team1", Enabled: false, UpdatedBy: "other", UpdatedAt: now + 1}))
+
+		setting, err = s.GetReceiptSetting(SettingScopeChannel, "channel1")
+		require.NoError(t, err)
+		assert.Equal(t, &ReceiptSetting{Scope: SettingScopeChannel, ScopeID: "channel1", Enabled: false, UpdatedBy: "admin", UpdatedAt: now}, setting)
+
+		// Scopes are kept apart
+		setting, err = s.GetReceiptSetting(SettingScopeTeam, "channel1")
+		require.NoError(t, err)
+		assert.Nil(t, setting)
+
+		settings, err := s.GetReceiptSettings(SettingScopeTeam)
+		require.NoError(t, err)
+		assert.Equal(t, []ReceiptSetting{
+			{Scope: SettingScopeTeam, ScopeID: "team1", Enabled: false, UpdatedBy: "other", UpdatedAt: now + 1},
+			{Scope: SettingScopeTeam, ScopeID: "team2", Enabled: true, UpdatedBy: "admin", UpdatedAt: now},
+		}, settings)
+	})
+
+	t.Run("legal holds", func(t *testing.T) {
+		s := newStore(t)
+
+		tx, err := s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.SaveLegalHoldTx(tx, LegalHold{ID: "hold1", ChannelID: "held-channel", Reason: "case 1", CreatedBy: "admin", CreatedAt: now, UpdatedAt: now}))
+		require.NoError(t, s.SaveLegalHoldTx(tx, LegalHold{ID: "hold2", UserID: "held-user", Reason: "case 2", CreatedBy: "admin", CreatedAt: now + 1, UpdatedAt: now + 1}))
+		require.NoError(t, s.AddLegalHoldAuditTx(tx, LegalHoldAudit{ID: "audit1", HoldID: "hold1", Action: "create", ActorID: "admin", Details: "{}", CreatedAt: now}))
+		require.NoError(t, s.AddLegalHoldAuditTx(tx, LegalHoldAudit{ID: "audit2", HoldID: "hold2", Action: "create", ActorID: "admin", Details: "{}", CreatedAt: now + 1}))
+		require.NoError(t, tx.Commit())
+
+		// A rolled back change leaves no trace
+		tx, err = s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.SaveLegalHoldTx(tx, LegalHold{ID: "hold3", UserID: "other", Reason: "x", CreatedBy: "admin", CreatedAt: now, UpdatedAt: now}))
+		require.NoError(t, tx.Rollback())
+
+		holds, err := s.GetLegalHolds()
+		require.NoError(t, err)
+		require.Len(t, holds, 2)
+		assert.Equal(t, "hold1", holds[0].ID)
+		assert.Equal(t, "held-user", holds[1].UserID)
+
+		// Updates keep the creator
+		tx, err = s.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, s.SaveLegalHoldTx(tx, LegalHold{ID: "hold1", ChannelID: "held-channel", Reason: "case 1b", CreatedBy: "someone", CreatedAt: now + 5, UpdatedAt: now + 5}))
+		require.NoError(t, tx.Commit())
+		hold, err := s.GetLegalHold("hold1")
+		require.NoError(t, err)
+		require.NotNil(t, hold)
+		assert.Equal(t, LegalHold{ID: "hold1", ChannelID: "held-channel", Reason: "case 1b", CreatedBy: "admin", CreatedAt: now, UpdatedAt: now + 5}, *hold)
+
+		hold, err = s.GetLegalHold("missing")
+		require.NoError(t, err)
+		assert.Nil(t, hold)
+
+		audit, err := s.GetLegalHoldAudit(0, 1)
+		require.NoError(t, err)
+		require.Len(t, audit, 1)
+		assert.Equal(t, "audit2", audit[0].ID)
+
+		// Every delete path skips held channels and users
+		old := time.Now().AddDate(0, 0, -31).UnixMilli()
+		seed := func() {
+			for _, event := range []ReadEvent{
+				{MessageID: "msg1", UserID: "held-user", ChannelID: "channel1", Timestamp: old},
+				{MessageID: "msg2", UserID: "user1", ChannelID: "held-channel", Timestamp: old},
+				{MessageID: "msg3", UserID: "user1", ChannelID: "channel1", Timestamp: old},
+			} {
+				require.NoError(t, s.Upsert(event))
+				require.NoError(t, s.UpsertChannelRead(event.ChannelID, event.UserID, event.MessageID, old))
+			}
+		}
+		remaining := func() int {
+			var n int
+			for _, channelID := range []string{"channel1", "held-channel"} {
+				events, err := s.GetByChannel(channelID, "")
+				require.NoError(t, err)
+				reads, err := s.GetChannelReads(channelID)
+				require.NoError(t, err)
+				n += len(events) + len(reads)
+			}
+			return n
+		}
+
+		seed()
+		require.NoError(t, s.CleanupOlderThan(30))
+		assert.Equal(t, 4, remaining())
+
+		seed()
+		deleted, err := s.DeleteReadEventsBefore("", now, 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		deleted, err = s.DeleteChannelReadsBefore("", now, 10)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		assert.Equal(t, 4, remaining())
+
+		deleted, err = s.DeleteMessageReceipts("msg2")
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		deleted, err = s.DeleteChannelReceipts("held-channel", 10)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		deleted, err = s.DeleteUserReceipts("held-user", 10)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		assert.Equal(t, 4, remaining())
+
+		// Releasing the holds lets the purge through
+		tx, err = s.BeginTx()
+		require.NoError(t, err)
+		found, err := s.DeleteLegalHoldTx(tx, "hold1")
+		require.NoError(t, err)
+		assert.True(t, found)
+		found, err = s.DeleteLegalHoldTx(tx, "hold2")
+		require.NoError(t, err)
+		assert.True(t, found)
+		require.NoError(t, tx.Commit())
+
+		require.NoError(t, s.CleanupOlderThan(30))
+		assert.Zero(t, remaining())
+	})
+}
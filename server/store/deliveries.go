@@ -0,0 +1,134 @@
+package store
+
+import (
+	"fmt"
+)
+
+// DeliveryEvent records that a post reached a user's client. Together with
+// read events it gives the two receipt states: delivered, then read. Only
+// the first delivery of a post to a user is kept.
+type DeliveryEvent struct {
+	MessageID   string
+	UserID      string
+	ChannelID   string
+	DeliveredAt int64
+}
+
+// execSaveDeliveries inserts events one chunk at a time. build returns the
+// statement for n rows; it must leave existing rows alone.
+func (s *BaseStore) execSaveDeliveries(events []DeliveryEvent, build func(n int) string) error {
+	for start := 0; start < len(events); start += batchChunkSize {
+		end := start + batchChunkSize
+		if end > len(events) {
+			end = len(events)
+		}
+		chunk := events[start:end]
+
+		args := make([]interface{}, 0, len(chunk)*4)
+		for _, event := range chunk {
+			args = append(args, event.MessageID, event.UserID, event.ChannelID, event.DeliveredAt)
+		}
+		if _, err := s.db.Exec(build(len(chunk)), args...); err != nil {
+			return fmt.Errorf("failed to save deliveries: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) SaveDeliveries(events []DeliveryEvent) error {
+	return s.execSaveDeliveries(events, func(n int) string {
+		return `
+			INSERT INTO delivery_events (message_id, user_id, channel_id, delivered_at)
+			VALUES ` + valuesList(n, true) + `
+			ON CONFLICT (message_id, user_id) DO NOTHING
+		`
+	})
+}
+
+func (s *PostgresStore) GetDeliveredUserIDs(messageID string) ([]string, error) {
+	rows, err := s.readQuery(`SELECT user_id FROM delivery_events WHERE message_id = $1 ORDER BY user_id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+// DeleteDeliveriesBefore removes at most limit deliveries older than cutoffMs.
+func (s *PostgresStore) DeleteDeliveriesBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM delivery_events WHERE (message_id, user_id) IN (
+			SELECT message_id, user_id FROM delivery_events
+			WHERE delivered_at < $1 AND ($2 = '' OR channel_id = $2)
+			`+notHeld+`
+			LIMIT $3
+		)
+	`, cutoffMs, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete deliveries: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *MySQLStore) SaveDeliveries(events []DeliveryEvent) error {
+	return s.execSaveDeliveries(events, func(n int) string {
+		return `
+			INSERT IGNORE INTO delivery_events (message_id, user_id, channel_id, delivered_at)
+			VALUES ` + valuesList(n, false)
+	})
+}
+
+func (s *MySQLStore) GetDeliveredUserIDs(messageID string) ([]string, error) {
+	rows, err := s.readQuery(`SELECT user_id FROM delivery_events WHERE message_id = ? ORDER BY user_id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+// DeleteDeliveriesBefore removes at most limit deliveries older than cutoffMs.
+func (s *MySQLStore) DeleteDeliveriesBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM delivery_events
+		WHERE delivered_at < ? AND (? = '' OR channel_id = ?)
+		`+notHeld+`
+		LIMIT ?
+	`, cutoffMs, channelID, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete deliveries: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *SQLiteStore) SaveDeliveries(events []DeliveryEvent) error {
+	return s.execSaveDeliveries(events, func(n int) string {
+		return `
+			INSERT INTO delivery_events (message_id, user_id, channel_id, delivered_at)
+			VALUES ` + valuesList(n, false) + `
+			ON CONFLICT (message_id, user_id) DO NOTHING
+		`
+	})
+}
+
+func (s *SQLiteStore) GetDeliveredUserIDs(messageID string) ([]string, error) {
+	rows, err := s.readQuery(`SELECT user_id FROM delivery_events WHERE message_id = ? ORDER BY user_id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+// DeleteDeliveriesBefore removes at most limit deliveries older than cutoffMs.
+func (s *SQLiteStore) DeleteDeliveriesBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM delivery_events WHERE rowid IN (
+			SELECT rowid FROM delivery_events
+			WHERE delivered_at < ? AND (? = '' OR channel_id = ?)
+			`+notHeld+`
+			LIMIT ?
+		)
+	`, cutoffMs, channelID, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete deliveries: %w", err)
+	}
+	return deleted, nil
+}
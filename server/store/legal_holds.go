@@ -0,0 +1,329 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// LegalHold exempts one channel or one user from every receipt deletion.
+// Exactly one of ChannelID and UserID is set.
+type LegalHold struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	Reason    string `json:"reason"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// LegalHoldAudit records one change to a legal hold. Details holds the
+// hold as it was after the change, or before it for a delete.
+type LegalHoldAudit struct {
+	ID        string `json:"id"`
+	HoldID    string `json:"hold_id"`
+	Action    string `json:"action"` // create | update | delete
+	ActorID   string `json:"actor_id"`
+	Details   string `json:"details"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// notHeld excludes rows of held channels and users. Every DELETE on
+// read_events, channel_reads, delivery_events or acknowledgements must
+// append it to its WHERE clause.
+const notHeld = `
+	AND channel_id NOT IN (SELECT channel_id FROM legal_holds WHERE channel_id != '')
+	AND user_id NOT IN (SELECT user_id FROM legal_holds WHERE user_id != '')
+`
+
+const selectLegalHolds = `
+	SELECT id, channel_id, user_id, reason, created_by, created_at, updated_at
+	FROM legal_holds
+`
+
+func scanLegalHolds(rows *sql.Rows) ([]LegalHold, error) {
+	defer rows.Close()
+
+	var holds []LegalHold
+	for rows.Next() {
+		var hold LegalHold
+		if err := rows.Scan(&hold.ID, &hold.ChannelID, &hold.UserID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt, &hold.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan legal hold: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating legal holds: %w", err)
+	}
+	return holds, nil
+}
+
+func scanLegalHoldAudit(rows *sql.Rows) ([]LegalHoldAudit, error) {
+	defer rows.Close()
+
+	var entries []LegalHoldAudit
+	for rows.Next() {
+		var entry LegalHoldAudit
+		if err := rows.Scan(&entry.ID, &entry.HoldID, &entry.Action, &entry.ActorID, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan legal hold audit: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating legal hold audit: %w", err)
+	}
+	return entries, nil
+}
+
+// firstLegalHold returns the only hold in holds, or nil.
+func firstLegalHold(holds []LegalHold, err error) (*LegalHold, error) {
+	if err != nil || len(holds) == 0 {
+		return nil, err
+	}
+	return &holds[0], nil
+}
+
+func sqlTxFor(tx Tx) (*sql.Tx, error) {
+	sqlTx, ok := tx.(*sql.Tx)
+	if !ok {
+		return nil, fmt.Errorf("invalid transaction type: %T", tx)
+	}
+	return sqlTx, nil
+}
+
+// Holds are read from the primary: a replica lagging behind a new hold
+// must not let a purge through.
+
+func (s *PostgresStore) SaveLegalHoldTx(tx Tx, hold LegalHold) error {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return err
+	}
+	_, err = sqlTx.Exec(`
+		INSERT INTO legal_holds (id, channel_id, user_id, reason, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+		channel_id = EXCLUDED.channel_id,
+		user_id = EXCLUDED.user_id,
+		reason = EXCLUDED.reason,
+		updated_at = EXCLUDED.updated_at
+	`, hold.ID, hold.ChannelID, hold.UserID, hold.Reason, hold.CreatedBy, hold.CreatedAt, hold.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save legal hold: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteLegalHoldTx(tx Tx, holdID string) (bool, error) {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return false, err
+	}
+	result, err := sqlTx.Exec(`DELETE FROM legal_holds WHERE id = $1`, holdID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete legal hold: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *PostgresStore) GetLegalHold(holdID string) (*LegalHold, error) {
+	rows, err := s.db.Query(selectLegalHolds+`WHERE id = $1`, holdID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal hold: %w", err)
+	}
+	return firstLegalHold(scanLegalHolds(rows))
+}
+
+func (s *PostgresStore) GetLegalHolds() ([]LegalHold, error) {
+	rows, err := s.db.Query(selectLegalHolds + `ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal holds: %w", err)
+	}
+	return scanLegalHolds(rows)
+}
+
+func (s *PostgresStore) AddLegalHoldAuditTx(tx Tx, entry LegalHoldAudit) error {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return err
+	}
+	_, err = sqlTx.Exec(`
+		INSERT INTO legal_hold_audit (id, hold_id, action, actor_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, entry.ID, entry.HoldID, entry.Action, entry.ActorID, entry.Details, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add legal hold audit: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetLegalHoldAudit(offset, limit int) ([]LegalHoldAudit, error) {
+	offset, limit = pageBounds(offset, limit)
+	rows, err := s.readQuery(`
+		SELECT id, hold_id, action, actor_id, details, created_at
+		FROM legal_hold_audit
+		ORDER BY created_at DESC, id
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal hold audit: %w", err)
+	}
+	return scanLegalHoldAudit(rows)
+}
+
+func (s *MySQLStore) SaveLegalHoldTx(tx Tx, hold LegalHold) error {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return err
+	}
+	_, err = sqlTx.Exec(`
+		INSERT INTO legal_holds (id, channel_id, user_id, reason, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		channel_id = VALUES(channel_id),
+		user_id = VALUES(user_id),
+		reason = VALUES(reason),
+		updated_at = VALUES(updated_at)
+	`, hold.ID, hold.ChannelID, hold.UserID, hold.Reason, hold.CreatedBy, hold.CreatedAt, hold.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save legal hold: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) DeleteLegalHoldTx(tx Tx, holdID string) (bool, error) {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return false, err
+	}
+	result, err := sqlTx.Exec(`DELETE FROM legal_holds WHERE id = ?`, holdID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete legal hold: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *MySQLStore) GetLegalHold(holdID string) (*LegalHold, error) {
+	rows, err := s.db.Query(selectLegalHolds+`WHERE id = ?`, holdID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal hold: %w", err)
+	}
+	return firstLegalHold(scanLegalHolds(rows))
+}
+
+func (s *MySQLStore) GetLegalHolds() ([]LegalHold, error) {
+	rows, err := s.db.Query(selectLegalHolds + `ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal holds: %w", err)
+	}
+	return scanLegalHolds(rows)
+}
+
+func (s *MySQLStore) AddLegalHoldAuditTx(tx Tx, entry LegalHoldAudit) error {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return err
+	}
+	_, err = sqlTx.Exec(`
+		INSERT INTO legal_hold_audit (id, hold_id, action, actor_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.HoldID, entry.Action, entry.ActorID, entry.Details, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add legal hold audit: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetLegalHoldAudit(offset, limit int) ([]LegalHoldAudit, error) {
+	offset, limit = pageBounds(offset, limit)
+	rows, err := s.readQuery(`
+		SELECT id, hold_id, action, actor_id, details, created_at
+		FROM legal_hold_audit
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal hold audit: %w", err)
+	}
+	return scanLegalHoldAudit(rows)
+}
+
+func (s *SQLiteStore) SaveLegalHoldTx(tx Tx, hold LegalHold) error {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return err
+	}
+	_, err = sqlTx.Exec(`
+		INSERT INTO legal_holds (id, channel_id, user_id, reason, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+		channel_id = excluded.channel_id,
+		user_id = excluded.user_id,
+		reason = excluded.reason,
+		updated_at = excluded.updated_at
+	`, hold.ID, hold.ChannelID, hold.UserID, hold.Reason, hold.CreatedBy, hold.CreatedAt, hold.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save legal hold: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteLegalHoldTx(tx Tx, holdID string) (bool, error) {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return false, err
+	}
+	result, err := sqlTx.Exec(`DELETE FROM legal_holds WHERE id = ?`, holdID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete legal hold: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *SQLiteStore) GetLegalHold(holdID string) (*LegalHold, error) {
+	rows, err := s.db.Query(selectLegalHolds+`WHERE id = ?`, holdID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal hold: %w", err)
+	}
+	return firstLegalHold(scanLegalHolds(rows))
+}
+
+func (s *SQLiteStore) GetLegalHolds() ([]LegalHold, error) {
+	rows, err := s.db.Query(selectLegalHolds + `ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal holds: %w", err)
+	}
+	return scanLegalHolds(rows)
+}
+
+func (s *SQLiteStore) AddLegalHoldAuditTx(tx Tx, entry LegalHoldAudit) error {
+	sqlTx, err := sqlTxFor(tx)
+	if err != nil {
+		return err
+	}
+	_, err = sqlTx.Exec(`
+		INSERT INTO legal_hold_audit (id, hold_id, action, actor_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.HoldID, entry.Action, entry.ActorID, entry.Details, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add legal hold audit: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetLegalHoldAudit(offset, limit int) ([]LegalHoldAudit, error) {
+	offset, limit = pageBounds(offset, limit)
+	rows, err := s.readQuery(`
+		SELECT id, hold_id, action, actor_id, details, created_at
+		FROM legal_hold_audit
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal hold audit: %w", err)
+	}
+	return scanLegalHoldAudit(rows)
+}
@@ -0,0 +1,737 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/types"
+)
+
+type readEventKey struct {
+	messageID string
+	userID    string
+}
+
+type channelReadKey struct {
+	channelID string
+	userID    string
+}
+
+// MemoryStore is a thread-safe, in-process ReceiptStore. It needs no database
+// and mirrors the semantics of the SQL stores, which makes it suitable for
+// tests and throwaway environments. Data is lost when the process exits.
+type MemoryStore struct {
+	mu             sync.RWMutex
+	readEvents     map[readEventKey]ReadEvent
+	channelReads   map[channelReadKey]types.ChannelRead
+	channelLeaves  map[channelReadKey]int64 // left_at of tombstoned channel reads
+	deliveries     map[readEventKey]DeliveryEvent
+	acks           map[readEventKey]Acknowledgement
+	settings       map[settingKey]ReceiptSetting
+	legalHolds     map[string]LegalHold
+	legalHoldAudit []LegalHoldAudit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		readEvents:    make(map[readEventKey]ReadEvent),
+		channelReads:  make(map[channelReadKey]types.ChannelRead),
+		channelLeaves: make(map[channelReadKey]int64),
+		deliveries:    make(map[readEventKey]DeliveryEvent),
+		acks:          make(map[readEventKey]Acknowledgement),
+		settings:      make(map[settingKey]ReceiptSetting),
+		legalHolds:    make(map[string]LegalHold),
+	}
+}
+
+// memoryTx buffers writes until Commit, so a rolled back transaction leaves
+// the store untouched.
+type memoryTx struct {
+	store *MemoryStore
+	ops   []func()
+	done  bool
+}
+
+func (tx *memoryTx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	tx.done = true
+
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	for _, op := range tx.ops {
+		op()
+	}
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	if tx.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
+
+func (s *MemoryStore) Initialize() error {
+	return nil
+}
+
+func (s *MemoryStore) InitializeChannelReads() error {
+	return nil
+}
+
+// BeginTx starts a buffered transaction
+func (s *MemoryStore) BeginTx() (Tx, error) {
+	return &memoryTx{store: s}, nil
+}
+
+func (s *MemoryStore) txFor(tx Tx) (*memoryTx, error) {
+	memTx, ok := tx.(*memoryTx)
+	if !ok || memTx.store != s {
+		return nil, fmt.Errorf("invalid transaction type: %T", tx)
+	}
+	if memTx.done {
+		return nil, fmt.Errorf("transaction already finished")
+	}
+	return memTx, nil
+}
+
+// upsertReadEvent must be called with s.mu held for writing.
+func (s *MemoryStore) upsertReadEvent(event ReadEvent) {
+	key := readEventKey{messageID: event.MessageID, userID: event.UserID}
+	existing, ok := s.readEvents[key]
+	if !ok {
+		s.readEvents[key] = event
+		return
+	}
+	if event.ChannelID != "" {
+		existing.ChannelID = event.ChannelID
+	}
+	if event.Timestamp > existing.Timestamp {
+		existing.Timestamp = event.Timestamp
+	}
+	s.readEvents[key] = existing
+}
+
+// upsertChannelRead must be called with s.mu held for writing.
+func (s *MemoryStore) upsertChannelRead(read types.ChannelRead) {
+	key := channelReadKey{channelID: read.ChannelID, userID: read.UserID}
+	existing, ok := s.channelReads[key]
+	// A read after leaving brings the row back; a new row never starts out
+	// tombstoned, even if an older one was deleted while tombstoned
+	if !ok || s.channelLeaves[key] < read.LastSeenAt {
+		delete(s.channelLeaves, key)
+	}
+	if ok && existing.LastSeenAt >= read.LastSeenAt {
+		return
+	}
+	read.Source = readSource(read)
+	s.channelReads[key] = read
+}
+
+func (s *MemoryStore) Upsert(event ReadEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertReadEvent(event)
+	return nil
+}
+
+func (s *MemoryStore) UpsertTx(tx Tx, event ReadEvent) error {
+	memTx, err := s.txFor(tx)
+	if err != nil {
+		return err
+	}
+	memTx.ops = append(memTx.ops, func() { s.upsertReadEvent(event) })
+	return nil
+}
+
+func (s *MemoryStore) UpsertBatchTx(tx Tx, events []ReadEvent) error {
+	memTx, err := s.txFor(tx)
+	if err != nil {
+		return err
+	}
+	events = append([]ReadEvent(nil), events...)
+	memTx.ops = append(memTx.ops, func() {
+		for _, event := range events {
+			s.upsertReadEvent(event)
+		}
+	})
+	return nil
+}
+
+func (s *MemoryStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []ReadEvent
+	for _, event := range s.readEvents {
+		if event.ChannelID != channelID {
+			continue
+		}
+		if excludeUserID != "" && event.UserID == excludeUserID {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp > events[j].Timestamp
+	})
+	return events, nil
+}
+
+func (s *MemoryStore) CleanupOlderThan(days int) error {
+	cutoffMs := time.Now().AddDate(0, 0, -days).UnixMilli()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, event := range s.readEvents {
+		if event.Timestamp < cutoffMs && !s.isHeld(event.ChannelID, event.UserID) {
+			delete(s.readEvents, key)
+		}
+	}
+	for key, read := range s.channelReads {
+		if read.LastSeenAt < cutoffMs && !s.isHeld(read.ChannelID, read.UserID) {
+			delete(s.channelReads, key)
+		}
+	}
+	for key, delivery := range s.deliveries {
+		if delivery.DeliveredAt < cutoffMs && !s.isHeld(delivery.ChannelID, delivery.UserID) {
+			delete(s.deliveries, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteReadEventsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, event := range s.readEvents {
+		if deleted >= int64(limit) {
+			break
+		}
+		if event.Timestamp < cutoffMs && (channelID == "" || event.ChannelID == channelID) && !s.isHeld(event.ChannelID, event.UserID) {
+			delete(s.readEvents, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) DeleteChannelReadsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, read := range s.channelReads {
+		if deleted >= int64(limit) {
+			break
+		}
+		if read.LastSeenAt < cutoffMs && (channelID == "" || read.ChannelID == channelID) && !s.isHeld(read.ChannelID, read.UserID) {
+			delete(s.channelReads, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) GetReceiptChannelIDs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, event := range s.readEvents {
+		seen[event.ChannelID] = true
+	}
+	for key := range s.channelReads {
+		seen[key.channelID] = true
+	}
+	for _, delivery := range s.deliveries {
+		seen[delivery.ChannelID] = true
+	}
+	for _, ack := range s.acks {
+		seen[ack.ChannelID] = true
+	}
+
+	channelIDs := make([]string, 0, len(seen))
+	for channelID := range seen {
+		channelIDs = append(channelIDs, channelID)
+	}
+	sort.Strings(channelIDs)
+	return channelIDs, nil
+}
+
+func (s *MemoryStore) DeleteDeliveriesBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, delivery := range s.deliveries {
+		if deleted >= int64(limit) {
+			break
+		}
+		if delivery.DeliveredAt < cutoffMs && (channelID == "" || delivery.ChannelID == channelID) && !s.isHeld(delivery.ChannelID, delivery.UserID) {
+			delete(s.deliveries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) SaveDeliveries(events []DeliveryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		key := readEventKey{messageID: event.MessageID, userID: event.UserID}
+		if _, ok := s.deliveries[key]; !ok {
+			s.deliveries[key] = event
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDeliveredUserIDs(messageID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userIDs []string
+	for key := range s.deliveries {
+		if key.messageID == messageID {
+			userIDs = append(userIDs, key.userID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+func (s *MemoryStore) UpsertChannelRead(channelID, userID, lastPostID string, lastSeenAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertChannelRead(types.ChannelRead{
+		ChannelID:  channelID,
+		UserID:     userID,
+		LastPostID: lastPostID,
+		LastSeenAt: lastSeenAt,
+	})
+	return nil
+}
+
+func (s *MemoryStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error {
+	memTx, err := s.txFor(tx)
+	if err != nil {
+		return err
+	}
+	memTx.ops = append(memTx.ops, func() { s.upsertChannelRead(read) })
+	return nil
+}
+
+func (s *MemoryStore) MarkChannelReadLeft(channelID, userID string, leftAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := channelReadKey{channelID: channelID, userID: userID}
+	if _, ok := s.channelReads[key]; ok {
+		s.channelLeaves[key] = leftAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetReadersSince(channelID string, sinceMs int64, excludeUserID string) ([]string, error) {
+	reads := s.channelReadsFor(channelID)
+
+	var userIDs []string
+	for _, read := range reads {
+		if read.LastSeenAt < sinceMs || read.UserID == excludeUserID {
+			continue
+		}
+		userIDs = append(userIDs, read.UserID)
+	}
+	return userIDs, nil
+}
+
+func (s *MemoryStore) GetChannelReads(channelID string) ([]types.ChannelRead, error) {
+	return s.channelReadsFor(channelID), nil
+}
+
+// channelReadsFor returns a channel's reads ordered by last_seen_at DESC, user_id.
+func (s *MemoryStore) channelReadsFor(channelID string) []types.ChannelRead {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reads []types.ChannelRead
+	for key, read := range s.channelReads {
+		if read.ChannelID == channelID && s.channelLeaves[key] == 0 {
+			reads = append(reads, read)
+		}
+	}
+	sort.Slice(reads, func(i, j int) bool {
+		if reads[i].LastSeenAt != reads[j].LastSeenAt {
+			return reads[i].LastSeenAt > reads[j].LastSeenAt
+		}
+		return reads[i].UserID < reads[j].UserID
+	})
+	return reads
+}
+
+func (s *MemoryStore) SaveReadEvent(event ReadEvent) error {
+	return s.Upsert(event)
+}
+
+func (s *MemoryStore) GetPostReaderIDs(messageID, channelID string, sinceMs int64) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for key := range s.readEvents {
+		if key.messageID == messageID {
+			seen[key.userID] = true
+		}
+	}
+	for key, read := range s.channelReads {
+		if key.channelID == channelID && read.LastSeenAt >= sinceMs && s.channelLeaves[key] == 0 {
+			seen[key.userID] = true
+		}
+	}
+
+	var userIDs []string
+	for userID := range seen {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+func (s *MemoryStore) GetPostReaders(messageID, channelID string, sinceMs int64, offset, limit int) ([]PostRead, error) {
+	offset, limit = pageBounds(offset, limit)
+
+	s.mu.RLock()
+	var reads []PostRead
+	seen := make(map[string]bool)
+	for key, event := range s.readEvents {
+		if key.messageID == messageID {
+			reads = append(reads, PostRead{UserID: key.userID, ReadAt: event.Timestamp, Source: types.ReadSourceClient})
+			seen[key.userID] = true
+		}
+	}
+	for key, read := range s.channelReads {
+		if key.channelID == channelID && read.LastSeenAt >= sinceMs && s.channelLeaves[key] == 0 && !seen[key.userID] {
+			reads = append(reads, PostRead{UserID: key.userID, ReadAt: read.LastSeenAt, Source: types.ReadSourceInferred})
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(reads, func(i, j int) bool {
+		if reads[i].ReadAt != reads[j].ReadAt {
+			return reads[i].ReadAt > reads[j].ReadAt
+		}
+		return reads[i].UserID < reads[j].UserID
+	})
+	if offset >= len(reads) {
+		return nil, nil
+	}
+	reads = reads[offset:]
+	if limit < len(reads) {
+		reads = reads[:limit]
+	}
+	return reads, nil
+}
+
+// isHeld must be called with s.mu held.
+func (s *MemoryStore) isHeld(channelID, userID string) bool {
+	for _, hold := range s.legalHolds {
+		if hold.ChannelID != "" && hold.ChannelID == channelID || hold.UserID != "" && hold.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) SaveLegalHoldTx(tx Tx, hold LegalHold) error {
+	memTx, err := s.txFor(tx)
+	if err != nil {
+		return err
+	}
+	memTx.ops = append(memTx.ops, func() {
+		if existing, ok := s.legalHolds[hold.ID]; ok {
+			hold.CreatedBy, hold.CreatedAt = existing.CreatedBy, existing.CreatedAt
+		}
+		s.legalHolds[hold.ID] = hold
+	})
+	return nil
+}
+
+func (s *MemoryStore) DeleteLegalHoldTx(tx Tx, holdID string) (bool, error) {
+	memTx, err := s.txFor(tx)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	_, ok := s.legalHolds[holdID]
+	s.mu.RUnlock()
+	memTx.ops = append(memTx.ops, func() { delete(s.legalHolds, holdID) })
+	return ok, nil
+}
+
+func (s *MemoryStore) GetLegalHold(holdID string) (*LegalHold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hold, ok := s.legalHolds[holdID]
+	if !ok {
+		return nil, nil
+	}
+	return &hold, nil
+}
+
+func (s *MemoryStore) GetLegalHolds() ([]LegalHold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	holds := make([]LegalHold, 0, len(s.legalHolds))
+	for _, hold := range s.legalHolds {
+		holds = append(holds, hold)
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		if holds[i].CreatedAt != holds[j].CreatedAt {
+			return holds[i].CreatedAt < holds[j].CreatedAt
+		}
+		return holds[i].ID < holds[j].ID
+	})
+	return holds, nil
+}
+
+func (s *MemoryStore) AddLegalHoldAuditTx(tx Tx, entry LegalHoldAudit) error {
+	memTx, err := s.txFor(tx)
+	if err != nil {
+		return err
+	}
+	memTx.ops = append(memTx.ops, func() { s.legalHoldAudit = append(s.legalHoldAudit, entry) })
+	return nil
+}
+
+func (s *MemoryStore) GetLegalHoldAudit(offset, limit int) ([]LegalHoldAudit, error) {
+	s.mu.RLock()
+	entries := append([]LegalHoldAudit(nil), s.legalHoldAudit...)
+	s.mu.RUnlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].CreatedAt != entries[j].CreatedAt {
+			return entries[i].CreatedAt > entries[j].CreatedAt
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	offset, limit = pageBounds(offset, limit)
+	if offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[offset:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) DeleteMessageReceipts(messageID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, event := range s.readEvents {
+		if event.MessageID == messageID && !s.isHeld(event.ChannelID, event.UserID) {
+			delete(s.readEvents, key)
+			deleted++
+		}
+	}
+	for key, delivery := range s.deliveries {
+		if delivery.MessageID == messageID && !s.isHeld(delivery.ChannelID, delivery.UserID) {
+			delete(s.deliveries, key)
+			deleted++
+		}
+	}
+	for key, ack := range s.acks {
+		if ack.MessageID == messageID && !s.isHeld(ack.ChannelID, ack.UserID) {
+			delete(s.acks, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) DeleteChannelReceipts(channelID string, limit int) (int64, error) {
+	return s.deleteReceiptsWhere(limit, func(rowChannelID, _ string) bool { return rowChannelID == channelID })
+}
+
+func (s *MemoryStore) DeleteUserReceipts(userID string, limit int) (int64, error) {
+	return s.deleteReceiptsWhere(limit, func(_, rowUserID string) bool { return rowUserID == userID })
+}
+
+// deleteReceiptsWhere mirrors BaseStore.deleteAcross. match is given each
+// row's channel and user.
+func (s *MemoryStore) deleteReceiptsWhere(limit int, match func(channelID, userID string) bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	remove := func(channelID, userID string) bool {
+		if deleted >= int64(limit) || !match(channelID, userID) || s.isHeld(channelID, userID) {
+			return false
+		}
+		deleted++
+		return true
+	}
+	for key, event := range s.readEvents {
+		if remove(event.ChannelID, event.UserID) {
+			delete(s.readEvents, key)
+		}
+	}
+	for key, read := range s.channelReads {
+		if remove(read.ChannelID, read.UserID) {
+			delete(s.channelReads, key)
+		}
+	}
+	for key, delivery := range s.deliveries {
+		if remove(delivery.ChannelID, delivery.UserID) {
+			delete(s.deliveries, key)
+		}
+	}
+	for key, ack := range s.acks {
+		if remove(ack.ChannelID, ack.UserID) {
+			delete(s.acks, key)
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) SaveAcknowledgement(ack Acknowledgement) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := readEventKey{messageID: ack.MessageID, userID: ack.UserID}
+	if _, ok := s.acks[key]; ok {
+		return false, nil
+	}
+	s.acks[key] = ack
+	return true, nil
+}
+
+func (s *MemoryStore) GetAcknowledgements(messageID string) ([]Acknowledgement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var acks []Acknowledgement
+	for _, ack := range s.acks {
+		if ack.MessageID == messageID {
+			acks = append(acks, ack)
+		}
+	}
+	sort.Slice(acks, func(i, j int) bool {
+		if acks[i].AckedAt != acks[j].AckedAt {
+			return acks[i].AckedAt < acks[j].AckedAt
+		}
+		return acks[i].UserID < acks[j].UserID
+	})
+	return acks, nil
+}
+
+type settingKey struct {
+	scope   string
+	scopeID string
+}
+
+func (s *MemoryStore) SaveReceiptSetting(setting ReceiptSetting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[settingKey{scope: setting.Scope, scopeID: setting.ScopeID}] = setting
+	return nil
+}
+
+func (s *MemoryStore) GetReceiptSetting(scope, scopeID string) (*ReceiptSetting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	setting, ok := s.settings[settingKey{scope: scope, scopeID: scopeID}]
+	if !ok {
+		return nil, nil
+	}
+	return &setting, nil
+}
+
+func (s *MemoryStore) GetReceiptSettings(scope string) ([]ReceiptSetting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var settings []ReceiptSetting
+	for key, setting := range s.settings {
+		if key.scope == scope {
+			settings = append(settings, setting)
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].ScopeID < settings[j].ScopeID })
+	return settings, nil
+}
+
+func (s *MemoryStore) GetReceiptUserIDs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for key := range s.readEvents {
+		seen[key.userID] = true
+	}
+	for key := range s.channelReads {
+		seen[key.userID] = true
+	}
+	for key := range s.deliveries {
+		seen[key.userID] = true
+	}
+	for key := range s.acks {
+		seen[key.userID] = true
+	}
+
+	userIDs := make([]string, 0, len(seen))
+	for userID := range seen {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+func (s *MemoryStore) GetReceiptMessageIDs(channelID, afterID string, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, event := range s.readEvents {
+		if event.ChannelID == channelID {
+			seen[event.MessageID] = true
+		}
+	}
+	for _, delivery := range s.deliveries {
+		if delivery.ChannelID == channelID {
+			seen[delivery.MessageID] = true
+		}
+	}
+	for _, ack := range s.acks {
+		if ack.ChannelID == channelID {
+			seen[ack.MessageID] = true
+		}
+	}
+
+	messageIDs := make([]string, 0, len(seen))
+	for messageID := range seen {
+		if messageID > afterID {
+			messageIDs = append(messageIDs, messageID)
+		}
+	}
+	sort.Strings(messageIDs)
+	if len(messageIDs) > limit {
+		messageIDs = messageIDs[:limit]
+	}
+	return messageIDs, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testReceiptStore(t, func(t *testing.T) ReceiptStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestMemoryStoreConcurrentUpserts(t *testing.T) {
+	s := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(ts int64) {
+			defer wg.Done()
+			assert.NoError(t, s.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: ts}))
+			assert.NoError(t, s.UpsertChannelRead("channel1", "user1", "msg1", ts))
+		}(int64(i))
+	}
+	wg.Wait()
+
+	events, err := s.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(49), events[0].Timestamp)
+
+	reads, err := s.GetChannelReads("channel1")
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Equal(t, int64(49), reads[0].LastSeenAt)
+}
+
+func TestMemoryStoreRejectsForeignTx(t *testing.T) {
+	s := NewMemoryStore()
+	other := NewMemoryStore()
+
+	tx, err := other.BeginTx()
+	require.NoError(t, err)
+	assert.Error(t, s.UpsertTx(tx, ReadEvent{MessageID: "msg1", UserID: "user1"}))
+
+	require.NoError(t, tx.Commit())
+	assert.Error(t, other.UpsertTx(tx, ReadEvent{MessageID: "msg1", UserID: "user1"}))
+}
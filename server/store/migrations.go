@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Supported SQL dialects
+const (
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+	DialectSQLite   = "sqlite"
+)
+
+// migrationLockID is the advisory lock key used to serialise migrations
+// when several Mattermost nodes activate the plugin at the same time.
+const migrationLockID = 7245190388
+
+// Migration is a single ordered schema change for one SQL dialect.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+
+	// Baseline marks migrations that may be replayed against a schema created
+	// by the pre-versioning Initialize code. "Already exists" errors are ignored.
+	Baseline bool
+}
+
+// SchemaAheadError is returned when the database has been migrated by a newer
+// plugin build than the one currently running.
+type SchemaAheadError struct {
+	Current int
+	Latest  int
+}
+
+func (e *SchemaAheadError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the latest version %d known to this plugin; upgrade the plugin or roll back the schema", e.Current, e.Latest)
+}
+
+// Migrator applies versioned migrations and records them in schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator for the given dialect.
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	var migrations []Migration
+	switch dialect {
+	case DialectPostgres:
+		migrations = postgresMigrations
+	case DialectMySQL:
+		migrations = mysqlMigrations
+	case DialectSQLite:
+		migrations = sqliteMigrations
+	default:
+		return nil, fmt.Errorf("unsupported migration dialect: %s", dialect)
+	}
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Migrate brings the schema for the given dialect up to the latest version.
+func Migrate(db *sql.DB, dialect string) error {
+	m, err := NewMigrator(db, dialect)
+	if err != nil {
+		return err
+	}
+	return m.Up()
+}
+
+// Latest returns the highest version known to this build.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the highest applied version, or 0 for an empty database.
+func (m *Migrator) Version() (int, error) {
+	if err := m.ensureVersionTable(m.db); err != nil {
+		return 0, err
+	}
+	return m.currentVersion(m.db)
+}
+
+// Up applies every pending migration in order.
+func (m *Migrator) Up() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		if err := m.ensureVersionTable(conn); err != nil {
+			return err
+		}
+		current, err := m.currentVersion(conn)
+		if err != nil {
+			return err
+		}
+		if current > m.Latest() {
+			return &SchemaAheadError{Current: current, Latest: m.Latest()}
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version <= current {
+				continue
+			}
+			if err := m.apply(conn, mig, mig.Up, true); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts applied migrations, newest first, until the schema is at target.
+func (m *Migrator) Down(target int) error {
+	if target < 0 {
+		return fmt.Errorf("invalid target version: %d", target)
+	}
+	return m.withLock(func(conn *sql.Conn) error {
+		if err := m.ensureVersionTable(conn); err != nil {
+			return err
+		}
+		current, err := m.currentVersion(conn)
+		if err != nil {
+			return err
+		}
+		if current > m.Latest() {
+			return &SchemaAheadError{Current: current, Latest: m.Latest()}
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version > current || mig.Version <= target {
+				continue
+			}
+			if err := m.apply(conn, mig, mig.Down, false); err != nil {
+				return fmt.Errorf("reverting migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// apply runs the statements of one migration and records the version change
+// in the same transaction. MySQL commits DDL implicitly, so on that dialect
+// the transaction only protects the bookkeeping row.
+func (m *Migrator) apply(conn *sql.Conn, mig Migration, statements []string, up bool) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			if up && mig.Baseline && isAlreadyExists(err) {
+				continue
+			}
+			return err
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			mig.Version, mig.Name, time.Now().UnixMilli())
+	} else {
+		_, err = tx.ExecContext(ctx, m.rebind("DELETE FROM schema_migrations WHERE version = ?"), mig.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (m *Migrator) ensureVersionTable(db execQueryer) error {
+	var query string
+	switch m.dialect {
+	case DialectMySQL:
+		query = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at BIGINT NOT NULL
+		)`
+	default:
+		query = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		)`
+	}
+	if _, err := db.ExecContext(context.Background(), query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) currentVersion(db execQueryer) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRowContext(context.Background(), "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// withLock runs fn on a dedicated connection holding a dialect-specific
+// advisory lock, so concurrent activations don't apply the same migration twice.
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	switch m.dialect {
+	case DialectPostgres:
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+	case DialectMySQL:
+		name := fmt.Sprintf("readreceipts_migrations_%d", migrationLockID)
+		var acquired sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", name).Scan(&acquired); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired.Int64 != 1 {
+			return fmt.Errorf("timed out waiting for migration lock")
+		}
+		defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+	}
+
+	return fn(conn)
+}
+
+// rebind converts ? placeholders to the dialect's native form.
+func (m *Migrator) rebind(query string) string {
+	if m.dialect != DialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func validateMigrations(migrations []Migration) error {
+	last := 0
+	for _, mig := range migrations {
+		if mig.Version <= last {
+			return fmt.Errorf("migration %d (%s) is out of order", mig.Version, mig.Name)
+		}
+		if len(mig.Up) == 0 {
+			return fmt.Errorf("migration %d (%s) has no up statements", mig.Version, mig.Name)
+		}
+		last = mig.Version
+	}
+	return nil
+}
+
+// isAlreadyExists reports whether err means the object a baseline migration
+// tries to create is already present. Postgres baselines use IF NOT EXISTS
+// instead, since a failed statement aborts the whole transaction there.
+func isAlreadyExists(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1050, // table already exists
+			1060, // duplicate column name
+			1061: // duplicate key name
+			return true
+		}
+	}
+	return false
+}
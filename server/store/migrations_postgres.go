@@ -0,0 +1,202 @@
+package store
+
+// postgresMigrations is the ordered schema history for PostgreSQL.
+// Never edit an entry that has shipped; append a new version instead.
+var postgresMigrations = []Migration{
+	{
+		Version:  1,
+		Name:     "create_read_events",
+		Baseline: true,
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS read_events (
+				message_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				timestamp BIGINT NOT NULL,
+				PRIMARY KEY (message_id, user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_read_events_message_id ON read_events(message_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_read_events_user_id ON read_events(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS read_events`,
+		},
+	},
+	{
+		Version:  2,
+		Name:     "add_channel_id_to_read_events",
+		Baseline: true,
+		Up: []string{
+			`ALTER TABLE read_events ADD COLUMN IF NOT EXISTS channel_id TEXT`,
+			`UPDATE read_events SET channel_id = '' WHERE channel_id IS NULL`,
+			`ALTER TABLE read_events ALTER COLUMN channel_id SET DEFAULT ''`,
+			`ALTER TABLE read_events ALTER COLUMN channel_id SET NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_read_events_channel_id ON read_events(channel_id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_read_events_channel_id`,
+			`ALTER TABLE read_events DROP COLUMN IF EXISTS channel_id`,
+		},
+	},
+	{
+		Version:  3,
+		Name:     "create_channel_reads",
+		Baseline: true,
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS channel_reads (
+				channel_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				last_post_id TEXT NOT NULL,
+				last_seen_at BIGINT NOT NULL,
+				PRIMARY KEY (channel_id, user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_channel_reads_channel_id ON channel_reads(channel_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_channel_reads_user_id ON channel_reads(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_channel_reads_last_seen ON channel_reads(last_seen_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS channel_reads`,
+		},
+	},
+	{
+		// Serves per-post reader lists ordered by read time; the old
+		// single-column index is a prefix of the new one.
+		Version: 4,
+		Name:    "index_read_events_message_timestamp",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_read_events_message_ts ON read_events(message_id, timestamp)`,
+			`DROP INDEX IF EXISTS idx_read_events_message_id`,
+		},
+		Down: []string{
+			`CREATE INDEX IF NOT EXISTS idx_read_events_message_id ON read_events(message_id)`,
+			`DROP INDEX IF EXISTS idx_read_events_message_ts`,
+		},
+	},
+	{
+		// Lets the retention job find expired rows without a full scan.
+		Version: 5,
+		Name:    "index_read_events_timestamp",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_read_events_timestamp ON read_events(timestamp)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_read_events_timestamp`,
+		},
+	},
+	{
+		// Channels and users under legal hold are skipped by every delete.
+		Version: 6,
+		Name:    "create_legal_holds",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS legal_holds (
+				id TEXT NOT NULL,
+				channel_id TEXT NOT NULL DEFAULT '',
+				user_id TEXT NOT NULL DEFAULT '',
+				reason TEXT NOT NULL,
+				created_by TEXT NOT NULL,
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL,
+				PRIMARY KEY (id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_legal_holds_channel_id ON legal_holds(channel_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_legal_holds_user_id ON legal_holds(user_id)`,
+			`CREATE TABLE IF NOT EXISTS legal_hold_audit (
+				id TEXT NOT NULL,
+				hold_id TEXT NOT NULL,
+				action TEXT NOT NULL,
+				actor_id TEXT NOT NULL,
+				details TEXT NOT NULL,
+				created_at BIGINT NOT NULL,
+				PRIMARY KEY (id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_legal_hold_audit_created_at ON legal_hold_audit(created_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS legal_hold_audit`,
+			`DROP TABLE IF EXISTS legal_holds`,
+		},
+	},
+	{
+		// Rows of users who left a channel are kept, but hidden until they read
+		// it again.
+		Version: 7,
+		Name:    "add_left_at_to_channel_reads",
+		Up: []string{
+			`ALTER TABLE channel_reads ADD COLUMN IF NOT EXISTS left_at BIGINT NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE channel_reads DROP COLUMN IF EXISTS left_at`,
+		},
+	},
+	{
+		// Tells receipts reported by the webapp apart from those inferred
+		// from Mattermost's LastViewedAt.
+		Version: 8,
+		Name:    "add_source_to_channel_reads",
+		Up: []string{
+			`ALTER TABLE channel_reads ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'client'`,
+		},
+		Down: []string{
+			`ALTER TABLE channel_reads DROP COLUMN IF EXISTS source`,
+		},
+	},
+	{
+		// A receipt's first state: the post reached the user's client,
+		// whether or not they have read it yet.
+		Version: 9,
+		Name:    "create_delivery_events",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS delivery_events (
+				message_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				channel_id TEXT NOT NULL DEFAULT '',
+				delivered_at BIGINT NOT NULL,
+				PRIMARY KEY (message_id, user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_delivery_events_channel_id ON delivery_events(channel_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_delivery_events_user_id ON delivery_events(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_delivery_events_delivered_at ON delivery_events(delivered_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS delivery_events`,
+		},
+	},
+	{
+		// Explicit acknowledgements of posts that require one; kept apart
+		// from passive reads.
+		Version: 10,
+		Name:    "create_acknowledgements",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS acknowledgements (
+				message_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				channel_id TEXT NOT NULL DEFAULT '',
+				acked_at BIGINT NOT NULL,
+				PRIMARY KEY (message_id, user_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_acknowledgements_channel_id ON acknowledgements(channel_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_acknowledgements_user_id ON acknowledgements(user_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS acknowledgements`,
+		},
+	},
+	{
+		// Channel admins can turn receipts off for a channel and system
+		// admins for a team.
+		Version: 11,
+		Name:    "create_receipt_settings",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS receipt_settings (
+				scope TEXT NOT NULL,
+				scope_id TEXT NOT NULL,
+				enabled BOOLEAN NOT NULL,
+				updated_by TEXT NOT NULL,
+				updated_at BIGINT NOT NULL,
+				PRIMARY KEY (scope, scope_id)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS receipt_settings`,
+		},
+	},
+}
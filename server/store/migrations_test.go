@@ -0,0 +1,97 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsAreOrderedAndReversible(t *testing.T) {
+	for dialect, migrations := range map[string][]Migration{
+		DialectPostgres: postgresMigrations,
+		DialectMySQL:    mysqlMigrations,
+		DialectSQLite:   sqliteMigrations,
+	} {
+		t.Run(dialect, func(t *testing.T) {
+			require.NoError(t, validateMigrations(migrations))
+			for _, mig := range migrations {
+				assert.NotEmpty(t, mig.Name, "migration %d has no name", mig.Version)
+				assert.NotEmpty(t, mig.Down, "migration %d (%s) has no down statements", mig.Version, mig.Name)
+			}
+		})
+	}
+}
+
+func TestMigrationVersionsMatchAcrossDialects(t *testing.T) {
+	for _, other := range [][]Migration{mysqlMigrations, sqliteMigrations} {
+		require.Equal(t, len(postgresMigrations), len(other))
+		for i := range postgresMigrations {
+			assert.Equal(t, postgresMigrations[i].Version, other[i].Version)
+			assert.Equal(t, postgresMigrations[i].Name, other[i].Name)
+		}
+	}
+}
+
+func TestValidateMigrationsRejectsOutOfOrder(t *testing.T) {
+	err := validateMigrations([]Migration{
+		{Version: 2, Name: "b", Up: []string{"SELECT 1"}},
+		{Version: 1, Name: "a", Up: []string{"SELECT 1"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestMigratorRebind(t *testing.T) {
+	pg := &Migrator{dialect: DialectPostgres}
+	assert.Equal(t, "DELETE FROM t WHERE a = $1 AND b = $2", pg.rebind("DELETE FROM t WHERE a = ? AND b = ?"))
+
+	my := &Migrator{dialect: DialectMySQL}
+	assert.Equal(t, "DELETE FROM t WHERE a = ?", my.rebind("DELETE FROM t WHERE a = ?"))
+}
+
+func TestSchemaAheadError(t *testing.T) {
+	err := &SchemaAheadError{Current: 7, Latest: 3}
+	assert.Contains(t, err.Error(), "7")
+	assert.Contains(t, err.Error(), "3")
+}
+
+// testTables lists every table the migrations create, plus the bookkeeping table.
+var testTables = []string{"read_events", "channel_reads", "legal_holds", "legal_hold_audit", "delivery_events", "acknowledgements", "receipt_settings", "schema_migrations"}
+
+func dropTestTables(t *testing.T, db *sql.DB) {
+	for _, table := range testTables {
+		_, err := db.Exec("DROP TABLE IF EXISTS " + table)
+		require.NoError(t, err)
+	}
+}
+
+// testMigrator exercises a migrator against a live, freshly migrated database.
+func testMigrator(t *testing.T, db *sql.DB, dialect string) {
+	m, err := NewMigrator(db, dialect)
+	require.NoError(t, err)
+
+	version, err := m.Version()
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	// Re-running is a no-op
+	require.NoError(t, m.Up())
+
+	require.NoError(t, m.Down(0))
+	version, err = m.Version()
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	require.NoError(t, m.Up())
+	version, err = m.Version()
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	_, err = db.Exec(m.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"), m.Latest()+1, "from_the_future", 0)
+	require.NoError(t, err)
+
+	var aheadErr *SchemaAheadError
+	require.ErrorAs(t, m.Up(), &aheadErr)
+	assert.Equal(t, m.Latest()+1, aheadErr.Current)
+}
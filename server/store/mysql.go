@@ -3,10 +3,19 @@ package store
 import (
 	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 )
 
+// mysqlUpsertReadEvent keeps the newest timestamp and only replaces channel_id
+// when the new event carries one, matching the Postgres store.
+const mysqlUpsertReadEvent = `
+	INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+	channel_id = IF(VALUES(channel_id) = '', channel_id, VALUES(channel_id)),
+	timestamp = GREATEST(timestamp, VALUES(timestamp))
+`
+
 type MySQLStore struct {
 	BaseStore
 }
@@ -17,37 +26,9 @@ func NewMySQLStore(db *sql.DB) *MySQLStore {
 	}
 }
 
+// Initialize brings the schema up to date through the versioned migrations.
 func (s *MySQLStore) Initialize() error {
-	// Create table if not exists
-	createTable := `
-	CREATE TABLE IF NOT EXISTS read_events (
-		message_id VARCHAR(255) NOT NULL,
-		user_id VARCHAR(255) NOT NULL,
-		channel_id VARCHAR(255) NOT NULL,
-		timestamp BIGINT NOT NULL,
-		PRIMARY KEY (message_id, user_id)
-	)
-	`
-	if _, err := s.db.Exec(createTable); err != nil {
-		return fmt.Errorf("failed to create read_events table: %w", err)
-	}
-
-	// Create indices if they don't exist
-	indices := []string{
-		"CREATE INDEX idx_read_events_message_id ON read_events(message_id)",
-		"CREATE INDEX idx_read_events_user_id ON read_events(user_id)",
-		"CREATE INDEX idx_read_events_channel_id ON read_events(channel_id)",
-	}
-
-	for _, idx := range indices {
-		if _, err := s.db.Exec(idx); err != nil {
-			if !strings.Contains(err.Error(), "Duplicate key name") {
-				return fmt.Errorf("failed to create index: %w", err)
-			}
-		}
-	}
-
-	return nil
+	return Migrate(s.db, DialectMySQL)
 }
 
 // BeginTx starts a transaction
@@ -66,50 +47,76 @@ func (s *MySQLStore) UpsertTx(tx Tx, event ReadEvent) error {
 		return fmt.Errorf("invalid transaction type: %T", tx)
 	}
 
-	query := `
-		INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
-		VALUES (?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE timestamp = VALUES(timestamp)
-	`
-	result, err := sqlTx.Exec(query, event.MessageID, event.UserID, event.ChannelID, event.Timestamp)
-	if err != nil {
+	if _, err := sqlTx.Exec(mysqlUpsertReadEvent, event.MessageID, event.UserID, event.ChannelID, event.Timestamp); err != nil {
 		return fmt.Errorf("failed to upsert read event: %w", err)
 	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get affected rows: %w", err)
-	}
-
-	if rows == 0 {
-		return fmt.Errorf("upsert affected 0 rows: %+v", event)
-	}
-
 	return nil
 }
 
+// UpsertBatchTx upserts many read events with multi-row statements inside tx.
+func (s *MySQLStore) UpsertBatchTx(tx Tx, events []ReadEvent) error {
+	return execBatchUpsert(tx, events, func(n int) string {
+		return `
+			INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
+			VALUES ` + valuesList(n, false) + `
+			ON DUPLICATE KEY UPDATE
+			channel_id = IF(VALUES(channel_id) = '', channel_id, VALUES(channel_id)),
+			timestamp = GREATEST(timestamp, VALUES(timestamp))
+		`
+	})
+}
+
 // Upsert performs an upsert outside a transaction
 func (s *MySQLStore) Upsert(event ReadEvent) error {
-	query := `
-		INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
-		VALUES (?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE timestamp = VALUES(timestamp)
-	`
-	result, err := s.db.Exec(query, event.MessageID, event.UserID, event.ChannelID, event.Timestamp)
-	if err != nil {
+	if _, err := s.db.Exec(mysqlUpsertReadEvent, event.MessageID, event.UserID, event.ChannelID, event.Timestamp); err != nil {
 		return fmt.Errorf("failed to upsert read event: %w", err)
 	}
+	return nil
+}
 
-	rows, err := result.RowsAffected()
+// DeleteReadEventsBefore removes at most limit read events older than cutoffMs.
+func (s *MySQLStore) DeleteReadEventsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM read_events
+		WHERE timestamp < ? AND (? = '' OR channel_id = ?)
+		`+notHeld+`
+		LIMIT ?
+	`, cutoffMs, channelID, channelID, limit)
 	if err != nil {
-		return fmt.Errorf("failed to get affected rows: %w", err)
+		return 0, fmt.Errorf("failed to delete read events: %w", err)
 	}
+	return deleted, nil
+}
 
-	if rows == 0 {
-		return fmt.Errorf("upsert affected 0 rows: %+v", event)
+// DeleteChannelReadsBefore removes at most limit channel reads older than cutoffMs.
+func (s *MySQLStore) DeleteChannelReadsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM channel_reads
+		WHERE last_seen_at < ? AND (? = '' OR channel_id = ?)
+		`+notHeld+`
+		LIMIT ?
+	`, cutoffMs, channelID, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete channel reads: %w", err)
 	}
+	return deleted, nil
+}
 
-	return nil
+func (s *MySQLStore) GetReceiptChannelIDs() ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT channel_id FROM read_events
+		UNION
+		SELECT channel_id FROM channel_reads
+		UNION
+		SELECT channel_id FROM delivery_events
+		UNION
+		SELECT channel_id FROM acknowledgements
+		ORDER BY channel_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt channels: %w", err)
+	}
+	return scanIDs(rows)
 }
 
 // CleanupOlderThan deletes old read receipts
@@ -117,14 +124,18 @@ func (s *MySQLStore) CleanupOlderThan(days int) error {
 	cutoffMs := time.Now().AddDate(0, 0, -days).UnixMilli()
 
 	// Execute each DELETE separately to avoid requiring multiStatements=true
-	if _, err := s.db.Exec("DELETE FROM read_events WHERE timestamp < ?", cutoffMs); err != nil {
+	if _, err := s.db.Exec("DELETE FROM read_events WHERE timestamp < ?"+notHeld, cutoffMs); err != nil {
 		return fmt.Errorf("failed to cleanup read_events: %w", err)
 	}
 
-	if _, err := s.db.Exec("DELETE FROM channel_reads WHERE last_seen_at < ?", cutoffMs); err != nil {
+	if _, err := s.db.Exec("DELETE FROM channel_reads WHERE last_seen_at < ?"+notHeld, cutoffMs); err != nil {
 		return fmt.Errorf("failed to cleanup channel_reads: %w", err)
 	}
 
+	if _, err := s.db.Exec("DELETE FROM delivery_events WHERE delivered_at < ?"+notHeld, cutoffMs); err != nil {
+		return fmt.Errorf("failed to cleanup delivery_events: %w", err)
+	}
+
 	return nil
 }
 
@@ -136,9 +147,10 @@ func (s *MySQLStore) GetReadersSince(channelID string, sinceMs int64, excludeUse
 	query := `
 		SELECT user_id
 		FROM channel_reads
-		WHERE channel_id = ? AND last_seen_at >= ? AND user_id != ?
+		WHERE channel_id = ? AND last_seen_at >= ? AND user_id != ? AND left_at = 0
+		ORDER BY last_seen_at DESC, user_id
 	`
-	rows, err := s.db.Query(query, channelID, sinceMs, excludeUserID)
+	rows, err := s.readQuery(query, channelID, sinceMs, excludeUserID)
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +167,43 @@ func (s *MySQLStore) GetReadersSince(channelID string, sinceMs int64, excludeUse
 	return userIDs, rows.Err()
 }
 
+// SaveReadEvent records a read event with the usual upsert semantics.
+func (s *MySQLStore) SaveReadEvent(event ReadEvent) error {
+	return s.Upsert(event)
+}
+
+func (s *MySQLStore) GetPostReaderIDs(messageID, channelID string, sinceMs int64) ([]string, error) {
+	query := `
+		SELECT user_id FROM read_events WHERE message_id = ?
+		UNION
+		SELECT user_id FROM channel_reads WHERE channel_id = ? AND last_seen_at >= ? AND left_at = 0
+		ORDER BY user_id
+	`
+	rows, err := s.readQuery(query, messageID, channelID, sinceMs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post readers: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+func (s *MySQLStore) GetPostReaders(messageID, channelID string, sinceMs int64, offset, limit int) ([]PostRead, error) {
+	offset, limit = pageBounds(offset, limit)
+	query := `
+		SELECT user_id, timestamp AS read_at, 0 AS inferred FROM read_events WHERE message_id = ?
+		UNION ALL
+		SELECT cr.user_id, cr.last_seen_at, 1 FROM channel_reads cr
+		WHERE cr.channel_id = ? AND cr.last_seen_at >= ? AND cr.left_at = 0
+		AND NOT EXISTS (SELECT 1 FROM read_events re WHERE re.message_id = ? AND re.user_id = cr.user_id)
+		ORDER BY read_at DESC, user_id
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.readQuery(query, messageID, channelID, sinceMs, messageID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post readers: %w", err)
+	}
+	return scanPostReads(rows)
+}
+
 // GetByChannel retrieves read receipt events for a channel, excluding a specific user.
 func (s *MySQLStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent, error) {
 	query := `
@@ -165,7 +214,7 @@ func (s *MySQLStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent,
 		ORDER BY timestamp DESC
 	`
 
-	rows, err := s.db.Query(query, channelID, excludeUserID, excludeUserID)
+	rows, err := s.readQuery(query, channelID, excludeUserID, excludeUserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query read events: %w", err)
 	}
@@ -184,3 +233,116 @@ func (s *MySQLStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent,
 	}
 	return events, nil
 }
+
+func (s *MySQLStore) DeleteMessageReceipts(messageID string) (int64, error) {
+	deleted, err := s.deleteAll(messageID,
+		`DELETE FROM read_events WHERE message_id = ?`+notHeld,
+		`DELETE FROM delivery_events WHERE message_id = ?`+notHeld,
+		`DELETE FROM acknowledgements WHERE message_id = ?`+notHeld,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete message receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *MySQLStore) DeleteChannelReceipts(channelID string, limit int) (int64, error) {
+	deleted, err := s.deleteAcross(
+		channelID, limit,
+		`
+			DELETE FROM read_events
+			WHERE channel_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+		`
+			DELETE FROM channel_reads
+			WHERE channel_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+		`
+			DELETE FROM delivery_events
+			WHERE channel_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+		`
+			DELETE FROM acknowledgements
+			WHERE channel_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete channel receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *MySQLStore) DeleteUserReceipts(userID string, limit int) (int64, error) {
+	deleted, err := s.deleteAcross(
+		userID, limit,
+		`
+			DELETE FROM read_events
+			WHERE user_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+		`
+			DELETE FROM channel_reads
+			WHERE user_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+		`
+			DELETE FROM delivery_events
+			WHERE user_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+		`
+			DELETE FROM acknowledgements
+			WHERE user_id = ?
+			`+notHeld+`
+			LIMIT ?
+		`,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete user receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *MySQLStore) GetReceiptUserIDs() ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT user_id FROM read_events
+		UNION
+		SELECT user_id FROM channel_reads
+		UNION
+		SELECT user_id FROM delivery_events
+		UNION
+		SELECT user_id FROM acknowledgements
+		ORDER BY user_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt users: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+func (s *MySQLStore) GetReceiptMessageIDs(channelID, afterID string, limit int) ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT message_id FROM read_events WHERE channel_id = ? AND message_id > ?
+		UNION
+		SELECT message_id FROM delivery_events WHERE channel_id = ? AND message_id > ?
+		UNION
+		SELECT message_id FROM acknowledgements WHERE channel_id = ? AND message_id > ?
+		ORDER BY message_id
+		LIMIT ?
+	`, channelID, afterID, channelID, afterID, channelID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt messages: %w", err)
+	}
+	return scanIDs(rows)
+}
@@ -20,34 +20,60 @@ func NewPostgresStore(db *sql.DB) *PostgresStore {
 	}
 }
 
+// Initialize brings the schema up to date through the versioned migrations.
 func (s *PostgresStore) Initialize() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS read_events (
-		message_id TEXT NOT NULL,
-		user_id TEXT NOT NULL,
-		timestamp BIGINT NOT NULL,
-		channel_id TEXT,
-		PRIMARY KEY (message_id, user_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_read_events_message_id ON read_events(message_id);
-	CREATE INDEX IF NOT EXISTS idx_read_events_user_id ON read_events(user_id);
-	CREATE INDEX IF NOT EXISTS idx_read_events_channel_id ON read_events(channel_id);
-	`
-	_, err := s.db.Exec(query)
-	return err
+	return Migrate(s.db, DialectPostgres)
 }
 
 func (s *PostgresStore) Upsert(event ReadEvent) error {
 	query := `
 		INSERT INTO read_events (message_id, user_id, timestamp, channel_id)
 		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (message_id, user_id)
-		DO UPDATE SET timestamp = EXCLUDED.timestamp, channel_id = EXCLUDED.channel_id
+		ON CONFLICT (message_id, user_id) DO UPDATE SET
+		timestamp = GREATEST(read_events.timestamp, EXCLUDED.timestamp),
+		channel_id = CASE WHEN EXCLUDED.channel_id = '' THEN read_events.channel_id ELSE EXCLUDED.channel_id END
 	`
 	_, err := s.db.Exec(query, event.MessageID, event.UserID, event.Timestamp, event.ChannelID)
 	return err
 }
 
+// SaveReadEvent records a read event with the usual upsert semantics.
+func (s *PostgresStore) SaveReadEvent(event ReadEvent) error {
+	return s.Upsert(event)
+}
+
+func (s *PostgresStore) GetPostReaderIDs(messageID, channelID string, sinceMs int64) ([]string, error) {
+	query := `
+		SELECT user_id FROM read_events WHERE message_id = $1
+		UNION
+		SELECT user_id FROM channel_reads WHERE channel_id = $2 AND last_seen_at >= $3 AND left_at = 0
+		ORDER BY user_id
+	`
+	rows, err := s.readQuery(query, messageID, channelID, sinceMs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post readers: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+func (s *PostgresStore) GetPostReaders(messageID, channelID string, sinceMs int64, offset, limit int) ([]PostRead, error) {
+	offset, limit = pageBounds(offset, limit)
+	query := `
+		SELECT user_id, timestamp AS read_at, 0 AS inferred FROM read_events WHERE message_id = $1
+		UNION ALL
+		SELECT cr.user_id, cr.last_seen_at, 1 FROM channel_reads cr
+		WHERE cr.channel_id = $2 AND cr.last_seen_at >= $3 AND cr.left_at = 0
+		AND NOT EXISTS (SELECT 1 FROM read_events re WHERE re.message_id = $1 AND re.user_id = cr.user_id)
+		ORDER BY read_at DESC, user_id
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := s.readQuery(query, messageID, channelID, sinceMs, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post readers: %w", err)
+	}
+	return scanPostReads(rows)
+}
+
 func (s *PostgresStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent, error) {
 	query := `
 		SELECT message_id, user_id, timestamp, channel_id
@@ -57,7 +83,7 @@ func (s *PostgresStore) GetByChannel(channelID, excludeUserID string) ([]ReadEve
 		ORDER BY timestamp DESC
 	`
 
-	rows, err := s.db.Query(query, channelID, excludeUserID)
+	rows, err := s.readQuery(query, channelID, excludeUserID)
 	if err != nil {
 		return nil, err
 	}
@@ -74,46 +100,95 @@ func (s *PostgresStore) GetByChannel(channelID, excludeUserID string) ([]ReadEve
 	return events, rows.Err()
 }
 
+// DeleteReadEventsBefore removes at most limit read events older than cutoffMs.
+func (s *PostgresStore) DeleteReadEventsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM read_events WHERE (message_id, user_id) IN (
+			SELECT message_id, user_id FROM read_events
+			WHERE timestamp < $1 AND ($2 = '' OR channel_id = $2)
+			`+notHeld+`
+			LIMIT $3
+		)
+	`, cutoffMs, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete read events: %w", err)
+	}
+	return deleted, nil
+}
+
+// DeleteChannelReadsBefore removes at most limit channel reads older than cutoffMs.
+func (s *PostgresStore) DeleteChannelReadsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM channel_reads WHERE (channel_id, user_id) IN (
+			SELECT channel_id, user_id FROM channel_reads
+			WHERE last_seen_at < $1 AND ($2 = '' OR channel_id = $2)
+			`+notHeld+`
+			LIMIT $3
+		)
+	`, cutoffMs, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete channel reads: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStore) GetReceiptChannelIDs() ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT channel_id FROM read_events
+		UNION
+		SELECT channel_id FROM channel_reads
+		UNION
+		SELECT channel_id FROM delivery_events
+		UNION
+		SELECT channel_id FROM acknowledgements
+		ORDER BY channel_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt channels: %w", err)
+	}
+	return scanIDs(rows)
+}
+
 func (s *PostgresStore) CleanupOlderThan(days int) error {
 	cutoffMs := time.Now().AddDate(0, 0, -days).UnixMilli()
 
 	// PostgreSQL doesn't support multiple statements in a single Exec
 	// Execute each DELETE separately
-	if _, err := s.db.Exec("DELETE FROM read_events WHERE timestamp < $1", cutoffMs); err != nil {
+	if _, err := s.db.Exec("DELETE FROM read_events WHERE timestamp < $1"+notHeld, cutoffMs); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec("DELETE FROM channel_reads WHERE last_seen_at < $1"+notHeld, cutoffMs); err != nil {
 		return err
 	}
 
-	if _, err := s.db.Exec("DELETE FROM channel_reads WHERE last_seen_at < $1", cutoffMs); err != nil {
+	if _, err := s.db.Exec("DELETE FROM delivery_events WHERE delivered_at < $1"+notHeld, cutoffMs); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// InitializeChannelReads is kept for interface compatibility; channel_reads
+// is created by the versioned migrations run in Initialize.
 func (s *PostgresStore) InitializeChannelReads() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS channel_reads (
-		channel_id TEXT NOT NULL,
-		user_id TEXT NOT NULL,
-		last_post_id TEXT NOT NULL,
-		last_seen_at BIGINT NOT NULL,
-		PRIMARY KEY (channel_id, user_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_channel_reads_channel_id ON channel_reads(channel_id);
-	CREATE INDEX IF NOT EXISTS idx_channel_reads_user_id ON channel_reads(user_id);
-	`
-	_, err := s.db.Exec(query)
-	return err
+	return s.Initialize()
 }
 
 func (s *PostgresStore) UpsertChannelRead(channelID, userID, lastPostID string, lastSeenMs int64) error {
 	query := `
-	INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at)
-	VALUES ($1, $2, $3, $4)
-	ON CONFLICT (channel_id, user_id)
-	DO UPDATE SET last_post_id = EXCLUDED.last_post_id, last_seen_at = EXCLUDED.last_seen_at
+	INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at, source)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (channel_id, user_id) DO UPDATE SET
+	last_post_id = CASE
+		WHEN channel_reads.last_seen_at < EXCLUDED.last_seen_at THEN EXCLUDED.last_post_id
+		ELSE channel_reads.last_post_id
+	END,
+	source = CASE WHEN channel_reads.last_seen_at < EXCLUDED.last_seen_at THEN EXCLUDED.source ELSE channel_reads.source END,
+	last_seen_at = GREATEST(channel_reads.last_seen_at, EXCLUDED.last_seen_at),
+	left_at = CASE WHEN channel_reads.left_at < EXCLUDED.last_seen_at THEN 0 ELSE channel_reads.left_at END
 	`
-	_, err := s.db.Exec(query, channelID, userID, lastPostID, lastSeenMs)
+	_, err := s.db.Exec(query, channelID, userID, lastPostID, lastSeenMs, types.ReadSourceClient)
 	return err
 }
 
@@ -132,9 +207,10 @@ func (s *PostgresStore) GetReadersSince(channelID string, sinceMs int64, exclude
 	query := `
 	SELECT user_id
 	FROM channel_reads
-	WHERE channel_id = $1 AND last_seen_at >= $2 AND user_id != $3
+	WHERE channel_id = $1 AND last_seen_at >= $2 AND user_id != $3 AND left_at = 0
+	ORDER BY last_seen_at DESC, user_id
 	`
-	rows, err := s.db.Query(query, channelID, sinceMs, excludeUserID)
+	rows, err := s.readQuery(query, channelID, sinceMs, excludeUserID)
 	if err != nil {
 		return nil, err
 	}
@@ -166,12 +242,25 @@ func (s *PostgresStore) UpsertTx(tx Tx, event ReadEvent) error {
 		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (message_id, user_id) DO UPDATE SET
 		timestamp = GREATEST(read_events.timestamp, EXCLUDED.timestamp),
-		channel_id = EXCLUDED.channel_id
+		channel_id = CASE WHEN EXCLUDED.channel_id = '' THEN read_events.channel_id ELSE EXCLUDED.channel_id END
 	`
 	_, err := sqlTx.Exec(query, event.MessageID, event.UserID, event.ChannelID, event.Timestamp)
 	return err
 }
 
+// UpsertBatchTx upserts many read events with multi-row statements inside tx.
+func (s *PostgresStore) UpsertBatchTx(tx Tx, events []ReadEvent) error {
+	return execBatchUpsert(tx, events, func(n int) string {
+		return `
+			INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
+			VALUES ` + valuesList(n, true) + `
+			ON CONFLICT (message_id, user_id) DO UPDATE SET
+			timestamp = GREATEST(read_events.timestamp, EXCLUDED.timestamp),
+			channel_id = CASE WHEN EXCLUDED.channel_id = '' THEN read_events.channel_id ELSE EXCLUDED.channel_id END
+		`
+	})
+}
+
 func (s *PostgresStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error {
 	sqlTx, ok := tx.(*sql.Tx)
 	if !ok {
@@ -179,27 +268,40 @@ func (s *PostgresStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error
 	}
 
 	query := `
-		INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at, source)
+		VALUES ($1, $2, $3, $4, $5)
 		ON CONFLICT (channel_id, user_id) DO UPDATE SET
 		last_post_id = CASE
 			WHEN channel_reads.last_seen_at < EXCLUDED.last_seen_at THEN EXCLUDED.last_post_id
 			ELSE channel_reads.last_post_id
 		END,
-		last_seen_at = GREATEST(channel_reads.last_seen_at, EXCLUDED.last_seen_at)
+		source = CASE WHEN channel_reads.last_seen_at < EXCLUDED.last_seen_at THEN EXCLUDED.source ELSE channel_reads.source END,
+		last_seen_at = GREATEST(channel_reads.last_seen_at, EXCLUDED.last_seen_at),
+		left_at = CASE WHEN channel_reads.left_at < EXCLUDED.last_seen_at THEN 0 ELSE channel_reads.left_at END
 	`
-	_, err := sqlTx.Exec(query, read.ChannelID, read.UserID, read.LastPostID, read.LastSeenAt)
+	_, err := sqlTx.Exec(query, read.ChannelID, read.UserID, read.LastPostID, read.LastSeenAt, readSource(read))
 	return err
 }
 
+func (s *PostgresStore) MarkChannelReadLeft(channelID, userID string, leftAt int64) error {
+	query := `
+		UPDATE channel_reads SET left_at = $1
+		WHERE channel_id = $2 AND user_id = $3
+	`
+	if _, err := s.db.Exec(query, leftAt, channelID, userID); err != nil {
+		return fmt.Errorf("failed to mark channel read left: %w", err)
+	}
+	return nil
+}
+
 func (s *PostgresStore) GetChannelReads(channelID string) ([]types.ChannelRead, error) {
 	query := `
-		SELECT channel_id, user_id, last_post_id, last_seen_at
+		SELECT channel_id, user_id, last_post_id, last_seen_at, source
 		FROM channel_reads
-		WHERE channel_id = $1
+		WHERE channel_id = $1 AND left_at = 0
 		ORDER BY last_seen_at DESC
 	`
-	rows, err := s.db.Query(query, channelID)
+	rows, err := s.readQuery(query, channelID)
 	if err != nil {
 		return nil, err
 	}
@@ -208,10 +310,139 @@ func (s *PostgresStore) GetChannelReads(channelID string) ([]types.ChannelRead,
 	var reads []types.ChannelRead
 	for rows.Next() {
 		var read types.ChannelRead
-		if err := rows.Scan(&read.ChannelID, &read.UserID, &read.LastPostID, &read.LastSeenAt); err != nil {
+		if err := rows.Scan(&read.ChannelID, &read.UserID, &read.LastPostID, &read.LastSeenAt, &read.Source); err != nil {
 			return nil, err
 		}
 		reads = append(reads, read)
 	}
 	return reads, rows.Err()
 }
+
+func (s *PostgresStore) DeleteMessageReceipts(messageID string) (int64, error) {
+	deleted, err := s.deleteAll(messageID,
+		`DELETE FROM read_events WHERE message_id = $1`+notHeld,
+		`DELETE FROM delivery_events WHERE message_id = $1`+notHeld,
+		`DELETE FROM acknowledgements WHERE message_id = $1`+notHeld,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete message receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStore) DeleteChannelReceipts(channelID string, limit int) (int64, error) {
+	deleted, err := s.deleteAcross(
+		channelID, limit,
+		`
+			DELETE FROM read_events WHERE (message_id, user_id) IN (
+				SELECT message_id, user_id FROM read_events
+				WHERE channel_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+		`
+			DELETE FROM channel_reads WHERE (channel_id, user_id) IN (
+				SELECT channel_id, user_id FROM channel_reads
+				WHERE channel_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+		`
+			DELETE FROM delivery_events WHERE (message_id, user_id) IN (
+				SELECT message_id, user_id FROM delivery_events
+				WHERE channel_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+		`
+			DELETE FROM acknowledgements WHERE (message_id, user_id) IN (
+				SELECT message_id, user_id FROM acknowledgements
+				WHERE channel_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete channel receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStore) DeleteUserReceipts(userID string, limit int) (int64, error) {
+	deleted, err := s.deleteAcross(
+		userID, limit,
+		`
+			DELETE FROM read_events WHERE (message_id, user_id) IN (
+				SELECT message_id, user_id FROM read_events
+				WHERE user_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+		`
+			DELETE FROM channel_reads WHERE (channel_id, user_id) IN (
+				SELECT channel_id, user_id FROM channel_reads
+				WHERE user_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+		`
+			DELETE FROM delivery_events WHERE (message_id, user_id) IN (
+				SELECT message_id, user_id FROM delivery_events
+				WHERE user_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+		`
+			DELETE FROM acknowledgements WHERE (message_id, user_id) IN (
+				SELECT message_id, user_id FROM acknowledgements
+				WHERE user_id = $1
+				`+notHeld+`
+				LIMIT $2
+			)
+		`,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete user receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStore) GetReceiptUserIDs() ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT user_id FROM read_events
+		UNION
+		SELECT user_id FROM channel_reads
+		UNION
+		SELECT user_id FROM delivery_events
+		UNION
+		SELECT user_id FROM acknowledgements
+		ORDER BY user_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt users: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+func (s *PostgresStore) GetReceiptMessageIDs(channelID, afterID string, limit int) ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT message_id FROM read_events WHERE channel_id = $1 AND message_id > $2
+		UNION
+		SELECT message_id FROM delivery_events WHERE channel_id = $1 AND message_id > $2
+		UNION
+		SELECT message_id FROM acknowledgements WHERE channel_id = $1 AND message_id > $2
+		ORDER BY message_id
+		LIMIT $3
+	`, channelID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt messages: %w", err)
+	}
+	return scanIDs(rows)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/lib/pq"
+)
+
+func setupPostgresTestStore(t *testing.T) *PostgresStore {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Skipf("Postgres not available: %v", err)
+	}
+
+	// Clean up any existing test data
+	dropTestTables(t, db)
+
+	store := NewPostgresStore(db)
+	require.NoError(t, store.Initialize())
+	return store
+}
+
+func TestPostgresStore(t *testing.T) {
+	testReceiptStore(t, func(t *testing.T) ReceiptStore {
+		return setupPostgresTestStore(t)
+	})
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	store := setupPostgresTestStore(t)
+	testMigrator(t, store.db, DialectPostgres)
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Receipt setting scopes.
+const (
+	SettingScopeTeam    = "team"
+	SettingScopeChannel = "channel"
+)
+
+// ReceiptSetting turns receipts on or off for one team or channel.
+type ReceiptSetting struct {
+	Scope     string `json:"scope"` // team | channel
+	ScopeID   string `json:"scope_id"`
+	Enabled   bool   `json:"enabled"`
+	UpdatedBy string `json:"updated_by"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+const selectReceiptSettings = `
+	SELECT scope, scope_id, enabled, updated_by, updated_at
+	FROM receipt_settings
+`
+
+func scanReceiptSettings(rows *sql.Rows) ([]ReceiptSetting, error) {
+	defer rows.Close()
+
+	var settings []ReceiptSetting
+	for rows.Next() {
+		var setting ReceiptSetting
+		if err := rows.Scan(&setting.Scope, &setting.ScopeID, &setting.Enabled, &setting.UpdatedBy, &setting.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan receipt setting: %w", err)
+		}
+		settings = append(settings, setting)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating receipt settings: %w", err)
+	}
+	return settings, nil
+}
+
+// firstReceiptSetting returns the only setting in settings, or nil.
+func firstReceiptSetting(settings []ReceiptSetting, err error) (*ReceiptSetting, error) {
+	if err != nil || len(settings) == 0 {
+		return nil, err
+	}
+	return &settings[0], nil
+}
+
+// Settings are read from the primary so that turning receipts off takes
+// effect at once, even behind a lagging replica.
+
+func (s *PostgresStore) SaveReceiptSetting(setting ReceiptSetting) error {
+	_, err := s.db.Exec(`
+		INSERT INTO receipt_settings (scope, scope_id, enabled, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, scope_id) DO UPDATE SET
+		enabled = EXCLUDED.enabled,
+		updated_by = EXCLUDED.updated_by,
+		updated_at = EXCLUDED.updated_at
+	`, setting.Scope, setting.ScopeID, setting.Enabled, setting.UpdatedBy, setting.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save receipt setting: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetReceiptSetting(scope, scopeID string) (*ReceiptSetting, error) {
+	rows, err := s.db.Query(selectReceiptSettings+`WHERE scope = $1 AND scope_id = $2`, scope, scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt setting: %w", err)
+	}
+	return firstReceiptSetting(scanReceiptSettings(rows))
+}
+
+func (s *PostgresStore) GetReceiptSettings(scope string) ([]ReceiptSetting, error) {
+	rows, err := s.db.Query(selectReceiptSettings+`WHERE scope = $1 ORDER BY scope_id`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt settings: %w", err)
+	}
+	return scanReceiptSettings(rows)
+}
+
+func (s *MySQLStore) SaveReceiptSetting(setting ReceiptSetting) error {
+	_, err := s.db.Exec(`
+		INSERT INTO receipt_settings (scope, scope_id, enabled, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		enabled = VALUES(enabled),
+		updated_by = VALUES(updated_by),
+		updated_at = VALUES(updated_at)
+	`, setting.Scope, setting.ScopeID, setting.Enabled, setting.UpdatedBy, setting.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save receipt setting: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetReceiptSetting(scope, scopeID string) (*ReceiptSetting, error) {
+	rows, err := s.db.Query(selectReceiptSettings+`WHERE scope = ? AND scope_id = ?`, scope, scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt setting: %w", err)
+	}
+	return firstReceiptSetting(scanReceiptSettings(rows))
+}
+
+func (s *MySQLStore) GetReceiptSettings(scope string) ([]ReceiptSetting, error) {
+	rows, err := s.db.Query(selectReceiptSettings+`WHERE scope = ? ORDER BY scope_id`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt settings: %w", err)
+	}
+	return scanReceiptSettings(rows)
+}
+
+func (s *SQLiteStore) SaveReceiptSetting(setting ReceiptSetting) error {
+	_, err := s.db.Exec(`
+		INSERT INTO receipt_settings (scope, scope_id, enabled, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (scope, scope_id) DO UPDATE SET
+		enabled = excluded.enabled,
+		updated_by = excluded.updated_by,
+		updated_at = excluded.updated_at
+	`, setting.Scope, setting.ScopeID, setting.Enabled, setting.UpdatedBy, setting.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save receipt setting: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetReceiptSetting(scope, scopeID string) (*ReceiptSetting, error) {
+	rows, err := s.db.Query(selectReceiptSettings+`WHERE scope = ? AND scope_id = ?`, scope, scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt setting: %w", err)
+	}
+	return firstReceiptSetting(scanReceiptSettings(rows))
+}
+
+func (s *SQLiteStore) GetReceiptSettings(scope string) ([]ReceiptSetting, error) {
+	rows, err := s.db.Query(selectReceiptSettings+`WHERE scope = ? ORDER BY scope_id`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt settings: %w", err)
+	}
+	return scanReceiptSettings(rows)
+}
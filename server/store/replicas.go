@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// replicaRetryAfter is how long a failing replica is skipped before it is tried again.
+const replicaRetryAfter = 30 * time.Second
+
+// replica is a read-only pool with its own failure back-off.
+type replica struct {
+	db        *sql.DB
+	downUntil atomic.Int64 // unix millis; 0 when healthy
+}
+
+// readRouter spreads read-only queries over the configured replicas in
+// round-robin order. Receipts are eventually consistent, so replica lag is
+// tolerated; a replica that errors is skipped for a while and the query is
+// retried on the primary instead.
+type readRouter struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint32
+	now      func() time.Time
+}
+
+func newReadRouter(primary *sql.DB) *readRouter {
+	return &readRouter{primary: primary, now: time.Now}
+}
+
+// pick returns a healthy replica, or nil when reads should go to the primary.
+func (r *readRouter) pick() *replica {
+	n := len(r.replicas)
+	if n == 0 {
+		return nil
+	}
+	nowMs := r.now().UnixMilli()
+	start := int(r.next.Add(1))
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(start+i)%n]
+		if rep.downUntil.Load() <= nowMs {
+			return rep
+		}
+	}
+	return nil
+}
+
+func (r *readRouter) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if rep := r.pick(); rep != nil {
+		rows, err := rep.db.Query(query, args...)
+		if err == nil {
+			return rows, nil
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		rep.downUntil.Store(r.now().Add(replicaRetryAfter).UnixMilli())
+	}
+	return r.primary.Query(query, args...)
+}
+
+// SetReplicas routes read-only queries to the given replica pools. Passing
+// no replicas sends all reads back to the primary.
+func (s *BaseStore) SetReplicas(replicas ...*sql.DB) {
+	router := newReadRouter(s.db)
+	for _, db := range replicas {
+		if db != nil {
+			router.replicas = append(router.replicas, &replica{db: db})
+		}
+	}
+	s.reads = router
+}
+
+// readQuery runs a read-only query on a replica when one is available.
+func (s *BaseStore) readQuery(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.reads.query(query, args...)
+}
+
+// PrimaryReader is implemented by stores that can read from the primary
+// alone, for callers that must not see a lagging replica.
+type PrimaryReader interface {
+	Primary() ReceiptStore
+}
+
+// primaryOnly returns a copy of s whose reads skip the replicas.
+func (s BaseStore) primaryOnly() BaseStore {
+	s.reads = newReadRouter(s.db)
+	return s
+}
+
+// Primary returns a view of s that reads from the primary only.
+func (s *PostgresStore) Primary() ReceiptStore {
+	return &PostgresStore{BaseStore: s.primaryOnly()}
+}
+
+// Primary returns a view of s that reads from the primary only.
+func (s *MySQLStore) Primary() ReceiptStore {
+	return &MySQLStore{BaseStore: s.primaryOnly()}
+}
+
+// Primary returns a view of s that reads from the primary only.
+func (s *SQLiteStore) Primary() ReceiptStore {
+	return &SQLiteStore{BaseStore: s.primaryOnly()}
+}
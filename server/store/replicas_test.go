@@ -0,0 +1,71 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	primary := setupSQLiteTestStore(t)
+	replicaStore := setupSQLiteTestStore(t)
+
+	require.NoError(t, primary.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+	require.NoError(t, replicaStore.Upsert(ReadEvent{MessageID: "msg1", UserID: "user2", ChannelID: "channel1", Timestamp: 1}))
+
+	t.Run("reads go to the replica", func(t *testing.T) {
+		primary.SetReplicas(replicaStore.db)
+
+		events, err := primary.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "user2", events[0].UserID)
+	})
+
+	t.Run("writes go to the primary", func(t *testing.T) {
+		primary.SetReplicas(replicaStore.db)
+		require.NoError(t, primary.UpsertChannelRead("channel1", "user3", "msg1", 1))
+
+		primary.SetReplicas()
+		readers, err := primary.GetReadersSince("channel1", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user3"}, readers)
+	})
+
+	t.Run("failing replica falls back to the primary", func(t *testing.T) {
+		broken, err := OpenSQLite(filepath.Join(t.TempDir(), "broken.db"))
+		require.NoError(t, err)
+		require.NoError(t, broken.Close())
+
+		primary.SetReplicas(broken)
+		now := time.Now()
+		primary.reads.now = func() time.Time { return now }
+
+		events, err := primary.GetByChannel("channel1", "")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "user1", events[0].UserID)
+
+		// The broken replica is skipped until the back-off expires
+		assert.Nil(t, primary.reads.pick())
+		now = now.Add(replicaRetryAfter)
+		assert.NotNil(t, primary.reads.pick())
+	})
+}
+
+func TestReadRouterRoundRobin(t *testing.T) {
+	a := setupSQLiteTestStore(t)
+	b := setupSQLiteTestStore(t)
+
+	router := newReadRouter(nil)
+	router.replicas = []*replica{{db: a.db}, {db: b.db}}
+
+	first := router.pick()
+	second := router.pick()
+	require.NotNil(t, first)
+	require.NotNil(t, second)
+	assert.NotSame(t, first, second)
+}
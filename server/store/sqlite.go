@@ -0,0 +1,459 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/arg/mattermost-readreceipts/server/types"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteUpsertReadEvent keeps the newest timestamp and only replaces channel_id
+// when the new event carries one, matching the Postgres and MySQL stores.
+const sqliteUpsertReadEvent = `
+	INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (message_id, user_id) DO UPDATE SET
+	timestamp = MAX(read_events.timestamp, excluded.timestamp),
+	channel_id = CASE WHEN excluded.channel_id = '' THEN read_events.channel_id ELSE excluded.channel_id END
+`
+
+const sqliteUpsertChannelRead = `
+	INSERT INTO channel_reads (channel_id, user_id, last_post_id, last_seen_at, source)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (channel_id, user_id) DO UPDATE SET
+	last_post_id = CASE
+		WHEN channel_reads.last_seen_at < excluded.last_seen_at THEN excluded.last_post_id
+		ELSE channel_reads.last_post_id
+	END,
+	source = CASE WHEN channel_reads.last_seen_at < excluded.last_seen_at THEN excluded.source ELSE channel_reads.source END,
+	last_seen_at = MAX(channel_reads.last_seen_at, excluded.last_seen_at),
+	left_at = CASE WHEN channel_reads.left_at < excluded.last_seen_at THEN 0 ELSE channel_reads.left_at END
+`
+
+// SQLiteStore keeps receipts in a standalone SQLite file. It is meant for
+// small deployments, dev servers and CI runs without a database daemon.
+type SQLiteStore struct {
+	BaseStore
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{
+		BaseStore: NewBaseStore(db),
+	}
+}
+
+// OpenSQLite opens the SQLite database at path, creating the file if needed.
+// SQLite allows a single writer, so the pool is limited to one connection;
+// this also keeps ":memory:" databases from splitting across connections.
+func OpenSQLite(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// Initialize brings the schema up to date through the versioned migrations.
+func (s *SQLiteStore) Initialize() error {
+	return Migrate(s.db, DialectSQLite)
+}
+
+// InitializeChannelReads is kept for interface compatibility; channel_reads
+// is created by the versioned migrations run in Initialize.
+func (s *SQLiteStore) InitializeChannelReads() error {
+	return s.Initialize()
+}
+
+// BeginTx starts a transaction
+func (s *SQLiteStore) BeginTx() (Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return tx, nil
+}
+
+func (s *SQLiteStore) Upsert(event ReadEvent) error {
+	if _, err := s.db.Exec(sqliteUpsertReadEvent, event.MessageID, event.UserID, event.ChannelID, event.Timestamp); err != nil {
+		return fmt.Errorf("failed to upsert read event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpsertTx(tx Tx, event ReadEvent) error {
+	sqlTx, ok := tx.(*sql.Tx)
+	if !ok {
+		return fmt.Errorf("invalid transaction type: %T", tx)
+	}
+	if _, err := sqlTx.Exec(sqliteUpsertReadEvent, event.MessageID, event.UserID, event.ChannelID, event.Timestamp); err != nil {
+		return fmt.Errorf("failed to upsert read event: %w", err)
+	}
+	return nil
+}
+
+// UpsertBatchTx upserts many read events with multi-row statements inside tx.
+func (s *SQLiteStore) UpsertBatchTx(tx Tx, events []ReadEvent) error {
+	return execBatchUpsert(tx, events, func(n int) string {
+		return `
+			INSERT INTO read_events (message_id, user_id, channel_id, timestamp)
+			VALUES ` + valuesList(n, false) + `
+			ON CONFLICT (message_id, user_id) DO UPDATE SET
+			timestamp = MAX(read_events.timestamp, excluded.timestamp),
+			channel_id = CASE WHEN excluded.channel_id = '' THEN read_events.channel_id ELSE excluded.channel_id END
+		`
+	})
+}
+
+// SaveReadEvent records a read event with the usual upsert semantics.
+func (s *SQLiteStore) SaveReadEvent(event ReadEvent) error {
+	return s.Upsert(event)
+}
+
+func (s *SQLiteStore) GetPostReaderIDs(messageID, channelID string, sinceMs int64) ([]string, error) {
+	query := `
+		SELECT user_id FROM read_events WHERE message_id = ?
+		UNION
+		SELECT user_id FROM channel_reads WHERE channel_id = ? AND last_seen_at >= ? AND left_at = 0
+		ORDER BY user_id
+	`
+	rows, err := s.readQuery(query, messageID, channelID, sinceMs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post readers: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+func (s *SQLiteStore) GetPostReaders(messageID, channelID string, sinceMs int64, offset, limit int) ([]PostRead, error) {
+	offset, limit = pageBounds(offset, limit)
+	query := `
+		SELECT user_id, timestamp AS read_at, 0 AS inferred FROM read_events WHERE message_id = ?
+		UNION ALL
+		SELECT cr.user_id, cr.last_seen_at, 1 FROM channel_reads cr
+		WHERE cr.channel_id = ? AND cr.last_seen_at >= ? AND cr.left_at = 0
+		AND NOT EXISTS (SELECT 1 FROM read_events re WHERE re.message_id = ? AND re.user_id = cr.user_id)
+		ORDER BY read_at DESC, user_id
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.readQuery(query, messageID, channelID, sinceMs, messageID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post readers: %w", err)
+	}
+	return scanPostReads(rows)
+}
+
+func (s *SQLiteStore) GetByChannel(channelID, excludeUserID string) ([]ReadEvent, error) {
+	query := `
+		SELECT message_id, user_id, timestamp, channel_id
+		FROM read_events
+		WHERE channel_id = ?
+		AND (? = '' OR user_id != ?)
+		ORDER BY timestamp DESC
+	`
+	rows, err := s.readQuery(query, channelID, excludeUserID, excludeUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query read events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ReadEvent
+	for rows.Next() {
+		var event ReadEvent
+		if err := rows.Scan(&event.MessageID, &event.UserID, &event.Timestamp, &event.ChannelID); err != nil {
+			return nil, fmt.Errorf("failed to scan read event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating read events: %w", err)
+	}
+	return events, nil
+}
+
+// DeleteReadEventsBefore removes at most limit read events older than cutoffMs.
+func (s *SQLiteStore) DeleteReadEventsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM read_events WHERE rowid IN (
+			SELECT rowid FROM read_events
+			WHERE timestamp < ? AND (? = '' OR channel_id = ?)
+			`+notHeld+`
+			LIMIT ?
+		)
+	`, cutoffMs, channelID, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete read events: %w", err)
+	}
+	return deleted, nil
+}
+
+// DeleteChannelReadsBefore removes at most limit channel reads older than cutoffMs.
+func (s *SQLiteStore) DeleteChannelReadsBefore(channelID string, cutoffMs int64, limit int) (int64, error) {
+	deleted, err := s.execDelete(`
+		DELETE FROM channel_reads WHERE rowid IN (
+			SELECT rowid FROM channel_reads
+			WHERE last_seen_at < ? AND (? = '' OR channel_id = ?)
+			`+notHeld+`
+			LIMIT ?
+		)
+	`, cutoffMs, channelID, channelID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete channel reads: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *SQLiteStore) GetReceiptChannelIDs() ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT channel_id FROM read_events
+		UNION
+		SELECT channel_id FROM channel_reads
+		UNION
+		SELECT channel_id FROM delivery_events
+		UNION
+		SELECT channel_id FROM acknowledgements
+		ORDER BY channel_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt channels: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+// CleanupOlderThan deletes old read receipts
+func (s *SQLiteStore) CleanupOlderThan(days int) error {
+	cutoffMs := time.Now().AddDate(0, 0, -days).UnixMilli()
+
+	if _, err := s.db.Exec("DELETE FROM read_events WHERE timestamp < ?"+notHeld, cutoffMs); err != nil {
+		return fmt.Errorf("failed to cleanup read_events: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM channel_reads WHERE last_seen_at < ?"+notHeld, cutoffMs); err != nil {
+		return fmt.Errorf("failed to cleanup channel_reads: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM delivery_events WHERE delivered_at < ?"+notHeld, cutoffMs); err != nil {
+		return fmt.Errorf("failed to cleanup delivery_events: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpsertChannelRead(channelID, userID, lastPostID string, lastSeenAt int64) error {
+	if _, err := s.db.Exec(sqliteUpsertChannelRead, channelID, userID, lastPostID, lastSeenAt, types.ReadSourceClient); err != nil {
+		return fmt.Errorf("failed to upsert channel read: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) MarkChannelReadLeft(channelID, userID string, leftAt int64) error {
+	query := `
+		UPDATE channel_reads SET left_at = ?
+		WHERE channel_id = ? AND user_id = ?
+	`
+	if _, err := s.db.Exec(query, leftAt, channelID, userID); err != nil {
+		return fmt.Errorf("failed to mark channel read left: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpsertChannelReadTx(tx Tx, read types.ChannelRead) error {
+	sqlTx, ok := tx.(*sql.Tx)
+	if !ok {
+		return fmt.Errorf("invalid transaction type: %T", tx)
+	}
+	if _, err := sqlTx.Exec(sqliteUpsertChannelRead, read.ChannelID, read.UserID, read.LastPostID, read.LastSeenAt, readSource(read)); err != nil {
+		return fmt.Errorf("failed to upsert channel read: %w", err)
+	}
+	return nil
+}
+
+// GetReadersSince returns a list of unique user IDs who have seen posts in the given channel
+// since the specified time. It excludes a specific user (typically the requesting user).
+func (s *SQLiteStore) GetReadersSince(channelID string, sinceMs int64, excludeUserID string) ([]string, error) {
+	query := `
+		SELECT user_id
+		FROM channel_reads
+		WHERE channel_id = ? AND last_seen_at >= ? AND user_id != ? AND left_at = 0
+		ORDER BY last_seen_at DESC, user_id
+	`
+	rows, err := s.readQuery(query, channelID, sinceMs, excludeUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+func (s *SQLiteStore) GetChannelReads(channelID string) ([]types.ChannelRead, error) {
+	query := `
+		SELECT channel_id, user_id, last_post_id, last_seen_at, source
+		FROM channel_reads
+		WHERE channel_id = ? AND left_at = 0
+		ORDER BY last_seen_at DESC, user_id
+	`
+	rows, err := s.readQuery(query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel reads: %w", err)
+	}
+	defer rows.Close()
+
+	var reads []types.ChannelRead
+	for rows.Next() {
+		var read types.ChannelRead
+		if err := rows.Scan(&read.ChannelID, &read.UserID, &read.LastPostID, &read.LastSeenAt, &read.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan channel read: %w", err)
+		}
+		reads = append(reads, read)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating channel reads: %w", err)
+	}
+	return reads, nil
+}
+
+func (s *SQLiteStore) DeleteMessageReceipts(messageID string) (int64, error) {
+	deleted, err := s.deleteAll(messageID,
+		`DELETE FROM read_events WHERE message_id = ?`+notHeld,
+		`DELETE FROM delivery_events WHERE message_id = ?`+notHeld,
+		`DELETE FROM acknowledgements WHERE message_id = ?`+notHeld,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete message receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *SQLiteStore) DeleteChannelReceipts(channelID string, limit int) (int64, error) {
+	deleted, err := s.deleteAcross(
+		channelID, limit,
+		`
+			DELETE FROM read_events WHERE rowid IN (
+				SELECT rowid FROM read_events
+				WHERE channel_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+		`
+			DELETE FROM channel_reads WHERE rowid IN (
+				SELECT rowid FROM channel_reads
+				WHERE channel_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+		`
+			DELETE FROM delivery_events WHERE rowid IN (
+				SELECT rowid FROM delivery_events
+				WHERE channel_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+		`
+			DELETE FROM acknowledgements WHERE rowid IN (
+				SELECT rowid FROM acknowledgements
+				WHERE channel_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete channel receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *SQLiteStore) DeleteUserReceipts(userID string, limit int) (int64, error) {
+	deleted, err := s.deleteAcross(
+		userID, limit,
+		`
+			DELETE FROM read_events WHERE rowid IN (
+				SELECT rowid FROM read_events
+				WHERE user_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+		`
+			DELETE FROM channel_reads WHERE rowid IN (
+				SELECT rowid FROM channel_reads
+				WHERE user_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+		`
+			DELETE FROM delivery_events WHERE rowid IN (
+				SELECT rowid FROM delivery_events
+				WHERE user_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+		`
+			DELETE FROM acknowledgements WHERE rowid IN (
+				SELECT rowid FROM acknowledgements
+				WHERE user_id = ?
+				`+notHeld+`
+				LIMIT ?
+			)
+		`,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete user receipts: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *SQLiteStore) GetReceiptUserIDs() ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT user_id FROM read_events
+		UNION
+		SELECT user_id FROM channel_reads
+		UNION
+		SELECT user_id FROM delivery_events
+		UNION
+		SELECT user_id FROM acknowledgements
+		ORDER BY user_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt users: %w", err)
+	}
+	return scanIDs(rows)
+}
+
+func (s *SQLiteStore) GetReceiptMessageIDs(channelID, afterID string, limit int) ([]string, error) {
+	rows, err := s.readQuery(`
+		SELECT message_id FROM read_events WHERE channel_id = ? AND message_id > ?
+		UNION
+		SELECT message_id FROM delivery_events WHERE channel_id = ? AND message_id > ?
+		UNION
+		SELECT message_id FROM acknowledgements WHERE channel_id = ? AND message_id > ?
+		ORDER BY message_id
+		LIMIT ?
+	`, channelID, afterID, channelID, afterID, channelID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipt messages: %w", err)
+	}
+	return scanIDs(rows)
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSQLiteTestStore(t *testing.T) *SQLiteStore {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "receipts.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store := NewSQLiteStore(db)
+	require.NoError(t, store.Initialize())
+	return store
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testReceiptStore(t, func(t *testing.T) ReceiptStore {
+		return setupSQLiteTestStore(t)
+	})
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	store := setupSQLiteTestStore(t)
+	testMigrator(t, store.db, DialectSQLite)
+}
+
+func TestSQLiteInMemory(t *testing.T) {
+	db, err := OpenSQLite(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewSQLiteStore(db)
+	require.NoError(t, store.Initialize())
+	require.NoError(t, store.Upsert(ReadEvent{MessageID: "msg1", UserID: "user1", ChannelID: "channel1", Timestamp: 1}))
+
+	events, err := store.GetByChannel("channel1", "")
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
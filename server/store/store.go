@@ -3,6 +3,8 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
+	"math"
 	"strings"
 
 	"github.com/arg/mattermost-readreceipts/server/types"
@@ -16,6 +18,14 @@ type ReadEvent struct {
 	Timestamp int64
 }
 
+// PostRead is one reader of a post. A read inferred from a channel read at
+// or after the post has the channel read's time.
+type PostRead struct {
+	UserID string
+	ReadAt int64
+	Source string // types.ReadSourceClient for read events, else types.ReadSourceInferred
+}
+
 // Tx represents a database transaction
 type Tx interface {
 	Commit() error
@@ -30,10 +40,45 @@ type ReceiptStore interface {
 	// Read receipt operations
 	Upsert(ReadEvent) error
 	UpsertTx(tx Tx, event ReadEvent) error
+	UpsertBatchTx(tx Tx, events []ReadEvent) error
 	GetByChannel(channelID, excludeUserID string) ([]ReadEvent, error)
 	CleanupOlderThan(days int) error
 	Initialize() error
 
+	// Bounded deletes for the retention job. Each call removes at most limit
+	// rows older than cutoffMs and returns how many it removed. An empty
+	// channelID matches every channel. Like CleanupOlderThan, they skip
+	// channels and users under legal hold.
+	DeleteReadEventsBefore(channelID string, cutoffMs int64, limit int) (int64, error)
+	DeleteChannelReadsBefore(channelID string, cutoffMs int64, limit int) (int64, error)
+
+	// GetReceiptChannelIDs returns every channel with a read event, a
+	// channel read or a delivery, sorted. Per-channel retention policies
+	// walk this list.
+	GetReceiptChannelIDs() ([]string, error)
+
+	// Deletes for removed posts, channels and users. Channel and user
+	// deletes remove at most limit rows across all receipt tables per call;
+	// callers repeat until fewer than limit come back. Held rows are kept.
+	DeleteMessageReceipts(messageID string) (int64, error)
+	DeleteChannelReceipts(channelID string, limit int) (int64, error)
+	DeleteUserReceipts(userID string, limit int) (int64, error)
+	GetReceiptUserIDs() ([]string, error)
+	// GetReceiptMessageIDs returns up to limit posts of a channel with a
+	// read event, a delivery or an acknowledgement, sorted and after
+	// afterID, so the cleanup sweep can page through them to find deleted
+	// ones.
+	GetReceiptMessageIDs(channelID, afterID string, limit int) ([]string, error)
+
+	// Legal holds. Every method that deletes receipts must leave held
+	// channels and users alone; the SQL stores append notHeld.
+	SaveLegalHoldTx(tx Tx, hold LegalHold) error
+	DeleteLegalHoldTx(tx Tx, holdID string) (bool, error)
+	GetLegalHold(holdID string) (*LegalHold, error) // nil when missing
+	GetLegalHolds() ([]LegalHold, error)
+	AddLegalHoldAuditTx(tx Tx, entry LegalHoldAudit) error
+	GetLegalHoldAudit(offset, limit int) ([]LegalHoldAudit, error) // newest first
+
 	// Channel-level receipts
 	UpsertChannelRead(channelID, userID, lastPostID string, lastSeenAt int64) error
 	UpsertChannelReadTx(tx Tx, read types.ChannelRead) error
@@ -41,20 +86,124 @@ type ReceiptStore interface {
 	GetChannelReads(channelID string) ([]types.ChannelRead, error)
 	InitializeChannelReads() error
 
+	// MarkChannelReadLeft hides a user's channel read from the reader queries
+	// until they read the channel again after leftAt.
+	MarkChannelReadLeft(channelID, userID string, leftAt int64) error
+
+	// Deliveries: a post reached a user's client. The first delivery wins.
+	// DeleteDeliveriesBefore follows the rules of the retention deletes above.
+	SaveDeliveries(events []DeliveryEvent) error
+	GetDeliveredUserIDs(messageID string) ([]string, error) // sorted
+	DeleteDeliveriesBefore(channelID string, cutoffMs int64, limit int) (int64, error)
+
+	// Acknowledgements of posts that require one. SaveAcknowledgement keeps
+	// the first and reports whether it added one. Only the deletes for
+	// removed posts, channels and users remove them; age-based retention
+	// leaves them alone.
+	SaveAcknowledgement(ack Acknowledgement) (bool, error)
+	GetAcknowledgements(messageID string) ([]Acknowledgement, error) // oldest first
+
+	// Team and channel settings. Saving replaces the setting of the same
+	// scope and ID.
+	SaveReceiptSetting(setting ReceiptSetting) error
+	GetReceiptSetting(scope, scopeID string) (*ReceiptSetting, error) // nil when unset
+	GetReceiptSettings(scope string) ([]ReceiptSetting, error)        // by scope ID
+
 	// New methods for read receipt handling
 	SaveReadEvent(event ReadEvent) error
-	GetMessageReaders(messageID string) ([]string, error)
+
+	// GetPostReaderIDs returns everyone who has seen a post: users with a read
+	// event for it, plus users whose channel read is at or after sinceMs
+	// (normally the post's CreateAt). IDs are unique and sorted.
+	GetPostReaderIDs(messageID, channelID string, sinceMs int64) ([]string, error)
+	// GetPostReaders pages through the same readers with their read time,
+	// newest first. Users without a read event for the post are inferred.
+	GetPostReaders(messageID, channelID string, sinceMs int64, offset, limit int) ([]PostRead, error)
+}
+
+// batchChunkSize caps the rows per multi-row INSERT so that statements stay
+// well below the bind-parameter limits of every dialect.
+const batchChunkSize = 250
+
+// CoalesceReadEvents merges events for the same (message, user) pair the same
+// way an upsert would: the newest timestamp wins and a known channel is kept.
+// Order of first appearance is preserved.
+func CoalesceReadEvents(events []ReadEvent) []ReadEvent {
+	index := make(map[readEventKey]int, len(events))
+	out := make([]ReadEvent, 0, len(events))
+	for _, event := range events {
+		key := readEventKey{messageID: event.MessageID, userID: event.UserID}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, event)
+			continue
+		}
+		if event.ChannelID != "" {
+			out[i].ChannelID = event.ChannelID
+		}
+		if event.Timestamp > out[i].Timestamp {
+			out[i].Timestamp = event.Timestamp
+		}
+	}
+	return out
+}
+
+// execBatchUpsert coalesces events and runs one multi-row statement per chunk.
+// build returns the statement for n rows.
+func execBatchUpsert(tx Tx, events []ReadEvent, build func(n int) string) error {
+	sqlTx, ok := tx.(*sql.Tx)
+	if !ok {
+		return fmt.Errorf("invalid transaction type: %T", tx)
+	}
+
+	events = CoalesceReadEvents(events)
+	for start := 0; start < len(events); start += batchChunkSize {
+		end := start + batchChunkSize
+		if end > len(events) {
+			end = len(events)
+		}
+		chunk := events[start:end]
+
+		args := make([]interface{}, 0, len(chunk)*4)
+		for _, event := range chunk {
+			args = append(args, event.MessageID, event.UserID, event.ChannelID, event.Timestamp)
+		}
+		if _, err := sqlTx.Exec(build(len(chunk)), args...); err != nil {
+			return fmt.Errorf("failed to upsert read event batch: %w", err)
+		}
+	}
+	return nil
+}
+
+// valuesList renders n rows of four placeholders. With numbered set, it
+// uses $1, $2, ... instead of ?.
+func valuesList(n int, numbered bool) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if numbered {
+			fmt.Fprintf(&b, "($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4)
+		} else {
+			b.WriteString("(?, ?, ?, ?)")
+		}
+	}
+	return b.String()
 }
 
 // BaseStore provides common functionality for store implementations
 type BaseStore struct {
-	db *sql.DB
+	db    *sql.DB
+	reads *readRouter // routes read-only queries, see SetReplicas
 }
 
 // NewBaseStore creates a new base store
 func NewBaseStore(db *sql.DB) BaseStore {
 	return BaseStore{
-		db: db,
+		db:    db,
+		reads: newReadRouter(db),
 	}
 }
 
@@ -82,33 +231,101 @@ func IsUniqueViolation(err error) bool {
 	return false
 }
 
-// Save a read event to the database
-func (s *BaseStore) SaveReadEvent(event ReadEvent) error {
-	_, err := s.db.Exec(
-		"INSERT INTO ReadEvents (message_id, user_id, channel_id, timestamp) VALUES (?, ?, ?, ?)",
-		event.MessageID, event.UserID, event.ChannelID, event.Timestamp,
-	)
-	return err
+// pageBounds normalises offset/limit; a non-positive limit means no limit.
+func pageBounds(offset, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	return offset, limit
 }
 
-// Get all readers for a specific message
-func (s *BaseStore) GetMessageReaders(messageID string) ([]string, error) {
-	rows, err := s.db.Query(
-		"SELECT DISTINCT user_id FROM ReadEvents WHERE message_id = ?",
-		messageID,
-	)
-	if err != nil {
-		return nil, err
+// scanPostReads reads user_id, read_at, inferred rows.
+func scanPostReads(rows *sql.Rows) ([]PostRead, error) {
+	defer rows.Close()
+
+	var reads []PostRead
+	for rows.Next() {
+		var read PostRead
+		var inferred int
+		if err := rows.Scan(&read.UserID, &read.ReadAt, &inferred); err != nil {
+			return nil, fmt.Errorf("failed to scan post read: %w", err)
+		}
+		read.Source = types.ReadSourceClient
+		if inferred != 0 {
+			read.Source = types.ReadSourceInferred
+		}
+		reads = append(reads, read)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating post reads: %w", err)
+	}
+	return reads, nil
+}
+
+// readSource returns the source a channel read is stored with.
+func readSource(read types.ChannelRead) string {
+	if read.Source == "" {
+		return types.ReadSourceClient
+	}
+	return read.Source
+}
+
+// scanIDs reads single-column ID rows, such as user_id or channel_id.
+func scanIDs(rows *sql.Rows) ([]string, error) {
 	defer rows.Close()
 
-	var readers []string
+	var ids []string
 	for rows.Next() {
-		var userID string
-		if err := rows.Scan(&userID); err != nil {
-			return nil, err
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ids: %w", err)
+	}
+	return ids, nil
+}
+
+// deleteAcross removes at most limit rows matching arg, running queries in
+// order and giving each what is left of limit. Every query takes (arg, limit).
+func (s *BaseStore) deleteAcross(arg string, limit int, queries ...string) (int64, error) {
+	var deleted int64
+	for _, query := range queries {
+		if deleted >= int64(limit) {
+			break
 		}
-		readers = append(readers, userID)
+		more, err := s.execDelete(query, arg, limit-int(deleted))
+		deleted += more
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteAll runs every query with arg and returns the rows removed in total.
+func (s *BaseStore) deleteAll(arg string, queries ...string) (int64, error) {
+	var deleted int64
+	for _, query := range queries {
+		more, err := s.execDelete(query, arg)
+		deleted += more
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// execDelete runs a DELETE on the primary and returns the rows removed.
+func (s *BaseStore) execDelete(query string, args ...interface{}) (int64, error) {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
 	}
-	return readers, nil
+	return result.RowsAffected()
 }
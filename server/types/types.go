@@ -14,10 +14,17 @@ type ReadRequest struct {
 	MessageID string `json:"message_id"`
 }
 
+// Channel read sources
+const (
+	ReadSourceClient   = "client"   // reported by the webapp
+	ReadSourceInferred = "inferred" // inferred from Mattermost's LastViewedAt
+)
+
 // ChannelRead represents the latest read status for a user in a channel
 type ChannelRead struct {
 	ChannelID  string
 	UserID     string
 	LastPostID string
 	LastSeenAt int64
+	Source     string // ReadSourceClient when empty
 }
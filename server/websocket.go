@@ -6,8 +6,12 @@ import (
 
 // WebSocket event names
 const (
-	WebSocketEventReadReceipt    = "custom_mattermost-readreceipts_read_receipt"
-	WebSocketEventChannelReaders = "custom_mattermost-readreceipts_channel_readers"
+	WebSocketEventReadReceipt     = "custom_mattermost-readreceipts_read_receipt"
+	WebSocketEventChannelReaders  = "custom_mattermost-readreceipts_channel_readers"
+	WebSocketEventReceiptCounts   = "custom_mattermost-readreceipts_receipt_counts"
+	WebSocketEventAcknowledged    = "custom_mattermost-readreceipts_acknowledged"
+	WebSocketEventReceiptsEnabled = "custom_mattermost-readreceipts_receipts_enabled"
+	WebSocketEventReadCounts      = "custom_mattermost-readreceipts_read_counts"
 )
 
 // PublishReadReceipt publishes a WebSocket event when a message is read
@@ -20,27 +24,119 @@ func (p *Plugin) PublishReadReceipt(channelID, messageID, userID string, timesta
 	)
 }
 
-// PublishChannelReadersUpdate publishes a websocket event when UpsertChannelRead succeeds
-func (p *Plugin) PublishChannelReadersUpdate(channelID, lastPostID string, userIDs []string) {
-	p.API.LogDebug("🚀 [WebSocket] Broadcasting WebSocketEventChannelReadersUpdate", "channelID", channelID, "lastPostID", lastPostID, "userIDs", userIDs)
+// PublishChannelReadersAdded tells the channel's clients about new readers,
+// as a map of post ID to the user IDs to add. Users who may not see others'
+// receipts are left out.
+func (p *Plugin) PublishChannelReadersAdded(channelID string, added map[string][]string) {
+	privacy := p.getBroadcastPrivacy()
+	if privacy == nil {
+		return
+	}
 
+	// Plugin RPC gob-encodes the payload, which only knows map[string]interface{}
+	payload := make(map[string]interface{}, len(added))
+	for postID, userIDs := range added {
+		payload[postID] = userIDs
+	}
 	eventData := map[string]interface{}{
-		"ChannelID":  channelID,
-		"LastPostID": lastPostID,
-		"UserIDs":    userIDs,
+		"ChannelID":    channelID,
+		"AddedReaders": payload,
 	}
 
-	broadcast := &model.WebsocketBroadcast{
-		ChannelId: channelID,
+	p.API.LogDebug("🚀 [WebSocket] Publishing channel readers delta", "event", WebSocketEventChannelReaders, "data", eventData)
+
+	p.API.PublishWebSocketEvent(
+		WebSocketEventChannelReaders,
+		eventData,
+		privacy.channelBroadcast(channelID),
+	)
+}
+
+// PublishChannelReadersRemoved tells the channel's clients to drop users from
+// their readers, e.g. after they left the channel
+func (p *Plugin) PublishChannelReadersRemoved(channelID string, userIDs []string) {
+	eventData := map[string]interface{}{
+		"ChannelID":      channelID,
+		"RemovedUserIDs": userIDs,
 	}
 
-	p.API.LogDebug("🚀 [WebSocket] Publishing channel readers event", "event", WebSocketEventChannelReaders, "data", eventData, "broadcast", broadcast)
+	p.API.LogDebug("🚀 [WebSocket] Publishing channel readers removal", "event", WebSocketEventChannelReaders, "data", eventData)
 
 	p.API.PublishWebSocketEvent(
 		WebSocketEventChannelReaders,
 		eventData,
-		broadcast,
+		&model.WebsocketBroadcast{ChannelId: channelID},
+	)
+}
+
+// PublishReceiptCounts sends a post's delivered and read counts to its author
+func (p *Plugin) PublishReceiptCounts(authorID, channelID string, counts *PostReceiptCounts) {
+	eventData := map[string]interface{}{
+		"MessageID":      counts.PostID,
+		"ChannelID":      channelID,
+		"DeliveredCount": counts.DeliveredCount,
+		"ReadCount":      counts.ReadCount,
+	}
+
+	p.API.LogDebug("🚀 [WebSocket] Publishing receipt counts", "event", WebSocketEventReceiptCounts, "data", eventData)
+
+	p.API.PublishWebSocketEvent(
+		WebSocketEventReceiptCounts,
+		eventData,
+		&model.WebsocketBroadcast{UserId: authorID},
+	)
+}
+
+// PublishReadCounts sends a post's delivered and read counts to a large
+// channel, in place of its reader list
+func (p *Plugin) PublishReadCounts(channelID string, counts *PostReceiptCounts, broadcast *model.WebsocketBroadcast) {
+	eventData := map[string]interface{}{
+		"MessageID":      counts.PostID,
+		"ChannelID":      channelID,
+		"DeliveredCount": counts.DeliveredCount,
+		"ReadCount":      counts.ReadCount,
+	}
+
+	p.API.LogDebug("🚀 [WebSocket] Publishing read counts", "event", WebSocketEventReadCounts, "data", eventData)
+
+	p.API.PublishWebSocketEvent(WebSocketEventReadCounts, eventData, broadcast)
+}
+
+// PublishAcknowledged tells a post's author who acknowledged it, with how
+// many of the counted members have acknowledged it so far
+func (p *Plugin) PublishAcknowledged(authorID, channelID, messageID, userID string, ackedCount, memberCount int) {
+	eventData := map[string]interface{}{
+		"MessageID":   messageID,
+		"ChannelID":   channelID,
+		"UserID":      userID,
+		"AckedCount":  ackedCount,
+		"MemberCount": memberCount,
+	}
+
+	p.API.LogDebug("🚀 [WebSocket] Publishing acknowledgement", "event", WebSocketEventAcknowledged, "data", eventData)
+
+	p.API.PublishWebSocketEvent(
+		WebSocketEventAcknowledged,
+		eventData,
+		&model.WebsocketBroadcast{UserId: authorID},
 	)
+}
+
+// PublishReceiptsEnabled tells a channel's or a team's clients that receipts
+// were turned on or off there, so they can show or hide their indicators.
+// Exactly one of channelID and teamID is set.
+func (p *Plugin) PublishReceiptsEnabled(channelID, teamID string, enabled bool) {
+	eventData := map[string]interface{}{
+		"ChannelID": channelID,
+		"TeamID":    teamID,
+		"Enabled":   enabled,
+	}
+
+	p.API.LogDebug("🚀 [WebSocket] Publishing receipts enabled", "event", WebSocketEventReceiptsEnabled, "data", eventData)
 
-	p.API.LogDebug("✅ [WebSocket] Channel readers event published successfully")
+	p.API.PublishWebSocketEvent(
+		WebSocketEventReceiptsEnabled,
+		eventData,
+		&model.WebsocketBroadcast{ChannelId: channelID, TeamId: teamID},
+	)
 }
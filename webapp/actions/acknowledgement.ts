@@ -0,0 +1,39 @@
+import { getUserId } from '../utils';
+
+const ACK_REQUIRED_PROP = 'readreceipts_ack_required';
+
+/**
+ * Whether the "Require acknowledgement" menu item applies to a post: only
+ * the author may mark it, and only once.
+ * @param postId - The ID of the post the menu is open on
+ */
+export function canRequireAck(postId: string): boolean {
+    const post = (window as any).store?.getState()?.entities?.posts?.posts?.[postId];
+    return Boolean(post) && post.user_id === getUserId() && !post.props?.[ACK_REQUIRED_PROP];
+}
+
+/**
+ * Marks a post as requiring acknowledgement. The server adds the
+ * "Acknowledge" button to it.
+ * @param postId - The ID of the post to mark
+ */
+export async function requireAck(postId: string): Promise<void> {
+    const csrfToken = document.cookie.match(/MMCSRF=([^;]+)/)?.[1] || '';
+    try {
+        const response = await fetch(`/plugins/mattermost-readreceipts/api/v2/posts/${postId}/ack_required`, {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken,
+            },
+            credentials: 'same-origin',
+        });
+        if (!response.ok) {
+            throw new Error(`Server returned ${response.status}`);
+        }
+    } catch (error) {
+        console.error('❌ [Acknowledgement] Failed to require acknowledgement:', {
+            postId,
+            error: error instanceof Error ? error.message : String(error)
+        });
+    }
+}
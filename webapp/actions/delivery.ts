@@ -0,0 +1,76 @@
+import { getUserId } from '../utils';
+
+// How long acks wait for others to share a request with
+const ACK_DELAY_MS = 1000;
+// Matches the server's cap on message_ids per request
+const MAX_ACK_BATCH = 200;
+
+const pendingAcks = new Set<string>();
+let flushTimer: ReturnType<typeof setTimeout> | null = null;
+
+/**
+ * Acknowledges that a post reached this client, so its author sees it as
+ * delivered before anyone reads it. Bound to Mattermost's `posted` event.
+ * Acks are batched: posts arriving within a second share one request.
+ * @param event - The native `posted` WebSocket event
+ */
+export function ackDelivered(event: any): void {
+    let post: any;
+    try {
+        post = JSON.parse(event?.data?.post || '{}');
+    } catch (error) {
+        console.error('❌ [Delivery] Invalid posted event:', error);
+        return;
+    }
+
+    const currentUserId = getUserId();
+    if (!post.id || !currentUserId || post.user_id === currentUserId) {
+        return;
+    }
+
+    pendingAcks.add(post.id);
+    if (pendingAcks.size >= MAX_ACK_BATCH) {
+        void flushAcks();
+    } else if (!flushTimer) {
+        flushTimer = setTimeout(() => void flushAcks(), ACK_DELAY_MS);
+    }
+}
+
+/**
+ * Sends the pending acks in one request.
+ */
+async function flushAcks(): Promise<void> {
+    if (flushTimer) {
+        clearTimeout(flushTimer);
+        flushTimer = null;
+    }
+    const messageIds = Array.from(pendingAcks).slice(0, MAX_ACK_BATCH);
+    if (messageIds.length === 0) {
+        return;
+    }
+    messageIds.forEach((id) => pendingAcks.delete(id));
+    if (pendingAcks.size > 0) {
+        flushTimer = setTimeout(() => void flushAcks(), ACK_DELAY_MS);
+    }
+
+    const csrfToken = document.cookie.match(/MMCSRF=([^;]+)/)?.[1] || '';
+    try {
+        const response = await fetch('/plugins/mattermost-readreceipts/api/v2/delivered', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken,
+            },
+            credentials: 'same-origin',
+            body: JSON.stringify({ message_ids: messageIds }),
+        });
+        if (!response.ok) {
+            throw new Error(`Server returned ${response.status}`);
+        }
+    } catch (error) {
+        console.error('❌ [Delivery] Failed to acknowledge delivery:', {
+            postIds: messageIds,
+            error: error instanceof Error ? error.message : String(error)
+        });
+    }
+}
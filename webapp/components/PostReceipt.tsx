@@ -5,6 +5,8 @@ import VisibilityTracker from './VisibilityTracker';
 import { Post } from '../types/mattermost-webapp';
 import { RootState } from '../store/types';
 import { selectReaders } from '../store/channelReaders';
+import { selectReceiptsDisabled } from '../store/receiptSettings';
+import { selectReadCount } from '../store/readCounts';
 import { loadInitialReceipts } from '../store';
 import { reinitializeReadReceipts } from '../plugin';
 import styles from './PostReceipt.module.css';
@@ -58,6 +60,13 @@ const PostReceipt: FC<PostReceiptProps> = ({ post }): ReactElement | null => {
             return readers;
         });
 
+        // Receipts turned off for the channel or its team hide every indicator
+        const teamId = (window as any).store?.getState()?.entities?.channels?.channels?.[post.channel_id]?.team_id;
+        const receiptsDisabled = useSelector((state: RootState) => selectReceiptsDisabled(state, post.channel_id, teamId));
+
+        // Large channels only report how many members read the post
+        const readCount = useSelector((state: RootState) => selectReadCount(state, post.channel_id, messageId));
+
         // Track reader changes
         useEffect(() => {
             if (messageId === 'fpb56zb5ptdemeywszqqo5tywa') {
@@ -104,6 +113,30 @@ const PostReceipt: FC<PostReceiptProps> = ({ post }): ReactElement | null => {
             }
         }, [readerIds, messageId, isOwnMessage, currentUserId]);
 
+        if (receiptsDisabled) {
+            return null;
+        }
+
+        if (readCount !== undefined && readerIds.length === 0) {
+            if (!isOwnMessage) {
+                return (
+                    <VisibilityTracker 
+                        messageId={messageId} 
+                        postAuthorId={post.user_id}
+                        channelId={post.channel_id}
+                        key={`tracker-${messageId}`}
+                    />
+                );
+            }
+            return readCount > 0 ? (
+                <div className="post-receipt-container" data-post-id={messageId} data-component="post-receipt">
+                    <span className="read-receipt-text" style={{ fontSize: '11px', color: 'rgba(63, 67, 80, 0.72)' }}>
+                        Seen by {readCount}
+                    </span>
+                </div>
+            ) : null;
+        }
+
         // If the state hasn't loaded yet, show skeleton
         if (!hasLoadedState) {
             console.log('⌛ [PostReceipt] State loading:', {
@@ -4,6 +4,8 @@ import React from 'react';
 import {PluginRegistry} from 'mattermost-webapp/plugins/registry';
 import PostReceipt from './components/PostReceipt';
 import {handleWebSocketEvent} from './websocket';
+import { ackDelivered } from './actions/delivery';
+import { canRequireAck, requireAck } from './actions/acknowledgement';
 import {loadInitialReceipts, fetchPluginConfig, loadChannelReads} from './store';
 import { ensureChannelReadsOnSwitch } from './store/index';
 import { store as pluginGlobalStoreInstance, setMattermostStore, isStoreInitialized } from './store/pluginStore';
@@ -223,6 +225,9 @@ export default class ReadReceiptPlugin {
                 );
             });
 
+            // Message action that turns a post into one requiring acknowledgement
+            registry.registerPostDropdownMenuAction('Require acknowledgement', requireAck, canRequireAck);
+
             // Register WebSocket handlers
             try {
                 console.log('DEBUG: [ReadReceiptPlugin] Registering WebSocket handlers. pluginGlobalStoreInstance available:', !!pluginGlobalStoreInstance, 'dispatch available:', !!pluginGlobalStoreInstance?.dispatch);
@@ -266,6 +271,9 @@ export default class ReadReceiptPlugin {
                         }
                     });
                     
+                    // Acknowledge delivery of new posts; replaces the test handler above
+                    (registry as any).registerWebSocketEventHandler('posted', ackDelivered);
+
                     // Register handler for read receipt events
                     (registry as any).registerWebSocketEventHandler(
                         'custom_mattermost-readreceipts_read_receipt',
@@ -276,6 +284,16 @@ export default class ReadReceiptPlugin {
                         'custom_mattermost-readreceipts_channel_readers',
                         wsHandler
                     );
+                    // Register handler for receipts being turned on or off
+                    (registry as any).registerWebSocketEventHandler(
+                        'custom_mattermost-readreceipts_receipts_enabled',
+                        wsHandler
+                    );
+                    // Register handler for read counts in large channels
+                    (registry as any).registerWebSocketEventHandler(
+                        'custom_mattermost-readreceipts_read_counts',
+                        wsHandler
+                    );
                     // Optionally also keep debugHandler for console output
                     (registry as any).registerWebSocketEventHandler(
                         'custom_mattermost-readreceipts_channel_readers',
@@ -1,5 +1,5 @@
 import { configureStore } from '@reduxjs/toolkit';
-import channelReadersReducer, { selectReaders, addReader, setReaders } from './channelReaders';
+import channelReadersReducer, { selectReaders, addReader, setReaders, mergeReaders, removeReaders } from './channelReaders';
 import type { RootState } from './types';
 
 // Create a test store with the channelReaders reducer
@@ -46,4 +46,20 @@ describe('channelReaders slice', () => {
         const readers = selectReaders(state, 'test-channel', 'test-post');
         expect(readers).toEqual(['user2']);
     });
+
+    test('mergeReaders should add new readers to the existing ones', () => {
+        store.dispatch(setReaders({ channelId: 'test-channel', payload: { 'post1': ['user1'] } }));
+        store.dispatch(mergeReaders({ channelId: 'test-channel', payload: { 'post1': ['user2', 'user1'], 'post2': ['user3'] } }));
+        const state = getState();
+        expect(selectReaders(state, 'test-channel', 'post1')).toEqual(['user1', 'user2']);
+        expect(selectReaders(state, 'test-channel', 'post2')).toEqual(['user3']);
+    });
+
+    test('removeReaders should drop users from every post of the channel', () => {
+        store.dispatch(setReaders({ channelId: 'test-channel', payload: { 'post1': ['user1', 'user2'], 'post2': ['user1'] } }));
+        store.dispatch(removeReaders({ channelId: 'test-channel', userIds: ['user1'] }));
+        const state = getState();
+        expect(selectReaders(state, 'test-channel', 'post1')).toEqual(['user2']);
+        expect(selectReaders(state, 'test-channel', 'post2')).toEqual([]);
+    });
 });
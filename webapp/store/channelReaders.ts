@@ -111,11 +111,51 @@ const channelReadersSlice = createSlice({
                 isDM
             });
         },
+
+        // Merges new readers into a channel's posts; the server sends only
+        // the readers added since its last event
+        mergeReaders: (
+            state: ChannelReadersState,
+            action: PayloadAction<{
+                channelId: string;
+                payload: { [postId: string]: string[] };
+            }>
+        ) => {
+            const { channelId, payload } = action.payload;
+            if (!state[channelId]) {
+                state[channelId] = {};
+            }
+
+            Object.entries(payload).forEach(([postId, userIds]) => {
+                const readers = state[channelId][postId] || [];
+                userIds.forEach(id => {
+                    if (!readers.includes(id)) {
+                        readers.push(id);
+                    }
+                });
+                state[channelId][postId] = readers;
+            });
+        },
+
+        // Drops users from every post of a channel, e.g. after they left it
+        removeReaders: (
+            state: ChannelReadersState,
+            action: PayloadAction<{ channelId: string; userIds: string[] }>
+        ) => {
+            const { channelId, userIds } = action.payload;
+            if (!state[channelId]) {
+                return;
+            }
+
+            Object.keys(state[channelId]).forEach(postId => {
+                state[channelId][postId] = state[channelId][postId].filter(id => !userIds.includes(id));
+            });
+        },
     },
 });
 
 // Export actions
-export const { setReaders, addReader } = channelReadersSlice.actions;
+export const { setReaders, addReader, mergeReaders, removeReaders } = channelReadersSlice.actions;
 
 // Selectors
 export const selectChannelSeenMap = (state: RootState, channelId: string) => {
@@ -3,6 +3,8 @@ import { configureStore, EnhancedStore } from '@reduxjs/toolkit';
 import { setMattermostStore as setLegacyMattermostStore } from './legacyStore';
 import { setMattermostStore as setMainMattermostStore } from '../store';
 import channelReadersReducer from './channelReaders';
+import receiptSettingsReducer from './receiptSettings';
+import readCountsReducer from './readCounts';
 
 // Store types
 export interface StoreState {
@@ -71,6 +73,8 @@ const createStore = (): EnhancedStore => {
     const store = configureStore({
         reducer: {
             channelReaders: channelReadersReducer,
+            receiptSettings: receiptSettingsReducer,
+            readCounts: readCountsReducer,
         },
         preloadedState: persistedState || {
             channelReaders: {}, // Ensure this is not undefined
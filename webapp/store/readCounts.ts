@@ -0,0 +1,44 @@
+import { createSlice, PayloadAction } from '@reduxjs/toolkit';
+import { RootState } from './types';
+
+// Large channels get read counts instead of reader lists. Counts are kept
+// per post, apart from channelReaders, since they name nobody.
+export interface ReadCountsState {
+    [channelId: string]: {
+        [postId: string]: number;
+    };
+}
+
+export interface SetReadCountPayload {
+    channelId: string;
+    postId: string;
+    readCount: number;
+}
+
+const initialState: ReadCountsState = {};
+
+const readCountsSlice = createSlice({
+    name: 'readCounts',
+    initialState,
+    reducers: {
+        setReadCount: (
+            state: ReadCountsState,
+            action: PayloadAction<SetReadCountPayload>
+        ) => {
+            const { channelId, postId, readCount } = action.payload;
+            if (!state[channelId]) {
+                state[channelId] = {};
+            }
+            state[channelId][postId] = readCount;
+        },
+    },
+});
+
+export const { setReadCount } = readCountsSlice.actions;
+
+// A post's read count, or undefined when the channel sends reader lists
+export const selectReadCount = (state: RootState, channelId: string, postId: string): number | undefined => {
+    return state.readCounts?.[channelId]?.[postId];
+};
+
+export default readCountsSlice.reducer;
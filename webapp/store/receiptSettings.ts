@@ -0,0 +1,58 @@
+import { createSlice, PayloadAction } from '@reduxjs/toolkit';
+import { RootState } from './types';
+
+// Channels and teams where an admin turned receipts off. Only IDs that are
+// off are kept, so everything else shows receipts as before.
+export interface ReceiptSettingsState {
+    disabledChannels: { [channelId: string]: boolean };
+    disabledTeams: { [teamId: string]: boolean };
+}
+
+export interface ReceiptsEnabledPayload {
+    channelId?: string;
+    teamId?: string;
+    enabled: boolean;
+}
+
+const initialState: ReceiptSettingsState = {
+    disabledChannels: {},
+    disabledTeams: {},
+};
+
+const receiptSettingsSlice = createSlice({
+    name: 'receiptSettings',
+    initialState,
+    reducers: {
+        setReceiptsEnabled: (
+            state: ReceiptSettingsState,
+            action: PayloadAction<ReceiptsEnabledPayload>
+        ) => {
+            const { channelId, teamId, enabled } = action.payload;
+            const disabled = channelId ? state.disabledChannels : state.disabledTeams;
+            const id = channelId || teamId;
+            if (!id) {
+                return;
+            }
+
+            if (enabled) {
+                delete disabled[id];
+            } else {
+                disabled[id] = true;
+            }
+        },
+    },
+});
+
+export const { setReceiptsEnabled } = receiptSettingsSlice.actions;
+
+// Whether receipts are off in a channel, either for the channel itself or
+// for its team
+export const selectReceiptsDisabled = (state: RootState, channelId: string, teamId?: string): boolean => {
+    const settings = state.receiptSettings;
+    if (!settings) {
+        return false;
+    }
+    return Boolean(settings.disabledChannels[channelId] || (teamId && settings.disabledTeams[teamId]));
+};
+
+export default receiptSettingsSlice.reducer;
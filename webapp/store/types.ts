@@ -1,6 +1,10 @@
 // webapp/store/types.ts
 import { ChannelReadersState } from './channelReaders';
+import { ReceiptSettingsState } from './receiptSettings';
+import { ReadCountsState } from './readCounts';
 
 export interface RootState {
     channelReaders: ChannelReadersState;
+    receiptSettings?: ReceiptSettingsState;
+    readCounts?: ReadCountsState;
 }
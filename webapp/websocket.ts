@@ -2,10 +2,14 @@
 
 import { Dispatch } from 'redux';
 import { updateReadReceipts, getUserDisplayName } from './store';
-import { setReaders, addReader } from './store/channelReaders';
+import { setReaders, addReader, mergeReaders, removeReaders } from './store/channelReaders';
+import { setReceiptsEnabled } from './store/receiptSettings';
+import { setReadCount } from './store/readCounts';
 
 const READ_RECEIPT_EVENT = 'custom_mattermost-readreceipts_read_receipt';
 const CHANNEL_READERS_EVENT = 'custom_mattermost-readreceipts_channel_readers';
+const RECEIPTS_ENABLED_EVENT = 'custom_mattermost-readreceipts_receipts_enabled';
+const READ_COUNTS_EVENT = 'custom_mattermost-readreceipts_read_counts';
 
 // Handle WebSocket events from Mattermost's native WebSocket system
 export function handleWebSocketEvent(dispatch: Dispatch) {
@@ -29,8 +33,8 @@ export function handleWebSocketEvent(dispatch: Dispatch) {
                     console.log('⭐ [WebSocket] CRITICAL - Our Custom Event Detected:', {
                         eventType: event.event,
                         fullData: event.data,
-                        hasMessageID: event.data?.MessageID || event.data?.LastPostID,
-                        hasUserID: event.data?.UserID || (Array.isArray(event.data?.UserIDs) ? 'array' : 'missing'),
+                        hasMessageID: event.data?.MessageID,
+                        hasUserID: event.data?.UserID,
                         hasChannelID: event.data?.ChannelID,
                         timestamp: new Date().toISOString()
                     });
@@ -49,7 +53,7 @@ export function handleWebSocketEvent(dispatch: Dispatch) {
                 console.log('🔍 [WebSocket] Processing event:', { eventType, eventData });
                 
                 // Add extra logging to help debug
-                if (eventType === READ_RECEIPT_EVENT || eventType === CHANNEL_READERS_EVENT) {
+                if (eventType === READ_RECEIPT_EVENT || eventType === CHANNEL_READERS_EVENT || eventType === RECEIPTS_ENABLED_EVENT || eventType === READ_COUNTS_EVENT) {
                     console.log('🎯 [WebSocket] Matched our event type!', eventType);
                 } else {
                     console.log('📡 [WebSocket] Event type does not match our handlers:', eventType);
@@ -57,30 +61,46 @@ export function handleWebSocketEvent(dispatch: Dispatch) {
                     return; // Early return for non-matching events
                 }
 
+                // A channel or team admin turned receipts on or off
+                if (eventType === RECEIPTS_ENABLED_EVENT) {
+                    const { ChannelID, TeamID, Enabled } = eventData;
+                    dispatch(setReceiptsEnabled({ channelId: ChannelID, teamId: TeamID, enabled: Boolean(Enabled) }));
+                    return;
+                }
+
+                // Large channels send counts instead of reader lists
+                if (eventType === READ_COUNTS_EVENT) {
+                    const { ChannelID, MessageID, ReadCount } = eventData;
+                    if (ChannelID && MessageID) {
+                        dispatch(setReadCount({ channelId: ChannelID, postId: MessageID, readCount: Number(ReadCount) || 0 }));
+                    }
+                    return;
+                }
+
                 // Handle channel readers updates
                 if (eventType === CHANNEL_READERS_EVENT) {
-                    const { ChannelID, LastPostID, UserIDs } = eventData;
-                    console.log('📊 [WebSocket] Channel readers event data:', { ChannelID, LastPostID, UserIDs });
-                    if (ChannelID && LastPostID && Array.isArray(UserIDs)) {
-                        // REDUX TRACE: Channel Readers Event
-                        const actionPayload = {
-                            channelId: ChannelID,
-                            payload: { [LastPostID]: UserIDs }
-                        };
-                        console.log('識 [Redux Trace] Channel Readers Event:', {
-                            eventType: CHANNEL_READERS_EVENT,
-                            actionType: 'channelReaders/setReaders',
-                            payload: actionPayload,
-                            timestamp: new Date().toISOString()
-                        });
-
-                        // Dispatch with tracing
-                        console.log('識 [Redux] Pre-dispatch state check for channel:', ChannelID, 'post:', LastPostID);
-                        dispatch(setReaders(actionPayload));
-                        console.log('識 [Redux] Post-dispatch completed for channel readers, payload:', actionPayload);
-                    } else {
-                        console.error('❌ [WebSocket] Invalid channel readers data:', eventData);
+                    const { ChannelID, Readers, AddedReaders, RemovedUserIDs } = eventData;
+                    console.log('📊 [WebSocket] Channel readers event data:', { ChannelID, Readers, AddedReaders, RemovedUserIDs });
+
+                    // Users who left the channel are no longer readers
+                    if (ChannelID && Array.isArray(RemovedUserIDs)) {
+                        dispatch(removeReaders({ channelId: ChannelID, userIds: RemovedUserIDs }));
+                        return;
+                    }
+
+                    // New readers of any of the channel's posts, merged by the server
+                    if (ChannelID && AddedReaders && typeof AddedReaders === 'object') {
+                        dispatch(mergeReaders({ channelId: ChannelID, payload: AddedReaders }));
+                        return;
                     }
+
+                    // Batched reads carry the readers of every post in one event
+                    if (ChannelID && Readers && typeof Readers === 'object') {
+                        dispatch(setReaders({ channelId: ChannelID, payload: Readers }));
+                        return;
+                    }
+
+                    console.error('❌ [WebSocket] Invalid channel readers data:', eventData);
                     return;
                 }
 